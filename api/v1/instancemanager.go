@@ -3,6 +3,71 @@ package v1
 type CreateHostRequest struct {
 	// [REQUIRED]
 	HostInstance *HostInstance `json:"host_instance"`
+	// Time to live of the host in seconds. The host gets deleted automatically once it expires.
+	// Hosts never expire if not set.
+	TTLSeconds int64 `json:"ttl_seconds,omitempty"`
+}
+
+type ExtendHostRequest struct {
+	// [REQUIRED] The host expiration time is set to this many seconds from now.
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+type SetHostLabelsRequest struct {
+	// The user labels of the host are replaced with these.
+	Labels map[string]string `json:"labels"`
+}
+
+type UserRole struct {
+	// Either `user`, `auditor` or `admin`. Auditors may list the hosts of every user, admins may
+	// also delete any host and revoke the credentials of any user.
+	Role string `json:"role"`
+}
+
+type CreateAPIKeyRequest struct {
+	// Description of the key, i.e: "presubmit bot".
+	Name string `json:"name"`
+	// The username of the requests authenticated with the key. It's recorded as the creator of the
+	// hosts created with the key.
+	Identity string `json:"identity"`
+	// The key never expires if zero.
+	TTLSeconds int64 `json:"ttl_seconds,omitempty"`
+}
+
+type APIKey struct {
+	// [Output Only] Unique identifier of the key.
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Identity string `json:"identity"`
+	// [Output Only] The admin who created the key.
+	CreatedBy string `json:"created_by"`
+	// [Output Only] Creation time in RFC3339 format.
+	CreateTime string `json:"create_time"`
+	// [Output Only] Expiration time in RFC3339 format, empty if the key never expires.
+	ExpireTime string `json:"expire_time,omitempty"`
+	// [Output Only] The secret to send in the X-Cutf-Api-Key header, only returned when the key is
+	// created.
+	Key string `json:"key,omitempty"`
+}
+
+type ListAPIKeysResponse struct {
+	Items []*APIKey `json:"items"`
+}
+
+// Access to a host granted by its owner to other users and groups.
+type HostACL struct {
+	// [Output Only] The user who owns the host, only the owner may change the access control list.
+	Owner string `json:"owner,omitempty"`
+	// Setting the list replaces every existing entry, an empty list stops sharing the host.
+	Entries []*HostACLEntry `json:"entries"`
+}
+
+type HostACLEntry struct {
+	// Either `user:<username>` or `group:<group name>`.
+	Principal string `json:"principal"`
+	// Either `viewer` or `editor`. Viewers may list the host, connect to its devices and send GET
+	// requests to it, editors may also create and delete CVDs and delete the host.
+	Role string `json:"role"`
 }
 
 type Zone struct {
@@ -18,6 +83,33 @@ type HostInstance struct {
 	GCP *GCPInstance `json:"gcp,omitempty"`
 	// Docker specific properties.
 	Docker *DockerInstance `json:"docker,omitempty"`
+	// [Output Only] Expiration timestamp in RFC3339 text format, empty if the host never expires.
+	ExpireTime string `json:"expire_time,omitempty"`
+	// [Output Only] How the host is reclaimed when idle, empty if idle hosts are not reclaimed.
+	IdlePolicy *IdlePolicy `json:"idle_policy,omitempty"`
+	// [Output Only] Lifecycle status, one of `PROVISIONING`, `RUNNING`, `STOPPING`, `SUSPENDED` or
+	// `TERMINATED`. Stopped hosts are `TERMINATED`.
+	Status string `json:"status,omitempty"`
+	// [Output Only] Creation timestamp in RFC3339 text format.
+	CreateTime string `json:"create_time,omitempty"`
+	// [Output Only] IP addresses of the host, both internal and external if any.
+	IPAddresses []string `json:"ip_addresses,omitempty"`
+	// Labels set by the user, the ones used internally by the orchestrator are not included. Keys
+	// must start with a lowercase letter and, as values, can only contain lowercase letters, digits,
+	// underscores and dashes. Keys starting with `cf-` are reserved.
+	Labels map[string]string `json:"labels,omitempty"`
+	// [Output Only] The user who owns the host.
+	Owner string `json:"owner,omitempty"`
+	// [Output Only] Zone of the host, only reported when listing the hosts of every zone.
+	Zone string `json:"zone,omitempty"`
+}
+
+type IdlePolicy struct {
+	// What happens to the host once reclaimed, either `stop` or `delete`.
+	Action string `json:"action"`
+	// Timestamp in RFC3339 text format at which the host will be reclaimed if it remains idle. Running
+	// CVDs or requests to the host postpone it.
+	ReclaimTime string `json:"reclaim_time"`
 }
 
 type DockerInstance struct {
@@ -47,15 +139,30 @@ type AcceleratorConfig struct {
 
 type Operation struct {
 	Name string `json:"name"`
-	// Service-specific metadata associated with the operation.  It typically
-	// contains progress information and common metadata such as create time.
-	Metadata any `json:"metadata,omitempty"`
+	// Metadata associated with the operation.  It typically contains progress
+	// information and common metadata such as create time.
+	Metadata *OperationMetadata `json:"metadata,omitempty"`
 	// If the value is `false`, it means the operation is still in progress.
 	// If `true`, the operation is completed, and either `error` or `response` is
 	// available.
 	Done bool `json:"done"`
 }
 
+type OperationMetadata struct {
+	// The kind of operation, i.e: `createhost` or `deletehost`.
+	Type string `json:"type,omitempty"`
+	// The user who started the operation.
+	User string `json:"user,omitempty"`
+	// The host the operation acts on.
+	Host string `json:"host,omitempty"`
+	// One of `PENDING`, `RUNNING`, `DONE`, `ERROR` or `CANCELLED`.
+	State string `json:"state,omitempty"`
+	// Creation timestamp in RFC3339 text format.
+	CreateTime string `json:"create_time,omitempty"`
+	// Last update timestamp in RFC3339 text format.
+	UpdateTime string `json:"update_time,omitempty"`
+}
+
 type OperationResult struct {
 	// The error result of the operation in case of failure or cancellation.
 	Error *Error `json:"error,omitempty"`
@@ -80,6 +187,28 @@ type ListHostsResponse struct {
 	NextPageToken string `json:"nextPageToken,omitempty"`
 }
 
+type ListOperationsResponse struct {
+	Items []*Operation `json:"items"`
+	// This token allows you to get the next page of results for list requests.
+	NextPageToken string `json:"nextPageToken,omitempty"`
+}
+
+type Quota struct {
+	// Hosts owned by the user across all zones.
+	Hosts *QuotaMetric `json:"hosts"`
+	// Accelerators attached to the hosts owned by the user across all zones.
+	Accelerators *QuotaMetric `json:"accelerators"`
+	// Hosts owned by every user, keyed by zone. Only zones with hosts are included.
+	ZoneHosts map[string]*QuotaMetric `json:"zone_hosts,omitempty"`
+}
+
+type QuotaMetric struct {
+	// Maximum allowed value, unlimited if zero.
+	Limit int64 `json:"limit,omitempty"`
+	// Current value.
+	Usage int64 `json:"usage"`
+}
+
 // To be separated in to new file if the config needs to contain intormation other than instance manager
 type Config struct {
 	InstanceManagerType string `json:"instance_manager_type"`
@@ -3,6 +3,8 @@ package v1
 type Error struct {
 	Code     int    `json:"code"`
 	ErrorMsg string `json:"error"`
+	// Additional structured information about the error, if any.
+	Details any `json:"details,omitempty"`
 }
 
 type NewConnMsg struct {
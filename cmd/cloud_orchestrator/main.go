@@ -16,18 +16,26 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/google/cloud-android-orchestration/pkg/app"
 	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
 	"github.com/google/cloud-android-orchestration/pkg/app/config"
 	"github.com/google/cloud-android-orchestration/pkg/app/database"
 	"github.com/google/cloud-android-orchestration/pkg/app/encryption"
+	"github.com/google/cloud-android-orchestration/pkg/app/https"
 	"github.com/google/cloud-android-orchestration/pkg/app/instances"
 	appOAuth2 "github.com/google/cloud-android-orchestration/pkg/app/oauth2"
 	"github.com/google/cloud-android-orchestration/pkg/app/secrets"
+	"github.com/google/cloud-android-orchestration/pkg/app/vault"
 
 	"github.com/docker/docker/client"
 	"github.com/google/uuid"
@@ -48,8 +56,10 @@ func LoadConfiguration() *config.Config {
 	return config
 }
 
-func LoadInstanceManager(config *config.Config) instances.Manager {
+func LoadInstanceManager(config *config.Config, dbs database.Service) instances.Manager {
 	var im instances.Manager
+	var idlePolicy instances.IdlePolicy
+	var warmPools []instances.WarmPoolConfig
 	switch config.InstanceManager.Type {
 	case instances.GCEIMType:
 		service, err := compute.NewService(context.Background())
@@ -59,7 +69,9 @@ func LoadInstanceManager(config *config.Config) instances.Manager {
 		nameGenerator := &instances.InstanceNameGenerator{
 			UUIDFactory: func() string { return uuid.New().String() },
 		}
-		im = instances.NewGCEInstanceManager(config.InstanceManager, service, nameGenerator)
+		im = instances.NewGCEInstanceManager(config.InstanceManager, service, nameGenerator, dbs)
+		idlePolicy = config.InstanceManager.GCP.IdlePolicy
+		warmPools = config.InstanceManager.GCP.WarmPools
 	case instances.UnixIMType:
 		im = instances.NewLocalInstanceManager(config.InstanceManager)
 	case instances.DockerIMType:
@@ -67,14 +79,61 @@ func LoadInstanceManager(config *config.Config) instances.Manager {
 		if err != nil {
 			log.Fatal("Failed to get docker client: ", err)
 		}
-		im = instances.NewDockerInstanceManager(config.InstanceManager, *cli)
+		dockerIM := instances.NewDockerInstanceManager(config.InstanceManager, *cli, dbs)
+		go func() {
+			count, err := dockerIM.FailStaleOperations()
+			if err != nil {
+				log.Printf("Failed to check for abandoned operations: %v", err)
+			}
+			if count > 0 {
+				log.Printf("Marked %d abandoned operation(s) as failed", count)
+			}
+		}()
+		im = dockerIM
+		idlePolicy = config.InstanceManager.Docker.IdlePolicy
+		warmPools = config.InstanceManager.Docker.WarmPools
 	default:
 		log.Fatal("Unknown Instance Manager type: ", config.InstanceManager.Type)
 	}
+	if len(warmPools) > 0 {
+		pool, err := instances.NewWarmPool(im, warmPools, config.Quota)
+		if err != nil {
+			log.Fatal("Failed to build warm host pool: ", err)
+		}
+		go pool.Run(context.Background())
+		im = pool
+	}
+	if idlePolicy.Enabled() {
+		monitor, err := instances.NewIdleHostMonitor(im, idlePolicy, dbs)
+		if err != nil {
+			log.Fatal("Failed to build idle host monitor: ", err)
+		}
+		go monitor.Run(context.Background())
+		im = monitor
+	}
+	if config.Quota.Enabled() {
+		quota, err := instances.NewQuotaEnforcer(im, config.Quota)
+		if err != nil {
+			log.Fatal("Failed to build quota enforcer: ", err)
+		}
+		im = quota
+	}
 	return im
 }
 
-func LoadSecretManager(config *config.Config) secrets.SecretManager {
+// Returns nil if Vault isn't configured.
+func LoadVaultClient(config *config.Config) *vault.Client {
+	if !config.Vault.Enabled() {
+		return nil
+	}
+	client, err := vault.NewClient(config.Vault)
+	if err != nil {
+		log.Fatal("Failed to create Vault client: ", err)
+	}
+	return client
+}
+
+func LoadSecretManager(config *config.Config, vaultClient *vault.Client) secrets.SecretManager {
 	var sm secrets.SecretManager
 	switch config.SecretManager.Type {
 	case secrets.GCPSMType:
@@ -85,10 +144,25 @@ func LoadSecretManager(config *config.Config) secrets.SecretManager {
 		}
 	case secrets.UnixSMType:
 		var err error
-		sm, err = secrets.NewFromFileSecretManager(config.SecretManager.UNIX.SecretFilePath)
+		sm, err = secrets.NewFromFileSecretManager(config.SecretManager.UNIX)
 		if err != nil {
 			log.Fatal(err)
 		}
+	case secrets.VaultSMType:
+		if vaultClient == nil {
+			log.Fatal("The Vault secret manager requires the Vault address to be configured")
+		}
+		var err error
+		sm, err = secrets.NewVaultSecretManager(vaultClient, config.SecretManager.Vault)
+		if err != nil {
+			log.Fatal("Failed to build Secret Manager: ", err)
+		}
+	case secrets.EnvSMType:
+		var err error
+		sm, err = secrets.NewEnvSecretManager(config.SecretManager.Env)
+		if err != nil {
+			log.Fatal("Failed to build Secret Manager: ", err)
+		}
 	case secrets.EmptySMType:
 		return secrets.NewEmptySecretManager()
 	default:
@@ -98,17 +172,14 @@ func LoadSecretManager(config *config.Config) secrets.SecretManager {
 }
 
 func LoadOAuth2Config(config *config.Config, sm secrets.SecretManager) *appOAuth2.Helper {
-	var oauth2Helper *appOAuth2.Helper
-	switch config.AccountManager.OAuth2.Provider {
-	case appOAuth2.GoogleOAuth2Provider:
-		oauth2Helper = appOAuth2.NewGoogleOAuth2Helper(config.AccountManager.OAuth2.RedirectURL, sm)
-	default:
-		log.Fatal("Unknown oauth2 provider: ", config.AccountManager.OAuth2.Provider)
+	oauth2Helper, err := appOAuth2.NewHelper(config.AccountManager.OAuth2, sm)
+	if err != nil {
+		log.Fatal("Failed to configure oauth2 provider: ", err)
 	}
 	return oauth2Helper
 }
 
-func LoadAccountManager(config *config.Config) accounts.Manager {
+func LoadAccountManager(config *config.Config, dbs database.Service) accounts.Manager {
 	var am accounts.Manager
 	switch config.AccountManager.Type {
 	case accounts.GAEAMType:
@@ -117,22 +188,62 @@ func LoadAccountManager(config *config.Config) accounts.Manager {
 		am = accounts.NewUnixAccountManager()
 	case accounts.UsernameOnlyAMType:
 		am = accounts.NewUsernameOnlyAccountManager()
+	case accounts.OIDCAMType:
+		var err error
+		am, err = accounts.NewOIDCAccountManager(config.AccountManager.OIDC)
+		if err != nil {
+			log.Fatal("Failed to create OIDC account manager: ", err)
+		}
+	case accounts.MTLSAMType:
+		if !config.TLS.Enabled() {
+			log.Fatal("The mTLS account manager requires the orchestrator to serve TLS, set TLS.CertFile")
+		}
+		var err error
+		am, err = accounts.NewMTLSAccountManager(config.AccountManager.MTLS)
+		if err != nil {
+			log.Fatal("Failed to create mTLS account manager: ", err)
+		}
 	default:
 		log.Fatal("Unknown Account Manager type: ", config.AccountManager.Type)
 	}
+	if !config.AccountManager.AuthenticatesUsers() &&
+		(len(config.AccountManager.Admins) > 0 || len(config.AccountManager.Auditors) > 0) {
+		log.Fatal("Admins and auditors require an account manager that authenticates users, not: ", config.AccountManager.Type)
+	}
+	if config.AccountManager.EnableAPIKeys {
+		am = accounts.NewAPIKeyAccountManager(am, dbs)
+	}
 	return am
 }
 
-func LoadEncryptionService(config *config.Config) encryption.Service {
+func LoadEncryptionService(config *config.Config, vaultClient *vault.Client) encryption.Service {
 	var es encryption.Service
 	switch config.EncryptionService.Type {
 	case encryption.FakeESType:
 		es = encryption.NewFakeEncryptionService()
 	case encryption.GCPKMSESType:
 		es = encryption.NewGCPKMSEncryptionService(config.EncryptionService.GCPKMS.KeyName)
+	case encryption.LocalESType:
+		var err error
+		es, err = encryption.NewLocalEncryptionService(config.EncryptionService.Local.KeyringFile)
+		if err != nil {
+			log.Fatal("Failed to load encryption keyring: ", err)
+		}
+	case encryption.VaultTransitESType:
+		if vaultClient == nil {
+			log.Fatal("The Vault transit encryption service requires the Vault address to be configured")
+		}
+		var err error
+		es, err = encryption.NewVaultTransitEncryptionService(vaultClient, config.EncryptionService.VaultTransit)
+		if err != nil {
+			log.Fatal("Failed to build Vault transit encryption service: ", err)
+		}
 	default:
 		log.Fatal("Unknown encryption service type: ", config.EncryptionService.Type)
 	}
+	if envelope := config.EncryptionService.Envelope; envelope != nil {
+		es = encryption.NewEnvelopeEncryptionService(es, *envelope)
+	}
 	return es
 }
 
@@ -142,7 +253,32 @@ func LoadDatabaseService(config *config.Config) database.Service {
 	case database.InMemoryDBType:
 		dbs = database.NewInMemoryDBService()
 	case database.SpannerDBType:
-		dbs = database.NewSpannerDBService(config.DatabaseService.Spanner.DatabaseName)
+		if config.DatabaseService.Spanner == nil {
+			log.Fatal("Missing [DatabaseService.Spanner] configuration section for the spanner database")
+		}
+		var err error
+		dbs, err = database.NewSpannerDBService(*config.DatabaseService.Spanner)
+		if err != nil {
+			log.Fatal("Failed to create spanner database client: ", err)
+		}
+	case database.FileDBType:
+		if config.DatabaseService.File == nil {
+			log.Fatal("Missing [DatabaseService.File] configuration section for the file database")
+		}
+		var err error
+		dbs, err = database.NewFileDBService(config.DatabaseService.File.Path)
+		if err != nil {
+			log.Fatal("Failed to open database file: ", err)
+		}
+	case database.PostgresDBType:
+		if config.DatabaseService.Postgres == nil {
+			log.Fatal("Missing [DatabaseService.Postgres] configuration section for the postgres database")
+		}
+		var err error
+		dbs, err = database.NewPostgresDBService(*config.DatabaseService.Postgres)
+		if err != nil {
+			log.Fatal("Failed to open postgres database: ", err)
+		}
 	default:
 		log.Fatal("Unknown database service type: ", config.DatabaseService.Type)
 	}
@@ -161,6 +297,35 @@ func ChooseNetworkInterface(config *config.Config) string {
 	return ""
 }
 
+func LoadTLSConfig(config *config.Config) *tls.Config {
+	minVersion, err := config.TLS.MinTLSVersion()
+	if err != nil {
+		log.Fatal(err)
+	}
+	reloader, err := https.NewCertReloader(config.TLS.CertFile, config.TLS.KeyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if seconds := config.TLS.ReloadIntervalSeconds; seconds > 0 {
+		go reloader.Run(context.Background(), time.Duration(seconds)*time.Second)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if config.AccountManager.Type == accounts.MTLSAMType {
+		pool, err := accounts.LoadCertPool(config.AccountManager.MTLS.CACertFile)
+		if err != nil {
+			log.Fatal("Failed to load client CA certificates: ", err)
+		}
+		tlsConfig.ClientCAs = pool
+		// Requests without a certificate aren't rejected during the handshake so they can still be
+		// authenticated by other means, i.e: api keys, or reach the unauthenticated routes.
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig
+}
+
 func ServerPort() string {
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -170,21 +335,97 @@ func ServerPort() string {
 	return port
 }
 
+const shutdownTimeout = 30 * time.Second
+
+// Blocks until a termination signal is received, then waits for the in-flight requests to
+// complete and releases the resources held by the database service.
+func WaitForShutdown(server *http.Server, dbs database.Service) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	log.Printf("Received %v, shutting down", sig)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Failed to shut down the server gracefully: %v", err)
+	}
+	if closer, ok := dbs.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Failed to close the database service: %v", err)
+		}
+	}
+}
+
 func main() {
 	config := LoadConfiguration()
 
-	instanceManager := LoadInstanceManager(config)
-	secretManager := LoadSecretManager(config)
-	oauth2Helper := LoadOAuth2Config(config, secretManager)
-	accountManager := LoadAccountManager(config)
-	encryptionService := LoadEncryptionService(config)
 	dbService := LoadDatabaseService(config)
+	if c, ok := dbService.(database.ExpiredSessionsCollector); ok {
+		go database.CollectExpiredSessions(context.Background(), c, database.SessionGCInterval)
+	}
+	if c, ok := dbService.(database.FinishedOperationsCollector); ok {
+		go database.CollectFinishedOperations(context.Background(), c, database.OperationGCInterval)
+	}
+	instanceManager := LoadInstanceManager(config, dbService)
+	if minutes := config.InstanceManager.HostReaperIntervalMinutes; minutes > 0 {
+		reaper := instances.NewHostReaper(instanceManager, time.Duration(minutes)*time.Minute)
+		go reaper.Run(context.Background())
+	}
+	vaultClient := LoadVaultClient(config)
+	if vaultClient != nil {
+		go vaultClient.Run(context.Background())
+	}
+	secretManager := LoadSecretManager(config, vaultClient)
+	if r, ok := secretManager.(secrets.Reloader); ok {
+		go r.Run(context.Background())
+	}
+	oauth2Helper := LoadOAuth2Config(config, secretManager)
+	accountManager := LoadAccountManager(config, dbService)
+	encryptionService := LoadEncryptionService(config, vaultClient)
+	if es, ok := encryption.AsKeyRotator(encryptionService); ok {
+		// Migrates the credentials to the newest key after the keyring was rotated.
+		go func() {
+			count, err := encryption.ReEncryptCredentials(dbService, es)
+			if err != nil {
+				log.Printf("Failed to re-encrypt credentials: %v", err)
+			}
+			if count > 0 {
+				log.Printf("Re-encrypted the credentials of %d users with key %q", count, es.PrimaryKeyID())
+			}
+		}()
+	}
 	controller := app.NewApp(instanceManager, accountManager, oauth2Helper,
 		encryptionService, dbService, config.WebStaticFilesPath, config.CORSAllowedOrigins, config.WebRTC, config)
 
 	iface := ChooseNetworkInterface(config)
 	port := ServerPort()
 
-	log.Printf("Listening on port %s", port)
-	log.Fatal(http.ListenAndServe(iface+":"+port, controller.Handler()))
+	server := &http.Server{
+		Addr:    iface + ":" + port,
+		Handler: controller.Handler(),
+	}
+	if config.TLS.Enabled() {
+		server.TLSConfig = LoadTLSConfig(config)
+		if redirectPort := config.TLS.RedirectHTTPPort; redirectPort > 0 {
+			go func() {
+				log.Printf("Redirecting HTTP requests on port %d to HTTPS", redirectPort)
+				addr := fmt.Sprintf("%s:%d", iface, redirectPort)
+				log.Fatal(http.ListenAndServe(addr, https.RedirectHandler(port)))
+			}()
+		}
+	}
+	go func() {
+		log.Printf("Listening on port %s", port)
+		var err error
+		if server.TLSConfig != nil {
+			// The certificate is provided by the TLS config.
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	WaitForShutdown(server, dbService)
 }
@@ -26,14 +26,38 @@ type User interface {
 	Email() string
 }
 
+// Implemented by the users that belong to groups, hosts can be shared with whole groups.
+type GroupMember interface {
+	Groups() []string
+}
+
 type Manager interface {
 	// Gets the user from the http request, typically from a cookie or another header.
 	UserFromRequest(r *http.Request) (User, error)
 }
 
+// Implemented by the account managers that identify users from the ID tokens returned by the OAuth2
+// provider. Browser redirects to the OAuth2 callback carry no credentials, the ID token obtained in
+// the callback authenticates the user instead.
+type IDTokenVerifier interface {
+	// Returns nil, nil if the users can't be identified from ID tokens.
+	UserFromIDToken(idToken string) (User, error)
+}
+
 type AMType string
 
 type Config struct {
 	Type   AMType
 	OAuth2 appOAuth2.OAuth2Config
+	// Only used by the OIDC account manager.
+	OIDC OIDCConfig
+	// Only used by the mTLS account manager.
+	MTLS MTLSConfig
+	// Users granted the admin role, it takes precedence over the role stored in the database.
+	Admins []string
+	// Users granted the auditor role, it takes precedence over the role stored in the database.
+	Auditors []string
+	// Whether requests carrying an api key in the X-Cutf-Api-Key header are authenticated as the
+	// service identity the key is bound to. Other requests are still authenticated as usual.
+	EnableAPIKeys bool
 }
@@ -0,0 +1,109 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/apikey"
+	apperr "github.com/google/cloud-android-orchestration/pkg/app/errors"
+)
+
+// Header carrying the api key in the requests sent by service accounts.
+const APIKeyHeader = "X-Cutf-Api-Key"
+
+// Subset of the database service needed to authenticate api keys.
+type APIKeyStore interface {
+	// Returns nil, nil if the key doesn't exist.
+	FetchAPIKey(id string) (*apikey.Key, error)
+}
+
+// Decorates an account manager authenticating the requests that carry an api key as the service
+// identity the key is bound to. Requests without a key are authenticated by the decorated manager,
+// as long as the username isn't in the namespace reserved for service identities.
+type APIKeyAccountManager struct {
+	Manager
+	store APIKeyStore
+	now   func() time.Time
+}
+
+func NewAPIKeyAccountManager(m Manager, store APIKeyStore) *APIKeyAccountManager {
+	return &APIKeyAccountManager{Manager: m, store: store, now: time.Now}
+}
+
+func (m *APIKeyAccountManager) UserFromRequest(r *http.Request) (User, error) {
+	secret := r.Header.Get(APIKeyHeader)
+	if secret == "" {
+		return checkNotServiceIdentity(m.Manager.UserFromRequest(r))
+	}
+	k, err := m.verifyKey(secret)
+	if err != nil {
+		return nil, apperr.NewUnauthenticatedError("Invalid api key", err)
+	}
+	return &APIKeyUser{keyID: k.ID, identity: k.Identity}, nil
+}
+
+func (m *APIKeyAccountManager) UserFromIDToken(idToken string) (User, error) {
+	v, ok := m.Manager.(IDTokenVerifier)
+	if !ok {
+		return nil, nil
+	}
+	return checkNotServiceIdentity(v.UserFromIDToken(idToken))
+}
+
+// Users authenticated by the decorated manager can't impersonate service identities.
+func checkNotServiceIdentity(user User, err error) (User, error) {
+	if err != nil || user == nil {
+		return user, err
+	}
+	if apikey.IsServiceIdentity(user.Username()) {
+		return nil, apperr.NewForbiddenError(fmt.Sprintf("Username %q is reserved for service identities", user.Username()), nil)
+	}
+	return user, nil
+}
+
+func (m *APIKeyAccountManager) verifyKey(secret string) (*apikey.Key, error) {
+	id, err := apikey.ParseID(secret)
+	if err != nil {
+		return nil, err
+	}
+	k, err := m.store.FetchAPIKey(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch api key: %w", err)
+	}
+	if k == nil || !k.Verify(secret) {
+		return nil, fmt.Errorf("unknown api key")
+	}
+	if k.Expired(m.now()) {
+		return nil, fmt.Errorf("api key %q expired at %s", k.ID, k.ExpireTime.Format(time.RFC3339))
+	}
+	return k, nil
+}
+
+// A service account authenticated with an api key, its username is the identity the key is bound
+// to.
+type APIKeyUser struct {
+	keyID    string
+	identity string
+}
+
+func (u *APIKeyUser) Username() string { return u.identity }
+
+func (u *APIKeyUser) Email() string { return "" }
+
+// The id of the key used to authenticate the request.
+func (u *APIKeyUser) KeyID() string { return u.keyID }
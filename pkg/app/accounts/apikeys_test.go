@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/apikey"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeAPIKeyStore map[string]*apikey.Key
+
+func (s fakeAPIKeyStore) FetchAPIKey(id string) (*apikey.Key, error) {
+	return s[id], nil
+}
+
+type fakeFallbackManager string
+
+func (m fakeFallbackManager) UserFromRequest(r *http.Request) (User, error) {
+	return &UsernameOnlyUser{string(m)}, nil
+}
+
+var apiKeyTestNow = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestAPIKey(t *testing.T, ttl time.Duration) (*apikey.Key, string) {
+	k, secret, err := apikey.New("presubmit", "svc-ci-bot", "admin", ttl, apiKeyTestNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, secret
+}
+
+func TestAPIKeyAccountManagerValidKey(t *testing.T) {
+	k, secret := newTestAPIKey(t, time.Hour)
+	m := NewAPIKeyAccountManager(fakeFallbackManager("johndoe"), fakeAPIKeyStore{k.ID: k})
+	m.now = func() time.Time { return apiKeyTestNow }
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set(APIKeyHeader, secret)
+
+	user, err := m.UserFromRequest(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("svc-ci-bot", user.Username()); diff != "" {
+		t.Errorf("username mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAPIKeyAccountManagerNoKey(t *testing.T) {
+	m := NewAPIKeyAccountManager(fakeFallbackManager("johndoe"), fakeAPIKeyStore{})
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	user, err := m.UserFromRequest(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("johndoe", user.Username()); diff != "" {
+		t.Errorf("username mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAPIKeyAccountManagerReservedUsername(t *testing.T) {
+	m := NewAPIKeyAccountManager(fakeFallbackManager("svc-ci-bot"), fakeAPIKeyStore{})
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	_, err := m.UserFromRequest(r)
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestAPIKeyAccountManagerInvalidKey(t *testing.T) {
+	k, secret := newTestAPIKey(t, time.Hour)
+	tests := []struct {
+		name   string
+		secret string
+		now    time.Time
+	}{
+		{"malformed", "foo", apiKeyTestNow},
+		{"unknown", "foo.bar", apiKeyTestNow},
+		{"wrong secret", k.ID + ".bar", apiKeyTestNow},
+		{"expired", secret, apiKeyTestNow.Add(time.Hour)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewAPIKeyAccountManager(fakeFallbackManager("johndoe"), fakeAPIKeyStore{k.ID: k})
+			m.now = func() time.Time { return tc.now }
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.Header.Set(APIKeyHeader, tc.secret)
+
+			_, err := m.UserFromRequest(r)
+
+			if err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestNewAPIKeyInvalidIdentity(t *testing.T) {
+	for _, identity := range []string{"", "svc-", "ci-bot", "svc-CI", "svc-ci bot", "svc-ci@example.com"} {
+		if _, _, err := apikey.New("", identity, "admin", 0, apiKeyTestNow); err == nil {
+			t.Errorf("expected error for identity %q", identity)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	apperr "github.com/google/cloud-android-orchestration/pkg/app/errors"
+)
+
+const MTLSAMType AMType = "mTLS"
+
+type MTLSConfig struct {
+	// PEM file with the certificate authorities trusted to issue client certificates.
+	CACertFile string
+	// Rules mapping client certificates to usernames, the first matching rule is used. If empty,
+	// the username is taken from the first SAN email of the certificate or, if it has none, from
+	// its subject common name. Certificates yielding usernames other than up to 63 lowercase
+	// letters, digits, '_' or '-' are rejected.
+	UsernameRules []MTLSUsernameRule
+}
+
+type MTLSUsernameRule struct {
+	// Either `email` to match the SAN emails of the certificate or `cn` to match its subject common
+	// name.
+	Field string
+	// Regular expression the whole field must match, i.e: `(.+)@example\.com`.
+	Pattern string
+	// Username built from the capture groups of the pattern, i.e: `$1`. The whole field is used if
+	// empty.
+	Username string
+}
+
+const (
+	mtlsEmailField      = "email"
+	mtlsCommonNameField = "cn"
+)
+
+type mtlsRule struct {
+	field    string
+	re       *regexp.Regexp
+	template string
+}
+
+// Implements the Manager interface identifying users from the client certificate presented during
+// the TLS handshake, which requires the orchestrator to terminate TLS itself. Requests without a
+// certificate are not authenticated.
+type MTLSAccountManager struct {
+	roots *x509.CertPool
+	rules []mtlsRule
+	now   func() time.Time
+}
+
+func NewMTLSAccountManager(cfg MTLSConfig) (*MTLSAccountManager, error) {
+	roots, err := LoadCertPool(cfg.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+	var rules []mtlsRule
+	for _, r := range cfg.UsernameRules {
+		if r.Field != mtlsEmailField && r.Field != mtlsCommonNameField {
+			return nil, fmt.Errorf("invalid mTLS username rule field %q, expected email or cn", r.Field)
+		}
+		re, err := regexp.Compile("^(?:" + r.Pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid mTLS username rule pattern %q: %w", r.Pattern, err)
+		}
+		template := r.Username
+		if template == "" {
+			template = "$0"
+		}
+		rules = append(rules, mtlsRule{field: r.Field, re: re, template: template})
+	}
+	return &MTLSAccountManager{roots: roots, rules: rules, now: time.Now}, nil
+}
+
+// Loads the certificates of a PEM file into a pool, fails if the file has none.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	if file == "" {
+		return nil, fmt.Errorf("missing CA certificate file")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %q", file)
+	}
+	return pool, nil
+}
+
+// The certificate chain is verified again here, so users can't be impersonated if the TLS
+// listener was configured to trust other certificate authorities.
+func (m *MTLSAccountManager) UserFromRequest(r *http.Request) (User, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, nil
+	}
+	leaf := r.TLS.PeerCertificates[0]
+	opts := x509.VerifyOptions{
+		Roots:         m.roots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   m.now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, c := range r.TLS.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(opts); err != nil {
+		return nil, apperr.NewUnauthenticatedError("Invalid client certificate", err)
+	}
+	user, err := m.userFromCert(leaf)
+	if err != nil {
+		return nil, err
+	}
+	if !mtlsUsernameRe.MatchString(user.username) {
+		return nil, apperr.NewUnauthenticatedError(
+			fmt.Sprintf("Invalid username %q in client certificate, it must have up to 63 lowercase letters, digits, '_' or '-'", user.username), nil)
+	}
+	return user, nil
+}
+
+// Usernames end up in GCE label values and service identities follow the same constraints, so
+// certificates are held to them too instead of trusting whatever their issuer wrote.
+var mtlsUsernameRe = regexp.MustCompile(`^[a-z0-9_-]{1,63}$`)
+
+func (m *MTLSAccountManager) userFromCert(cert *x509.Certificate) (*MTLSUser, error) {
+	if len(m.rules) == 0 {
+		if len(cert.EmailAddresses) > 0 {
+			email := cert.EmailAddresses[0]
+			username, err := usernameFromEmail(email)
+			if err != nil {
+				return nil, err
+			}
+			return &MTLSUser{username: username, email: email}, nil
+		}
+		if cert.Subject.CommonName != "" {
+			return &MTLSUser{username: cert.Subject.CommonName}, nil
+		}
+		return nil, apperr.NewForbiddenError("The client certificate has neither email nor common name", nil)
+	}
+	for _, rule := range m.rules {
+		values := cert.EmailAddresses
+		if rule.field == mtlsCommonNameField {
+			values = []string{cert.Subject.CommonName}
+		}
+		for _, v := range values {
+			match := rule.re.FindStringSubmatchIndex(v)
+			if match == nil {
+				continue
+			}
+			username := string(rule.re.ExpandString(nil, rule.template, v, match))
+			if username == "" {
+				continue
+			}
+			user := &MTLSUser{username: username}
+			if rule.field == mtlsEmailField {
+				user.email = v
+			}
+			return user, nil
+		}
+	}
+	return nil, apperr.NewForbiddenError("The client certificate doesn't match any username rule", nil)
+}
+
+type MTLSUser struct {
+	username string
+	email    string
+}
+
+func (u *MTLSUser) Username() string { return u.username }
+
+func (u *MTLSUser) Email() string { return u.email }
@@ -0,0 +1,253 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	apperr "github.com/google/cloud-android-orchestration/pkg/app/errors"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	// Path of the PEM file with the CA certificate.
+	file string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, emails ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: cn},
+		EmailAddresses: emails,
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func requestWithCert(cert *x509.Certificate) *http.Request {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	return r
+}
+
+func TestMTLSUserFromRequest(t *testing.T) {
+	ca := newTestCA(t)
+	tests := []struct {
+		name  string
+		rules []MTLSUsernameRule
+		cert  *x509.Certificate
+		want  string
+	}{
+		{
+			name: "default email",
+			cert: ca.issue(t, "John Doe", "johndoe@example.com"),
+			want: "johndoe",
+		},
+		{
+			name: "default common name",
+			cert: ca.issue(t, "ci-bot"),
+			want: "ci-bot",
+		},
+		{
+			name: "email rule",
+			rules: []MTLSUsernameRule{
+				{Field: "email", Pattern: `(.+)@other\.com`, Username: "other-$1"},
+				{Field: "email", Pattern: `(.+)@example\.com`, Username: "$1"},
+			},
+			cert: ca.issue(t, "John Doe", "johndoe@example.com"),
+			want: "johndoe",
+		},
+		{
+			name:  "common name rule",
+			rules: []MTLSUsernameRule{{Field: "cn", Pattern: `bot-[a-z]+`}},
+			cert:  ca.issue(t, "bot-presubmit"),
+			want:  "bot-presubmit",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewMTLSAccountManager(MTLSConfig{CACertFile: ca.file, UsernameRules: tc.rules})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := m.UserFromRequest(requestWithCert(tc.cert))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, user.Username()); diff != "" {
+				t.Errorf("username mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMTLSUserFromRequestNoCertificate(t *testing.T) {
+	m, err := NewMTLSAccountManager(MTLSConfig{CACertFile: newTestCA(t).file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	user, err := m.UserFromRequest(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != nil {
+		t.Errorf("expected no user, got: %q", user.Username())
+	}
+}
+
+func TestMTLSUserFromRequestUntrustedCertificate(t *testing.T) {
+	m, err := NewMTLSAccountManager(MTLSConfig{CACertFile: newTestCA(t).file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := newTestCA(t).issue(t, "johndoe")
+
+	_, err = m.UserFromRequest(requestWithCert(cert))
+
+	appErr, ok := err.(*apperr.AppError)
+	if !ok {
+		t.Fatalf("expected AppError, got: %v", err)
+	}
+	if diff := cmp.Diff(http.StatusUnauthorized, appErr.StatusCode); diff != "" {
+		t.Errorf("status code mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMTLSUserFromRequestNoMatchingRule(t *testing.T) {
+	ca := newTestCA(t)
+	rules := []MTLSUsernameRule{{Field: "email", Pattern: `(.+)@example\.com`, Username: "$1"}}
+	m, err := NewMTLSAccountManager(MTLSConfig{CACertFile: ca.file, UsernameRules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := ca.issue(t, "johndoe", "johndoe@other.com")
+
+	_, err = m.UserFromRequest(requestWithCert(cert))
+
+	appErr, ok := err.(*apperr.AppError)
+	if !ok {
+		t.Fatalf("expected AppError, got: %v", err)
+	}
+	if diff := cmp.Diff(http.StatusForbidden, appErr.StatusCode); diff != "" {
+		t.Errorf("status code mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMTLSUserFromRequestInvalidUsername(t *testing.T) {
+	ca := newTestCA(t)
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+	}{
+		{name: "uppercase common name", cert: ca.issue(t, "CI-Bot")},
+		{name: "common name with spaces", cert: ca.issue(t, "ci bot")},
+		{name: "long common name", cert: ca.issue(t, strings.Repeat("a", 64))},
+		{name: "email with dots", cert: ca.issue(t, "John Doe", "john.doe@example.com")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewMTLSAccountManager(MTLSConfig{CACertFile: ca.file})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = m.UserFromRequest(requestWithCert(tc.cert))
+
+			appErr, ok := err.(*apperr.AppError)
+			if !ok {
+				t.Fatalf("expected AppError, got: %v", err)
+			}
+			if diff := cmp.Diff(http.StatusUnauthorized, appErr.StatusCode); diff != "" {
+				t.Errorf("status code mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewMTLSAccountManagerInvalidRule(t *testing.T) {
+	ca := newTestCA(t)
+	rules := []MTLSUsernameRule{{Field: "uri", Pattern: ".*"}}
+
+	_, err := NewMTLSAccountManager(MTLSConfig{CACertFile: ca.file, UsernameRules: rules})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
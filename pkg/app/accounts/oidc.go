@@ -0,0 +1,349 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	apperr "github.com/google/cloud-android-orchestration/pkg/app/errors"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const OIDCAMType AMType = "OIDC"
+
+type OIDCConfig struct {
+	// Expected value of the `iss` claim, i.e: https://accounts.google.com.
+	Issuer string
+	// The `aud` claim must include at least one of these, usually the OAuth2 client ID.
+	Audiences []string
+	// URL of the issuer's JSON Web Key Set, i.e: https://www.googleapis.com/oauth2/v3/certs.
+	JWKSURL string
+	// Path to a local JSON Web Key Set file, used instead of JWKSURL if set.
+	JWKSFile string
+	// Only users whose verified email belongs to one of these domains are accepted, at least one is
+	// required. Usernames are taken from the local part of the email, so configuring multiple domains
+	// may lead to different users sharing the same username.
+	AllowedEmailDomains []string
+	// Name of the claim listing the groups the user belongs to, if any.
+	GroupsClaim string
+}
+
+// Only keys from these algorithms are supported in the JSON Web Key Set.
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+// Implements the Manager interface validating the OpenID Connect ID tokens sent in the
+// `Authorization: Bearer` header of the requests. Requests without a token are not authenticated.
+// It also implements the IDTokenVerifier interface, the OAuth2 client ID must then be one of the
+// audiences.
+type OIDCAccountManager struct {
+	config OIDCConfig
+	keys   *jwksKeySet
+	now    func() time.Time
+}
+
+func NewOIDCAccountManager(cfg OIDCConfig) (*OIDCAccountManager, error) {
+	if cfg.Issuer == "" {
+		return nil, fmt.Errorf("missing OIDC issuer")
+	}
+	if len(cfg.Audiences) == 0 {
+		return nil, fmt.Errorf("missing OIDC audiences")
+	}
+	if len(cfg.AllowedEmailDomains) == 0 {
+		return nil, fmt.Errorf("missing OIDC allowed email domains")
+	}
+	var fetch func() ([]byte, error)
+	switch {
+	case cfg.JWKSFile != "":
+		fetch = func() ([]byte, error) { return os.ReadFile(cfg.JWKSFile) }
+	case cfg.JWKSURL != "":
+		fetch = func() ([]byte, error) { return fetchJWKS(cfg.JWKSURL) }
+	default:
+		return nil, fmt.Errorf("missing OIDC JSON Web Key Set URL or file")
+	}
+	keys := &jwksKeySet{fetch: fetch}
+	// Fail early if the key set is not available.
+	if err := keys.refresh(); err != nil {
+		return nil, err
+	}
+	return &OIDCAccountManager{config: cfg, keys: keys, now: time.Now}, nil
+}
+
+func (m *OIDCAccountManager) UserFromRequest(r *http.Request) (User, error) {
+	authz := r.Header.Get("Authorization")
+	if authz == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(authz, "Bearer ") {
+		return nil, apperr.NewUnauthenticatedError("Expected a bearer token in the Authorization header", nil)
+	}
+	claims, err := m.verifyToken(strings.TrimPrefix(authz, "Bearer "))
+	if err != nil {
+		return nil, apperr.NewUnauthenticatedError("Invalid bearer token", err)
+	}
+	return m.userFromClaims(claims)
+}
+
+func (m *OIDCAccountManager) UserFromIDToken(idToken string) (User, error) {
+	claims, err := m.verifyToken(idToken)
+	if err != nil {
+		return nil, apperr.NewUnauthenticatedError("Invalid ID token", err)
+	}
+	return m.userFromClaims(claims)
+}
+
+func (m *OIDCAccountManager) verifyToken(tokenString string) (jwt.MapClaims, error) {
+	// Time based claims are verified below, the parser would use the actual time.
+	parser := &jwt.Parser{ValidMethods: oidcSigningMethods, SkipClaimsValidation: true}
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(tokenString, claims, m.keyFunc); err != nil {
+		return nil, err
+	}
+	now := m.now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return nil, fmt.Errorf("token is expired or has no expiration time")
+	}
+	if !claims.VerifyNotBefore(now, false) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+	if !claims.VerifyIssuer(m.config.Issuer, true) {
+		return nil, fmt.Errorf("unexpected issuer: %v", claims["iss"])
+	}
+	for _, aud := range m.config.Audiences {
+		if claims.VerifyAudience(aud, true) {
+			return claims, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected audience: %v", claims["aud"])
+}
+
+func (m *OIDCAccountManager) keyFunc(tk *jwt.Token) (interface{}, error) {
+	kid, _ := tk.Header["kid"].(string)
+	return m.keys.key(kid)
+}
+
+func (m *OIDCAccountManager) userFromClaims(claims jwt.MapClaims) (User, error) {
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return nil, apperr.NewUnauthenticatedError("No email in bearer token", nil)
+	}
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return nil, apperr.NewForbiddenError(fmt.Sprintf("Email %q is not verified", email), nil)
+	}
+	if !m.isAllowedEmail(email) {
+		return nil, apperr.NewForbiddenError(fmt.Sprintf("Email %q doesn't belong to an allowed domain", email), nil)
+	}
+	username, err := usernameFromEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	user := &OIDCUser{username: username, email: email}
+	if m.config.GroupsClaim != "" {
+		groups, _ := claims[m.config.GroupsClaim].([]interface{})
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				user.groups = append(user.groups, s)
+			}
+		}
+	}
+	return user, nil
+}
+
+func (m *OIDCAccountManager) isAllowedEmail(email string) bool {
+	_, domain, _ := strings.Cut(email, "@")
+	for _, d := range m.config.AllowedEmailDomains {
+		if strings.EqualFold(domain, d) {
+			return true
+		}
+	}
+	return false
+}
+
+type OIDCUser struct {
+	username string
+	email    string
+	groups   []string
+}
+
+func (u *OIDCUser) Username() string { return u.username }
+
+func (u *OIDCUser) Email() string { return u.email }
+
+func (u *OIDCUser) Groups() []string { return u.groups }
+
+// Keys are fetched again when a token is signed with an unknown key, as issuers rotate them, but
+// no more than once per jwksMinRefreshInterval.
+const jwksMinRefreshInterval = time.Minute
+
+var jwksHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+type jwksKeySet struct {
+	fetch       func() ([]byte, error)
+	mtx         sync.Mutex
+	keys        map[string]interface{}
+	lastRefresh time.Time
+}
+
+func (s *jwksKeySet) key(kid string) (interface{}, error) {
+	s.mtx.Lock()
+	k, ok := s.keys[kid]
+	// The refresh is claimed while holding the lock so concurrent requests don't fetch the keys too.
+	refresh := !ok && time.Since(s.lastRefresh) >= jwksMinRefreshInterval
+	if refresh {
+		s.lastRefresh = time.Now()
+	}
+	s.mtx.Unlock()
+	if ok {
+		return k, nil
+	}
+	if refresh {
+		if err := s.refresh(); err != nil {
+			return nil, err
+		}
+		s.mtx.Lock()
+		k, ok = s.keys[kid]
+		s.mtx.Unlock()
+		if ok {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// The keys are fetched without holding the lock, requests signed with known keys aren't blocked.
+func (s *jwksKeySet) refresh() error {
+	data, err := s.fetch()
+	if err != nil {
+		return fmt.Errorf("failed to fetch JSON Web Key Set: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.keys = keys
+	if s.lastRefresh.IsZero() {
+		s.lastRefresh = time.Now()
+	}
+	return nil
+}
+
+func fetchJWKS(url string) ([]byte, error) {
+	res, err := jwksHTTPClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return io.ReadAll(res.Body)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// Elliptic curve keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Returns the public keys by key id, keys of unsupported types are ignored.
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON Web Key Set: %w", err)
+	}
+	res := make(map[string]interface{})
+	for _, k := range set.Keys {
+		var key interface{}
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaPublicKey()
+		case "EC":
+			key, err = k.ecdsaPublicKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", k.Kid, err)
+		}
+		res[k.Kid] = key
+	}
+	return res, nil
+}
+
+func (k *jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() > (1<<31)-1 {
+		return nil, fmt.Errorf("exponent too large")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
+
+func (k *jsonWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, fmt.Errorf("point not on curve")
+	}
+	return key, nil
+}
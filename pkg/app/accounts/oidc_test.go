@@ -0,0 +1,207 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	apperr "github.com/google/cloud-android-orchestration/pkg/app/errors"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/go-cmp/cmp"
+)
+
+const testKeyID = "test-key"
+
+func newTestOIDCAccountManager(t *testing.T, key *rsa.PrivateKey) *OIDCAccountManager {
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewOIDCAccountManager(OIDCConfig{
+		Issuer:              "https://issuer.example.com",
+		Audiences:           []string{"cloud-orchestrator"},
+		JWKSFile:            path,
+		AllowedEmailDomains: []string{"example.com"},
+		GroupsClaim:         "groups",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return time.Unix(1000, 0) }
+	return m
+}
+
+func newTestToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	tk := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tk.Header["kid"] = kid
+	res, err := tk.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            "https://issuer.example.com",
+		"aud":            "cloud-orchestrator",
+		"exp":            2000,
+		"email":          "johndoe@example.com",
+		"email_verified": true,
+		"groups":         []string{"camera"},
+	}
+}
+
+func TestOIDCAccountManagerValidToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestOIDCAccountManager(t, key)
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+newTestToken(t, key, testKeyID, testClaims()))
+
+	user, err := m.UserFromRequest(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := user.(*OIDCUser)
+	want := &OIDCUser{username: "johndoe", email: "johndoe@example.com", groups: []string{"camera"}}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(OIDCUser{})); diff != "" {
+		t.Errorf("user mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOIDCAccountManagerNoToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestOIDCAccountManager(t, key)
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	user, err := m.UserFromRequest(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != nil {
+		t.Errorf("expected no user, got: %+v", user)
+	}
+}
+
+func TestOIDCAccountManagerInvalidToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestOIDCAccountManager(t, key)
+	withClaim := func(k string, v interface{}) jwt.MapClaims {
+		c := testClaims()
+		c[k] = v
+		return c
+	}
+	tests := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"expired", newTestToken(t, key, testKeyID, withClaim("exp", 500)), http.StatusUnauthorized},
+		{"no expiration", newTestToken(t, key, testKeyID, withClaim("exp", nil)), http.StatusUnauthorized},
+		{"other issuer", newTestToken(t, key, testKeyID, withClaim("iss", "https://other.example.com")), http.StatusUnauthorized},
+		{"other audience", newTestToken(t, key, testKeyID, withClaim("aud", "other")), http.StatusUnauthorized},
+		{"other key", newTestToken(t, otherKey, testKeyID, testClaims()), http.StatusUnauthorized},
+		{"unknown key id", newTestToken(t, key, "other-key", testClaims()), http.StatusUnauthorized},
+		{"no email", newTestToken(t, key, testKeyID, withClaim("email", nil)), http.StatusUnauthorized},
+		{"other domain", newTestToken(t, key, testKeyID, withClaim("email", "johndoe@other.com")), http.StatusForbidden},
+		{"unverified email", newTestToken(t, key, testKeyID, withClaim("email_verified", false)), http.StatusForbidden},
+		{"no email verification", newTestToken(t, key, testKeyID, withClaim("email_verified", nil)), http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+
+			_, err := m.UserFromRequest(r)
+
+			appErr, ok := err.(*apperr.AppError)
+			if !ok {
+				t.Fatalf("expected AppError, got: %v", err)
+			}
+			if diff := cmp.Diff(tc.code, appErr.StatusCode); diff != "" {
+				t.Errorf("status code mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOIDCAccountManagerUserFromIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestOIDCAccountManager(t, key)
+
+	user, err := m.UserFromIDToken(newTestToken(t, key, testKeyID, testClaims()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("johndoe", user.Username()); diff != "" {
+		t.Errorf("username mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := m.UserFromIDToken("foo"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestNewOIDCAccountManagerRequiresEmailDomains(t *testing.T) {
+	_, err := NewOIDCAccountManager(OIDCConfig{
+		Issuer:    "https://issuer.example.com",
+		Audiences: []string{"cloud-orchestrator"},
+		JWKSURL:   "https://issuer.example.com/jwks",
+	})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accounts
+
+// Roles grant permissions over every user's resources, unlike host access control lists.
+type Role string
+
+const (
+	// Users may only act on their own resources and the hosts shared with them.
+	UserRole Role = "user"
+	// Auditors may also list the hosts of every user.
+	AuditorRole Role = "auditor"
+	// Admins may also delete any host and revoke the credentials of any user.
+	AdminRole Role = "admin"
+)
+
+func (r Role) Valid() bool {
+	return r == UserRole || r == AuditorRole || r == AdminRole
+}
+
+// Whether the role grants at least the permissions granted by the other role.
+func (r Role) Includes(other Role) bool {
+	switch r {
+	case AdminRole:
+		return true
+	case AuditorRole:
+		return other == AuditorRole || other == UserRole
+	default:
+		return other == UserRole
+	}
+}
+
+// Whether the account manager authenticates the users it identifies. Roles other than the user role
+// are never granted by account managers that trust the username sent by the client.
+func (c *Config) AuthenticatesUsers() bool {
+	return c.Type != UsernameOnlyAMType && c.Type != UnixAMType
+}
+
+// Returns the role granted to the user by the configuration, empty if none.
+func (c *Config) Role(username string) Role {
+	for _, u := range c.Admins {
+		if u == username {
+			return AdminRole
+		}
+	}
+	for _, u := range c.Auditors {
+		if u == username {
+			return AuditorRole
+		}
+	}
+	return ""
+}
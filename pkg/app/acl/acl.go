@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Role string
+
+const (
+	// Viewers may list the host, connect to its devices and send GET requests to it.
+	ViewerRole Role = "viewer"
+	// Editors may also create and delete CVDs and delete the host.
+	EditorRole Role = "editor"
+)
+
+func (r Role) Valid() bool {
+	return r == ViewerRole || r == EditorRole
+}
+
+// Whether the role grants at least the access granted by the other role.
+func (r Role) Includes(other Role) bool {
+	return r == EditorRole || r == other
+}
+
+const (
+	userPrincipalPrefix  = "user:"
+	groupPrincipalPrefix = "group:"
+)
+
+// Principals are either `user:<username>` or `group:<group name>`.
+func UserPrincipal(username string) string {
+	return userPrincipalPrefix + username
+}
+
+func GroupPrincipal(group string) string {
+	return groupPrincipalPrefix + group
+}
+
+func ValidatePrincipal(p string) error {
+	for _, prefix := range []string{userPrincipalPrefix, groupPrincipalPrefix} {
+		if strings.HasPrefix(p, prefix) && len(p) > len(prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid principal %q, expected user:<username> or group:<group name>", p)
+}
+
+type Entry struct {
+	Principal string
+	Role      Role
+}
+
+// Access to a host granted by its owner to other users and groups.
+type HostACL struct {
+	Zone    string
+	Host    string
+	Owner   string
+	Entries []Entry
+}
+
+// Returns the highest role granted to any of the given principals, false if none is granted.
+func (a *HostACL) RoleOf(principals []string) (Role, bool) {
+	var res Role
+	for _, e := range a.Entries {
+		for _, p := range principals {
+			if e.Principal == p && (res == "" || e.Role.Includes(res)) {
+				res = e.Role
+			}
+		}
+	}
+	return res, res != ""
+}
+
+// Selects the ACLs of the hosts in the zone granting access to any of the principals.
+type Filter struct {
+	Zone       string
+	Principals []string
+}
+
+func (f *Filter) Matches(a *HostACL) bool {
+	if f.Zone != "" && f.Zone != a.Zone {
+		return false
+	}
+	_, ok := a.RoleOf(f.Principals)
+	return ok
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Identities are used as usernames, they start with this prefix so they never collide with the
+// usernames of human users, which the account managers refuse if they start with it.
+const IdentityPrefix = "svc-"
+
+// Identities end up in the `created_by` host labels, so they follow the GCE label value
+// restrictions.
+var identityRe = regexp.MustCompile(`^` + IdentityPrefix + `[a-z0-9_-]{1,59}$`)
+
+func ValidateIdentity(identity string) error {
+	if !identityRe.MatchString(identity) {
+		return fmt.Errorf("invalid identity %q, it must start with %q followed by up to 59 lowercase letters, digits, '_' or '-'", identity, IdentityPrefix)
+	}
+	return nil
+}
+
+// Whether the username belongs to the namespace reserved for service identities.
+func IsServiceIdentity(username string) bool {
+	return strings.HasPrefix(username, IdentityPrefix)
+}
+
+// A key authenticating requests as a service identity. Only a hash of the secret is stored, the
+// secret itself is returned once when the key is created.
+type Key struct {
+	// Unique identifier of the key, it's also the first part of the secret.
+	ID string
+	// Description chosen by the admin who created the key, i.e: "presubmit bot".
+	Name string
+	// The username of the requests authenticated with this key.
+	Identity string
+	// SHA-256 hash of the secret.
+	SecretHash []byte
+	// The admin who created the key.
+	CreatedBy  string
+	CreateTime time.Time
+	// The key never expires if zero.
+	ExpireTime time.Time
+}
+
+func (k *Key) Expired(now time.Time) bool {
+	return !k.ExpireTime.IsZero() && !now.Before(k.ExpireTime)
+}
+
+// Whether the secret belongs to this key. The comparison takes constant time.
+func (k *Key) Verify(secret string) bool {
+	hash := hashSecret(secret)
+	return subtle.ConstantTimeCompare(hash, k.SecretHash) == 1
+}
+
+// Creates a new key returning it along with its secret. The key never expires if ttl is zero.
+func New(name, identity, createdBy string, ttl time.Duration, now time.Time) (*Key, string, error) {
+	if err := ValidateIdentity(identity); err != nil {
+		return nil, "", err
+	}
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate key id: %w", err)
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate key secret: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+	secret := id + "." + base64.RawURLEncoding.EncodeToString(secretBytes)
+	k := &Key{
+		ID:         id,
+		Name:       name,
+		Identity:   identity,
+		SecretHash: hashSecret(secret),
+		CreatedBy:  createdBy,
+		CreateTime: now,
+	}
+	if ttl > 0 {
+		k.ExpireTime = now.Add(ttl)
+	}
+	return k, secret, nil
+}
+
+// Returns the id of the key the secret belongs to.
+func ParseID(secret string) (string, error) {
+	id, _, ok := strings.Cut(secret, ".")
+	if !ok || id == "" {
+		return "", fmt.Errorf("malformed api key")
+	}
+	return id, nil
+}
+
+func hashSecret(secret string) []byte {
+	hash := sha256.Sum256([]byte(secret))
+	return hash[:]
+}
@@ -26,9 +26,13 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
 	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/acl"
+	"github.com/google/cloud-android-orchestration/pkg/app/apikey"
 	"github.com/google/cloud-android-orchestration/pkg/app/config"
 	"github.com/google/cloud-android-orchestration/pkg/app/database"
 	"github.com/google/cloud-android-orchestration/pkg/app/encryption"
@@ -60,6 +64,7 @@ type App struct {
 	corsAllowedOrigins       []string
 	infraConfig              apiv1.InfraConfig
 	config                   *config.Config
+	hostAccess               *hostAccessCache
 }
 
 func NewApp(
@@ -72,7 +77,7 @@ func NewApp(
 	corsAllowedOrigins []string,
 	webRTCConfig config.WebRTCConfig,
 	config *config.Config) *App {
-	return &App{im, am, oc, es, dbs, webStaticFilesPath, corsAllowedOrigins, buildInfraCfg(webRTCConfig.STUNServers), config}
+	return &App{im, am, oc, es, dbs, webStaticFilesPath, corsAllowedOrigins, buildInfraCfg(webRTCConfig.STUNServers), config, newHostAccessCache()}
 }
 
 func (c *App) AddCorsHeaderIfNeeded(w http.ResponseWriter, r *http.Request) {
@@ -105,7 +110,25 @@ func (c *App) Handler() http.Handler {
 	// data on success, such as `Delete`, response will be empty. If the original method is standard
 	// `Get`/`Create`/`Update`, the response should be the relevant resource.
 	router.Handle("/v1/zones/{zone}/operations/{operation}/:wait", c.Authenticate(c.waitOperation)).Methods("POST")
+	// Lists the operations started by the user, optionally filtered by `type` and `state`.
+	router.Handle("/v1/zones/{zone}/operations", c.Authenticate(c.listOperations)).Methods("GET")
+	// Requests the cancellation of an operation that is not done yet. Waiting on a cancelled operation returns
+	// an error.
+	router.Handle("/v1/zones/{zone}/operations/{operation}/:cancel", c.Authenticate(c.cancelOperation)).Methods("POST")
+	router.Handle("/v1/zones/{zone}/hosts/{host}", c.Authenticate(c.getHost)).Methods("GET")
 	router.Handle("/v1/zones/{zone}/hosts/{host}", c.Authenticate(c.deleteHost)).Methods("DELETE")
+	// Sets the expiration time of the host to the given time to live from now.
+	router.Handle("/v1/zones/{zone}/hosts/{host}/:extend", c.Authenticate(c.extendHost)).Methods("POST")
+	// Replaces the user labels of the host.
+	router.Handle("/v1/zones/{zone}/hosts/{host}/:setLabels", c.Authenticate(c.setHostLabels)).Methods("POST")
+	// Stopped and suspended hosts keep their disk, they can be started again later.
+	router.Handle("/v1/zones/{zone}/hosts/{host}/:stop", c.Authenticate(c.stopHost)).Methods("POST")
+	router.Handle("/v1/zones/{zone}/hosts/{host}/:start", c.Authenticate(c.startHost)).Methods("POST")
+	router.Handle("/v1/zones/{zone}/hosts/{host}/:suspend", c.Authenticate(c.suspendHost)).Methods("POST")
+	// Hosts are shared with other users and groups through their access control list, only the owner
+	// may change it.
+	router.Handle("/v1/zones/{zone}/hosts/{host}/acl", c.Authenticate(c.getHostACL)).Methods("GET")
+	router.Handle("/v1/zones/{zone}/hosts/{host}/acl", c.Authenticate(c.setHostACL)).Methods("PUT")
 
 	// Infra route
 	router.HandleFunc("/v1/zones/{zone}/hosts/{host}/infra_config", func(w http.ResponseWriter, r *http.Request) {
@@ -122,6 +145,22 @@ func (c *App) Handler() http.Handler {
 	router.Handle("/deauth", c.Authenticate(c.DeAuthHandler)).Methods("GET")
 	router.Handle("/deauth", c.Authenticate(c.RescindAuthorizationHandler)).Methods("POST")
 	router.Handle("/v1/config", c.Authenticate(c.ConfigHandler)).Methods("GET")
+	router.Handle("/v1/quota", c.Authenticate(c.getQuota)).Methods("GET")
+
+	// Admin routes
+	// Lists the hosts of every user across all zones.
+	router.Handle("/v1/admin/hosts", c.Authorize(accounts.AuditorRole, c.listAllHosts)).Methods("GET")
+	// Deletes a host regardless of its owner.
+	router.Handle("/v1/admin/zones/{zone}/hosts/{host}", c.Authorize(accounts.AdminRole, c.forceDeleteHost)).Methods("DELETE")
+	// Revokes and deletes the Build API credentials stored for the user.
+	router.Handle("/v1/admin/users/{user}/credentials", c.Authorize(accounts.AdminRole, c.revokeUserCredentials)).Methods("DELETE")
+	// Roles granted by the configuration can't be changed.
+	router.Handle("/v1/admin/users/{user}/role", c.Authorize(accounts.AdminRole, c.setUserRole)).Methods("PUT")
+	// API keys authenticating service accounts, the secret is only returned when the key is created.
+	router.Handle("/v1/admin/apikeys", c.Authorize(accounts.AdminRole, c.createAPIKey)).Methods("POST")
+	router.Handle("/v1/admin/apikeys", c.Authorize(accounts.AuditorRole, c.listAPIKeys)).Methods("GET")
+	router.Handle("/v1/admin/apikeys/{apikey}/:expire", c.Authorize(accounts.AdminRole, c.expireAPIKey)).Methods("POST")
+	router.Handle("/v1/admin/apikeys/{apikey}", c.Authorize(accounts.AdminRole, c.revokeAPIKey)).Methods("DELETE")
 	router.Handle("/", c.Authenticate(indexHandler))
 
 	if c.config.AccountManager.Type == accounts.UsernameOnlyAMType {
@@ -147,14 +186,19 @@ func (a *App) InfraConfig() apiv1.InfraConfig {
 	return a.infraConfig
 }
 
-const (
-	headerNameCOInjectBuildAPICreds = "X-Cutf-Cloud-Orchestrator-Inject-BuildAPI-Creds"
-	headerNameHOBuildAPICreds       = "X-Cutf-Host-Orchestrator-BuildAPI-Creds"
-)
+const headerNameCOInjectBuildAPICreds = "X-Cutf-Cloud-Orchestrator-Inject-BuildAPI-Creds"
 
 func (a *App) ForwardToHost(w http.ResponseWriter, r *http.Request, user accounts.User) error {
 	hostPath := "/" + mux.Vars(r)["hostPath"]
 
+	access, err := a.userHostAccess(getZone(r), getHost(r), user)
+	if err != nil {
+		return err
+	}
+	if err := access.check(getHost(r), hostPathRole(r.Method, hostPath)); err != nil {
+		return err
+	}
+
 	if interceptFile, found := a.findInterceptFile(hostPath); found {
 		http.ServeFile(w, r, interceptFile)
 		return nil
@@ -190,7 +234,12 @@ func (a *App) injectBuildAPICredsIntoRequest(r *http.Request, user accounts.User
 		return apperr.NewUnauthenticatedError(
 			"The user must authorize the system to access the Build API on their behalf", nil)
 	}
-	r.Header.Set(headerNameHOBuildAPICreds, tk.AccessToken)
+	header := appOAuth2.DefaultHostOrchestratorHeader
+	if a.oauth2Helper != nil {
+		// Providers other than Google may require a different header.
+		header = a.oauth2Helper.HostOrchestratorHeader
+	}
+	r.Header.Set(header, tk.AccessToken)
 	return nil
 }
 
@@ -217,6 +266,7 @@ func (c *App) createHost(w http.ResponseWriter, r *http.Request, user accounts.U
 	return nil
 }
 
+// Hosts shared with the user are listed after the ones owned by the user, in the first page only.
 func (c *App) listHosts(w http.ResponseWriter, r *http.Request, user accounts.User) error {
 	listReq, err := BuildListHostsRequest(r)
 	if err != nil {
@@ -226,20 +276,395 @@ func (c *App) listHosts(w http.ResponseWriter, r *http.Request, user accounts.Us
 	if err != nil {
 		return err
 	}
+	if listReq.PageToken == "" {
+		shared, err := c.listSharedHosts(getZone(r), user, listReq)
+		if err != nil {
+			return err
+		}
+		res.Items = append(res.Items, shared...)
+	}
+	replyJSON(w, res, http.StatusOK)
+	return nil
+}
+
+func (c *App) listSharedHosts(zone string, user accounts.User, req *instances.ListHostsRequest) ([]*apiv1.HostInstance, error) {
+	acls, err := c.databaseService.ListHostACLs(acl.Filter{Zone: zone, Principals: userPrincipals(user)})
+	if err != nil {
+		return nil, err
+	}
+	res := []*apiv1.HostInstance{}
+	for _, a := range acls {
+		if a.Owner == user.Username() {
+			continue
+		}
+		host, err := c.instanceManager.GetHost(zone, namedUser(a.Owner), a.Host)
+		if err != nil {
+			var appErr *apperr.AppError
+			if errors.As(err, &appErr) && appErr.StatusCode == http.StatusNotFound {
+				// The host was deleted by other means, i.e: it expired.
+				continue
+			}
+			return nil, err
+		}
+		if instances.MatchesLabelSelector(host.Labels, req.LabelSelector) {
+			res = append(res, host)
+		}
+	}
+	return res, nil
+}
+
+func (c *App) getHost(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	owner, err := c.sharedHostOwner(getZone(r), getHost(r), user, acl.ViewerRole)
+	if err != nil {
+		return err
+	}
+	if owner == nil {
+		owner = user
+	}
+	res, err := c.instanceManager.GetHost(getZone(r), owner, getHost(r))
+	if err != nil {
+		return err
+	}
 	replyJSON(w, res, http.StatusOK)
 	return nil
 }
 
 func (c *App) deleteHost(w http.ResponseWriter, r *http.Request, user accounts.User) error {
 	name := mux.Vars(r)["host"]
-	res, err := c.instanceManager.DeleteHost(getZone(r), user, name)
+	owner, err := c.sharedHostOwner(getZone(r), name, user, acl.EditorRole)
+	if err != nil {
+		return err
+	}
+	if owner == nil {
+		owner = user
+	}
+	res, err := c.instanceManager.DeleteHost(getZone(r), owner, name)
+	if err != nil {
+		return err
+	}
+	replyJSON(w, res, http.StatusOK)
+	return nil
+}
+
+func (c *App) extendHost(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	var msg apiv1.ExtendHostRequest
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		return apperr.NewBadRequestError("Malformed JSON in request", err)
+	}
+	res, err := c.instanceManager.ExtendHost(getZone(r), user, getHost(r), &msg)
+	if err != nil {
+		return err
+	}
+	replyJSON(w, res, http.StatusOK)
+	return nil
+}
+
+func (c *App) setHostLabels(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	var msg apiv1.SetHostLabelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		return apperr.NewBadRequestError("Malformed JSON in request", err)
+	}
+	res, err := c.instanceManager.SetHostLabels(getZone(r), user, getHost(r), &msg)
+	if err != nil {
+		return err
+	}
+	replyJSON(w, res, http.StatusOK)
+	return nil
+}
+
+func (c *App) stopHost(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	op, err := c.instanceManager.StopHost(getZone(r), user, getHost(r))
+	if err != nil {
+		return err
+	}
+	replyJSON(w, op, http.StatusOK)
+	return nil
+}
+
+func (c *App) startHost(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	op, err := c.instanceManager.StartHost(getZone(r), user, getHost(r))
+	if err != nil {
+		return err
+	}
+	replyJSON(w, op, http.StatusOK)
+	return nil
+}
+
+func (c *App) suspendHost(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	op, err := c.instanceManager.SuspendHost(getZone(r), user, getHost(r))
+	if err != nil {
+		return err
+	}
+	replyJSON(w, op, http.StatusOK)
+	return nil
+}
+
+func (c *App) getHostACL(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	owner, err := c.sharedHostOwner(getZone(r), getHost(r), user, acl.ViewerRole)
 	if err != nil {
 		return err
 	}
+	if owner == nil {
+		if _, err := c.instanceManager.GetHost(getZone(r), user, getHost(r)); err != nil {
+			return err
+		}
+		owner = user
+	}
+	hostACL, err := c.databaseService.FetchHostACL(getZone(r), getHost(r))
+	if err != nil {
+		return err
+	}
+	res := &apiv1.HostACL{Owner: owner.Username(), Entries: []*apiv1.HostACLEntry{}}
+	if hostACL != nil {
+		for _, e := range hostACL.Entries {
+			res.Entries = append(res.Entries, &apiv1.HostACLEntry{Principal: e.Principal, Role: string(e.Role)})
+		}
+	}
 	replyJSON(w, res, http.StatusOK)
 	return nil
 }
 
+func (c *App) setHostACL(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	var msg apiv1.HostACL
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		return apperr.NewBadRequestError("Malformed JSON in request", err)
+	}
+	hostACL, err := buildHostACL(getZone(r), getHost(r), user, &msg)
+	if err != nil {
+		return err
+	}
+	// Users the host is shared with, even editors, may not change who else has access to it.
+	owner, err := c.sharedHostOwner(getZone(r), getHost(r), user, acl.ViewerRole)
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		return apperr.NewForbiddenError("Only the owner of the host may change its access control list", nil)
+	}
+	if _, err := c.instanceManager.GetHost(getZone(r), user, getHost(r)); err != nil {
+		return err
+	}
+	if len(hostACL.Entries) == 0 {
+		err = c.databaseService.DeleteHostACL(hostACL.Zone, hostACL.Host)
+	} else {
+		err = c.databaseService.StoreHostACL(*hostACL)
+	}
+	if err != nil {
+		return err
+	}
+	c.hostAccess.invalidate(hostACL.Zone, hostACL.Host)
+	msg.Owner = user.Username()
+	if msg.Entries == nil {
+		msg.Entries = []*apiv1.HostACLEntry{}
+	}
+	replyJSON(w, msg, http.StatusOK)
+	return nil
+}
+
+func buildHostACL(zone, host string, user accounts.User, msg *apiv1.HostACL) (*acl.HostACL, error) {
+	res := &acl.HostACL{Zone: zone, Host: host, Owner: user.Username()}
+	seen := make(map[string]bool)
+	for _, e := range msg.Entries {
+		if err := acl.ValidatePrincipal(e.Principal); err != nil {
+			return nil, apperr.NewBadRequestError(err.Error(), nil)
+		}
+		if !acl.Role(e.Role).Valid() {
+			return nil, apperr.NewBadRequestError(fmt.Sprintf("Invalid role %q, expected viewer or editor", e.Role), nil)
+		}
+		if seen[e.Principal] {
+			return nil, apperr.NewBadRequestError(fmt.Sprintf("Duplicate principal %q", e.Principal), nil)
+		}
+		seen[e.Principal] = true
+		res.Entries = append(res.Entries, acl.Entry{Principal: e.Principal, Role: acl.Role(e.Role)})
+	}
+	return res, nil
+}
+
+// Returns the owner of the host if it's shared with the user, nil if it isn't shared with them, in
+// which case only the owner may act on it. Fails if the host is shared with the user with a role
+// not including the required one.
+func (c *App) sharedHostOwner(zone, host string, user accounts.User, role acl.Role) (accounts.User, error) {
+	hostACL, err := c.databaseService.FetchHostACL(zone, host)
+	if err != nil {
+		return nil, err
+	}
+	if hostACL == nil || hostACL.Owner == user.Username() {
+		return nil, nil
+	}
+	granted, ok := hostACL.RoleOf(userPrincipals(user))
+	if !ok {
+		return nil, nil
+	}
+	if !granted.Includes(role) {
+		return nil, apperr.NewForbiddenError(
+			fmt.Sprintf("The %s role is required on host %q, only %s granted", role, host, granted), nil)
+	}
+	return ownerDelegate{namedUser: namedUser(hostACL.Owner), actor: user}, nil
+}
+
+// How long the access of users to hosts is cached, it's checked on every request proxied to a host.
+const hostAccessCacheTTL = 30 * time.Second
+
+// Access of a user to a host, either as its owner or through the host ACL.
+type hostAccess struct {
+	// Nil if the user owns the host.
+	owner   accounts.User
+	granted acl.Role
+	expires time.Time
+}
+
+// Fails if the host is shared with the user with a role not including the required one.
+func (h *hostAccess) check(host string, role acl.Role) error {
+	if h.owner == nil || h.granted.Includes(role) {
+		return nil
+	}
+	return apperr.NewForbiddenError(
+		fmt.Sprintf("The %s role is required on host %q, only %s granted", role, host, h.granted), nil)
+}
+
+type hostAccessCache struct {
+	mtx sync.Mutex
+	// Keyed by zone and host, then by username.
+	entries map[string]map[string]*hostAccess
+	// When expired entries were last evicted.
+	sweptAt time.Time
+	now     func() time.Time
+}
+
+func newHostAccessCache() *hostAccessCache {
+	return &hostAccessCache{entries: make(map[string]map[string]*hostAccess), now: time.Now}
+}
+
+func hostAccessKey(zone, host string) string {
+	return zone + "/" + host
+}
+
+// Returns nil if the access isn't cached or it expired.
+func (c *hostAccessCache) get(zone, host, username string) *hostAccess {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	h, ok := c.entries[hostAccessKey(zone, host)][username]
+	if !ok || !c.now().Before(h.expires) {
+		return nil
+	}
+	return h
+}
+
+// Expired entries are evicted at most once per `hostAccessCacheTTL`, when new ones are added.
+func (c *hostAccessCache) put(zone, host, username string, h *hostAccess) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	now := c.now()
+	if !now.Before(c.sweptAt.Add(hostAccessCacheTTL)) {
+		c.sweepLocked(now)
+	}
+	h.expires = now.Add(hostAccessCacheTTL)
+	key := hostAccessKey(zone, host)
+	users, ok := c.entries[key]
+	if !ok {
+		users = make(map[string]*hostAccess)
+		c.entries[key] = users
+	}
+	users[username] = h
+}
+
+func (c *hostAccessCache) sweepLocked(now time.Time) {
+	for key, users := range c.entries {
+		for username, h := range users {
+			if !now.Before(h.expires) {
+				delete(users, username)
+			}
+		}
+		if len(users) == 0 {
+			delete(c.entries, key)
+		}
+	}
+	c.sweptAt = now
+}
+
+// Forgets the access of every user to the host, i.e: after its ACL changes.
+func (c *hostAccessCache) invalidate(zone, host string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.entries, hostAccessKey(zone, host))
+}
+
+// Hosts the user neither owns nor has been granted access to are reported as not found. Changes of
+// the host ACL made through this replica are enforced right away, the ones made through other
+// replicas take up to `hostAccessCacheTTL`.
+func (c *App) userHostAccess(zone, host string, user accounts.User) (*hostAccess, error) {
+	if h := c.hostAccess.get(zone, host, user.Username()); h != nil {
+		return h, nil
+	}
+	h, err := c.fetchUserHostAccess(zone, host, user)
+	if err != nil {
+		return nil, err
+	}
+	c.hostAccess.put(zone, host, user.Username(), h)
+	return h, nil
+}
+
+// The owner is checked first, the host knows its owner so the ACL is only fetched for other users.
+func (c *App) fetchUserHostAccess(zone, host string, user accounts.User) (*hostAccess, error) {
+	_, err := c.instanceManager.GetHost(zone, user, host)
+	if err == nil {
+		return &hostAccess{}, nil
+	}
+	var appErr *apperr.AppError
+	if !errors.As(err, &appErr) || appErr.StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+	hostACL, aclErr := c.databaseService.FetchHostACL(zone, host)
+	if aclErr != nil {
+		return nil, aclErr
+	}
+	if hostACL == nil {
+		return nil, err
+	}
+	granted, ok := hostACL.RoleOf(userPrincipals(user))
+	if !ok {
+		return nil, err
+	}
+	return &hostAccess{owner: namedUser(hostACL.Owner), granted: granted}, nil
+}
+
+// The principals identifying the user and the groups they belong to.
+func userPrincipals(user accounts.User) []string {
+	res := []string{acl.UserPrincipal(user.Username())}
+	if m, ok := user.(accounts.GroupMember); ok {
+		for _, g := range m.Groups() {
+			res = append(res, acl.GroupPrincipal(g))
+		}
+	}
+	return res
+}
+
+// Viewers may send GET requests to the host orchestrator and connect to devices, the rest of the
+// requests require the editor role.
+func hostPathRole(method, hostPath string) acl.Role {
+	if method == http.MethodGet || method == http.MethodHead || strings.HasPrefix(hostPath, "/polled_connections") {
+		return acl.ViewerRole
+	}
+	return acl.EditorRole
+}
+
+// A user known only by name, i.e: the owner of a shared host. Instance managers only let owners act
+// on their hosts, users a host is shared with act on behalf of its owner.
+type namedUser string
+
+func (u namedUser) Username() string { return string(u) }
+
+func (u namedUser) Email() string { return "" }
+
+// The owner of a shared host as seen by instance managers when a user the host is shared with acts
+// on it, the operations started this way are recorded as started by the acting user.
+type ownerDelegate struct {
+	namedUser
+	actor accounts.User
+}
+
+func (u ownerDelegate) Actor() accounts.User { return u.actor }
+
 func (c *App) waitOperation(w http.ResponseWriter, r *http.Request, user accounts.User) error {
 	name := mux.Vars(r)["operation"]
 	op, err := c.instanceManager.WaitOperation(getZone(r), user, name)
@@ -250,6 +675,212 @@ func (c *App) waitOperation(w http.ResponseWriter, r *http.Request, user account
 	return nil
 }
 
+// Auditors and admins may list the operations of other users with the `user` query parameter.
+func (c *App) listOperations(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	if u := r.URL.Query().Get("user"); u != "" && u != user.Username() {
+		role, err := c.userRole(user)
+		if err != nil {
+			return err
+		}
+		if !role.Includes(accounts.AuditorRole) {
+			return apperr.NewForbiddenError("Listing operations of other users is not allowed", nil)
+		}
+		user = namedUser(u)
+	}
+	listReq, err := BuildListOperationsRequest(r)
+	if err != nil {
+		return err
+	}
+	res, err := c.instanceManager.ListOperations(getZone(r), user, listReq)
+	if err != nil {
+		return err
+	}
+	replyJSON(w, res, http.StatusOK)
+	return nil
+}
+
+func (c *App) cancelOperation(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	name := mux.Vars(r)["operation"]
+	op, err := c.instanceManager.CancelOperation(getZone(r), user, name)
+	if err != nil {
+		return err
+	}
+	replyJSON(w, op, http.StatusOK)
+	return nil
+}
+
+func (c *App) getQuota(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	res, err := instances.GetQuota(c.instanceManager, user)
+	if err != nil {
+		return err
+	}
+	replyJSON(w, res, http.StatusOK)
+	return nil
+}
+
+// Hosts are listed in every zone, the page size and token query parameters are ignored.
+func (c *App) listAllHosts(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	listReq, err := BuildListHostsRequest(r)
+	if err != nil {
+		return err
+	}
+	res := &apiv1.ListHostsResponse{Items: []*apiv1.HostInstance{}}
+	req := &instances.ListHostsRequest{LabelSelector: listReq.LabelSelector}
+	for {
+		page, err := c.instanceManager.ListAllHosts(req)
+		if err != nil {
+			return err
+		}
+		res.Items = append(res.Items, page.Items...)
+		if page.NextPageToken == "" {
+			break
+		}
+		req.PageToken = page.NextPageToken
+	}
+	replyJSON(w, res, http.StatusOK)
+	return nil
+}
+
+func (c *App) forceDeleteHost(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	res, err := c.instanceManager.ForceDeleteHost(getZone(r), user, getHost(r))
+	if err != nil {
+		return err
+	}
+	log.Printf("Host %q in zone %q deleted by admin %q", getHost(r), getZone(r), user.Username())
+	replyJSON(w, res, http.StatusOK)
+	return nil
+}
+
+func (c *App) revokeUserCredentials(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	username := mux.Vars(r)["user"]
+	tk, err := c.fetchUserCredentials(namedUser(username))
+	if err != nil {
+		// Credentials that can't be read are deleted anyway.
+		log.Printf("Failed to fetch credentials of user %q: %v", username, err)
+	}
+	if tk != nil {
+		if err := c.oauth2Helper.Revoke(tk); err != nil {
+			log.Printf("Failed to revoke credentials of user %q: %v", username, err)
+		}
+	}
+	if err := c.databaseService.DeleteBuildAPICredentials(username); err != nil {
+		return err
+	}
+	log.Printf("Credentials of user %q revoked by admin %q", username, user.Username())
+	replyJSON(w, struct{}{}, http.StatusOK)
+	return nil
+}
+
+func (c *App) setUserRole(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	var msg apiv1.UserRole
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		return apperr.NewBadRequestError("Malformed JSON in request", err)
+	}
+	if !accounts.Role(msg.Role).Valid() {
+		return apperr.NewBadRequestError(fmt.Sprintf("Invalid role %q, expected user, auditor or admin", msg.Role), nil)
+	}
+	username := mux.Vars(r)["user"]
+	if c.config.AccountManager.Role(username) != "" {
+		return apperr.NewBadRequestError(fmt.Sprintf("The role of user %q is set in the configuration", username), nil)
+	}
+	if err := c.databaseService.StoreUserRole(username, msg.Role); err != nil {
+		return err
+	}
+	replyJSON(w, msg, http.StatusOK)
+	return nil
+}
+
+func (c *App) createAPIKey(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	var msg apiv1.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		return apperr.NewBadRequestError("Malformed JSON in request", err)
+	}
+	if msg.TTLSeconds < 0 {
+		return apperr.NewBadRequestError(fmt.Sprintf("Invalid ttl: %d", msg.TTLSeconds), nil)
+	}
+	ttl := time.Duration(msg.TTLSeconds) * time.Second
+	k, secret, err := apikey.New(msg.Name, msg.Identity, user.Username(), ttl, time.Now())
+	if err != nil {
+		return apperr.NewBadRequestError(err.Error(), err)
+	}
+	if err := c.databaseService.StoreAPIKey(*k); err != nil {
+		return err
+	}
+	log.Printf("API key %q for identity %q created by admin %q", k.ID, k.Identity, user.Username())
+	res := buildAPIKey(k)
+	res.Key = secret
+	replyJSON(w, res, http.StatusOK)
+	return nil
+}
+
+func (c *App) listAPIKeys(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	keys, err := c.databaseService.ListAPIKeys()
+	if err != nil {
+		return err
+	}
+	res := &apiv1.ListAPIKeysResponse{Items: []*apiv1.APIKey{}}
+	for _, k := range keys {
+		res.Items = append(res.Items, buildAPIKey(k))
+	}
+	replyJSON(w, res, http.StatusOK)
+	return nil
+}
+
+// Expired keys are kept so they remain listed, unlike revoked ones.
+func (c *App) expireAPIKey(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	k, err := c.fetchAPIKey(mux.Vars(r)["apikey"])
+	if err != nil {
+		return err
+	}
+	if now := time.Now(); !k.Expired(now) {
+		k.ExpireTime = now
+		if err := c.databaseService.StoreAPIKey(*k); err != nil {
+			return err
+		}
+	}
+	log.Printf("API key %q expired by admin %q", k.ID, user.Username())
+	replyJSON(w, buildAPIKey(k), http.StatusOK)
+	return nil
+}
+
+func (c *App) revokeAPIKey(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+	k, err := c.fetchAPIKey(mux.Vars(r)["apikey"])
+	if err != nil {
+		return err
+	}
+	if err := c.databaseService.DeleteAPIKey(k.ID); err != nil {
+		return err
+	}
+	log.Printf("API key %q revoked by admin %q", k.ID, user.Username())
+	replyJSON(w, struct{}{}, http.StatusOK)
+	return nil
+}
+
+func (c *App) fetchAPIKey(id string) (*apikey.Key, error) {
+	k, err := c.databaseService.FetchAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return nil, apperr.NewNotFoundError(fmt.Sprintf("API key %q not found", id), nil)
+	}
+	return k, nil
+}
+
+func buildAPIKey(k *apikey.Key) *apiv1.APIKey {
+	res := &apiv1.APIKey{
+		ID:         k.ID,
+		Name:       k.Name,
+		Identity:   k.Identity,
+		CreatedBy:  k.CreatedBy,
+		CreateTime: k.CreateTime.Format(time.RFC3339),
+	}
+	if !k.ExpireTime.IsZero() {
+		res.ExpireTime = k.ExpireTime.Format(time.RFC3339)
+	}
+	return res
+}
+
 func (c *App) AuthHandler(w http.ResponseWriter, r *http.Request) error {
 	state := randomHexString()
 	s := session.Session{
@@ -302,7 +933,7 @@ func (c *App) OAuth2Callback(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return fmt.Errorf("invalid token: %w", err)
 	}
-	user, err := c.accountManager.UserFromRequest(r)
+	user, err := c.callbackUser(r, idToken.Raw)
 	if err != nil {
 		return err
 	}
@@ -318,6 +949,26 @@ func (c *App) OAuth2Callback(w http.ResponseWriter, r *http.Request) error {
 	return err
 }
 
+// The user is taken from the ID token when the callback request carries no credentials, i.e: it's a
+// browser redirect and the account manager expects a bearer token.
+func (c *App) callbackUser(r *http.Request, idToken string) (accounts.User, error) {
+	user, err := c.accountManager.UserFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		if v, ok := c.accountManager.(accounts.IDTokenVerifier); ok {
+			if user, err = v.UserFromIDToken(idToken); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if user == nil {
+		return nil, apperr.NewUnauthenticatedError("Authentication required", nil)
+	}
+	return user, nil
+}
+
 // Extracts the authorization code and state from the authorization provider's response.
 func (c *App) parseAuthorizationResponse(r *http.Request) (string, error) {
 	query := r.URL.Query()
@@ -427,6 +1078,8 @@ func (a *App) ConfigHandler(w http.ResponseWriter, r *http.Request, user account
 	return nil
 }
 
+// The session cookie is only marked Secure when the orchestrator serves TLS itself, browsers
+// wouldn't send it back over plain HTTP otherwise.
 func (a *App) setOrUpdateSession(w http.ResponseWriter, s *session.Session) error {
 	if s.Key == "" {
 		s.Key = randomHexString()
@@ -437,7 +1090,8 @@ func (a *App) setOrUpdateSession(w http.ResponseWriter, s *session.Session) erro
 	http.SetCookie(w, &http.Cookie{
 		Name:     sessionIdCookie,
 		Value:    s.Key,
-		Secure:   false,
+		Secure:   a.config.TLS.Enabled(),
+		HttpOnly: a.config.TLS.Enabled(),
 		SameSite: http.SameSiteLaxMode,
 	})
 	return nil
@@ -535,6 +1189,40 @@ func (a *App) Authenticate(fn AuthHTTPHandler) HTTPHandler {
 	}
 }
 
+// Like Authenticate, it also checks the user has been granted at least the given role.
+func (a *App) Authorize(role accounts.Role, fn AuthHTTPHandler) HTTPHandler {
+	return a.Authenticate(func(w http.ResponseWriter, r *http.Request, user accounts.User) error {
+		granted, err := a.userRole(user)
+		if err != nil {
+			return err
+		}
+		if !granted.Includes(role) {
+			return apperr.NewForbiddenError(fmt.Sprintf("The %s role is required", role), nil)
+		}
+		return fn(w, r, user)
+	})
+}
+
+// The role granted in the configuration takes precedence over the one stored in the database,
+// users without a role have the user role.
+func (a *App) userRole(user accounts.User) (accounts.Role, error) {
+	// Anyone could claim the username of an admin.
+	if !a.config.AccountManager.AuthenticatesUsers() {
+		return accounts.UserRole, nil
+	}
+	if role := a.config.AccountManager.Role(user.Username()); role != "" {
+		return role, nil
+	}
+	role, err := a.databaseService.FetchUserRole(user.Username())
+	if err != nil {
+		return "", fmt.Errorf("error getting user role: %w", err)
+	}
+	if role == "" {
+		return accounts.UserRole, nil
+	}
+	return accounts.Role(role), nil
+}
+
 type AuthHTTPHandler func(http.ResponseWriter, *http.Request, accounts.User) error
 type HTTPHandler func(http.ResponseWriter, *http.Request) error
 
@@ -577,7 +1265,8 @@ func randomHexString() string {
 }
 
 const (
-	queryParamMaxResults = "maxResults"
+	queryParamMaxResults    = "maxResults"
+	queryParamLabelSelector = "labelSelector"
 )
 
 func BuildListHostsRequest(r *http.Request) (*instances.ListHostsRequest, error) {
@@ -586,7 +1275,28 @@ func BuildListHostsRequest(r *http.Request) (*instances.ListHostsRequest, error)
 	if err != nil {
 		return nil, newInvalidQueryParamError(queryParamMaxResults, maxResultsRaw, err)
 	}
+	selectorRaw := r.URL.Query().Get(queryParamLabelSelector)
+	selector, err := instances.ParseLabelSelector(selectorRaw)
+	if err != nil {
+		return nil, newInvalidQueryParamError(queryParamLabelSelector, selectorRaw, err)
+	}
 	res := &instances.ListHostsRequest{
+		MaxResults:    maxResults,
+		PageToken:     r.URL.Query().Get("pageToken"),
+		LabelSelector: selector,
+	}
+	return res, nil
+}
+
+func BuildListOperationsRequest(r *http.Request) (*instances.ListOperationsRequest, error) {
+	maxResultsRaw := r.URL.Query().Get(queryParamMaxResults)
+	maxResults, err := uint32Value(maxResultsRaw)
+	if err != nil {
+		return nil, newInvalidQueryParamError(queryParamMaxResults, maxResultsRaw, err)
+	}
+	res := &instances.ListOperationsRequest{
+		Type:       r.URL.Query().Get("type"),
+		State:      r.URL.Query().Get("state"),
 		MaxResults: maxResults,
 		PageToken:  r.URL.Query().Get("pageToken"),
 	}
@@ -31,15 +31,19 @@ import (
 	hoapi "github.com/google/android-cuttlefish/frontend/src/liboperator/api/v1"
 	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
 	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/acl"
 	"github.com/google/cloud-android-orchestration/pkg/app/config"
 	"github.com/google/cloud-android-orchestration/pkg/app/database"
 	"github.com/google/cloud-android-orchestration/pkg/app/encryption"
 	apperr "github.com/google/cloud-android-orchestration/pkg/app/errors"
 	"github.com/google/cloud-android-orchestration/pkg/app/instances"
 	appOAuth2 "github.com/google/cloud-android-orchestration/pkg/app/oauth2"
+	"github.com/google/cloud-android-orchestration/pkg/app/secrets"
 	"github.com/google/cloud-android-orchestration/pkg/app/session"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
 	"golang.org/x/oauth2"
 )
 
@@ -65,6 +69,8 @@ func (m *testAccountManager) OnOAuth2Exchange(w http.ResponseWriter, r *http.Req
 
 type testInstanceManager struct {
 	hostClientFactory func(zone, host string) instances.HostClient
+	// Hosts not listed here are owned by every user.
+	hostOwners map[string]string
 }
 
 func (m *testInstanceManager) GetHostURL(zone string, host string) (*url.URL, error) {
@@ -72,7 +78,7 @@ func (m *testInstanceManager) GetHostURL(zone string, host string) (*url.URL, er
 }
 
 func (m *testInstanceManager) ListZones() (*apiv1.ListZonesResponse, error) {
-	return &apiv1.ListZonesResponse{}, nil
+	return &apiv1.ListZonesResponse{Items: []*apiv1.Zone{{Name: "us-central1-a"}}}, nil
 }
 
 func (m *testInstanceManager) CreateHost(_ string, _ *apiv1.CreateHostRequest, _ accounts.User) (*apiv1.Operation, error) {
@@ -83,14 +89,64 @@ func (m *testInstanceManager) ListHosts(zone string, user accounts.User, req *in
 	return &apiv1.ListHostsResponse{}, nil
 }
 
+func (m *testInstanceManager) ListAllHosts(req *instances.ListHostsRequest) (*apiv1.ListHostsResponse, error) {
+	return &apiv1.ListHostsResponse{
+		Items: []*apiv1.HostInstance{{Name: "foo", Owner: "janedoe", Zone: "us-central1-a"}},
+	}, nil
+}
+
+func (m *testInstanceManager) GetHost(zone string, user accounts.User, host string) (*apiv1.HostInstance, error) {
+	if owner, ok := m.hostOwners[host]; ok && owner != user.Username() {
+		return nil, apperr.NewNotFoundError("host not found", nil)
+	}
+	return &apiv1.HostInstance{Name: host, Owner: user.Username()}, nil
+}
+
 func (m *testInstanceManager) DeleteHost(zone string, user accounts.User, name string) (*apiv1.Operation, error) {
 	return &apiv1.Operation{}, nil
 }
 
+func (m *testInstanceManager) ForceDeleteHost(zone string, admin accounts.User, host string) (*apiv1.Operation, error) {
+	return &apiv1.Operation{}, nil
+}
+
+func (m *testInstanceManager) StopHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	return &apiv1.Operation{}, nil
+}
+
+func (m *testInstanceManager) StartHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	return &apiv1.Operation{}, nil
+}
+
+func (m *testInstanceManager) SuspendHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	return &apiv1.Operation{}, nil
+}
+
 func (m *testInstanceManager) WaitOperation(_ string, _ accounts.User, _ string) (any, error) {
 	return struct{}{}, nil
 }
 
+func (m *testInstanceManager) ListOperations(_ string, user accounts.User, _ *instances.ListOperationsRequest) (*apiv1.ListOperationsResponse, error) {
+	op := &apiv1.Operation{Name: "foo", Metadata: &apiv1.OperationMetadata{User: user.Username()}}
+	return &apiv1.ListOperationsResponse{Items: []*apiv1.Operation{op}}, nil
+}
+
+func (m *testInstanceManager) CancelOperation(_ string, _ accounts.User, _ string) (*apiv1.Operation, error) {
+	return &apiv1.Operation{}, nil
+}
+
+func (m *testInstanceManager) ExtendHost(_ string, _ accounts.User, _ string, _ *apiv1.ExtendHostRequest) (*apiv1.HostInstance, error) {
+	return &apiv1.HostInstance{}, nil
+}
+
+func (m *testInstanceManager) SetHostLabels(_ string, _ accounts.User, _ string, _ *apiv1.SetHostLabelsRequest) (*apiv1.HostInstance, error) {
+	return &apiv1.HostInstance{}, nil
+}
+
+func (m *testInstanceManager) DeleteExpiredHosts() ([]*instances.ExpiredHost, error) {
+	return nil, nil
+}
+
 func (m *testInstanceManager) GetHostClient(zone string, host string) (instances.HostClient, error) {
 	return m.hostClientFactory(zone, host), nil
 }
@@ -152,6 +208,66 @@ func TestWaitOperatioSucceeds(t *testing.T) {
 	}
 }
 
+func TestListOperationsSucceeds(t *testing.T) {
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, nil, "", nil, config.WebRTCConfig{}, &config.Config{})
+	ts := httptest.NewServer(controller.Handler())
+	defer ts.Close()
+
+	res, _ := http.Get(ts.URL + "/v1/zones/us-central1-a/operations?type=createhost&state=RUNNING")
+
+	expected := http.StatusOK
+	if res.StatusCode != expected {
+		t.Errorf("unexpected status code <<%d>>, want: %d", res.StatusCode, expected)
+	}
+}
+
+func TestListOperationsOfOtherUserIsForbidden(t *testing.T) {
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, database.NewInMemoryDBService(), "", nil, config.WebRTCConfig{}, &config.Config{})
+	ts := httptest.NewServer(controller.Handler())
+	defer ts.Close()
+
+	res, _ := http.Get(ts.URL + "/v1/zones/us-central1-a/operations?user=janedoe")
+
+	expected := http.StatusForbidden
+	if res.StatusCode != expected {
+		t.Errorf("unexpected status code <<%d>>, want: %d", res.StatusCode, expected)
+	}
+}
+
+func TestListOperationsOfOtherUserAsAuditor(t *testing.T) {
+	cfg := &config.Config{AccountManager: accounts.Config{Auditors: []string{testUsername}}}
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, database.NewInMemoryDBService(), "", nil, config.WebRTCConfig{}, cfg)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/zones/us-central1-a/operations?user=janedoe", nil)
+
+	makeRequest(w, req, controller)
+
+	var got apiv1.ListOperationsResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := apiv1.ListOperationsResponse{
+		Items: []*apiv1.Operation{{Name: "foo", Metadata: &apiv1.OperationMetadata{User: "janedoe"}}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("response mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCancelOperationSucceeds(t *testing.T) {
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, nil, "", nil, config.WebRTCConfig{}, &config.Config{})
+	ts := httptest.NewServer(controller.Handler())
+	defer ts.Close()
+
+	res, _ := http.Post(
+		ts.URL+"/v1/zones/us-central1-a/operations/foo/:cancel", "application/json", strings.NewReader("{}"))
+
+	expected := http.StatusOK
+	if res.StatusCode != expected {
+		t.Errorf("unexpected status code <<%d>>, want: %d", res.StatusCode, expected)
+	}
+}
+
 func TestBuildListHostsRequest(t *testing.T) {
 
 	t.Run("default", func(t *testing.T) {
@@ -189,28 +305,53 @@ func TestBuildListHostsRequest(t *testing.T) {
 		}
 	})
 
+	t.Run("invalid labelSelector", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "http://abc.com/query?labelSelector=team", nil)
+
+		listReq, err := BuildListHostsRequest(r)
+
+		assertIsAppError(t, err)
+		if listReq != nil {
+			t.Errorf("expected nil, got %+v", listReq)
+		}
+	})
+
 	t.Run("full", func(t *testing.T) {
-		r, _ := http.NewRequest("GET", "http://abc.com/query?pageToken=foo&maxResults=1", nil)
+		r, _ := http.NewRequest("GET", "http://abc.com/query?pageToken=foo&maxResults=1&labelSelector=team%3Dcamera%2Cpurpose%3Dci", nil)
 
 		listReq, _ := BuildListHostsRequest(r)
 
-		expected := instances.ListHostsRequest{
-			MaxResults: 1,
-			PageToken:  "foo",
+		expected := &instances.ListHostsRequest{
+			MaxResults:    1,
+			PageToken:     "foo",
+			LabelSelector: map[string]string{"team": "camera", "purpose": "ci"},
 		}
-		if *listReq != expected {
-			t.Errorf("expected <<%+v>>, got %+v", expected, listReq)
+		if diff := cmp.Diff(expected, listReq); diff != "" {
+			t.Errorf("list hosts request mismatch (-want +got):\n%s", diff)
 		}
 	})
 }
 
+func TestGetHostSucceeds(t *testing.T) {
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, database.NewInMemoryDBService(), "", nil, config.WebRTCConfig{}, &config.Config{})
+	ts := httptest.NewServer(controller.Handler())
+	defer ts.Close()
+
+	res, _ := http.Get(ts.URL + "/v1/zones/us-central1-a/hosts/foo")
+
+	expected := http.StatusOK
+	if res.StatusCode != expected {
+		t.Errorf("unexpected status code <<%d>>, want: %d", res.StatusCode, expected)
+	}
+}
+
 func TestDeleteHostIsHandled(t *testing.T) {
 	rr := httptest.NewRecorder()
 	req, err := http.NewRequest("DELETE", "/v1/zones/foo/hosts/bar", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, nil, "", nil, config.WebRTCConfig{}, &config.Config{})
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, database.NewInMemoryDBService(), "", nil, config.WebRTCConfig{}, &config.Config{})
 
 	makeRequest(rr, req, controller)
 
@@ -219,6 +360,385 @@ func TestDeleteHostIsHandled(t *testing.T) {
 	}
 }
 
+func TestExtendHostSucceeds(t *testing.T) {
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, nil, "", nil, config.WebRTCConfig{}, &config.Config{})
+	ts := httptest.NewServer(controller.Handler())
+	defer ts.Close()
+
+	res, _ := http.Post(
+		ts.URL+"/v1/zones/us-central1-a/hosts/foo/:extend", "application/json", strings.NewReader(`{"ttl_seconds": 3600}`))
+
+	expected := http.StatusOK
+	if res.StatusCode != expected {
+		t.Errorf("unexpected status code <<%d>>, want: %d", res.StatusCode, expected)
+	}
+}
+
+func TestHostLifecycleRoutesSucceed(t *testing.T) {
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, nil, "", nil, config.WebRTCConfig{}, &config.Config{})
+	ts := httptest.NewServer(controller.Handler())
+	defer ts.Close()
+
+	for _, action := range []string{":stop", ":start", ":suspend"} {
+		res, _ := http.Post(ts.URL+"/v1/zones/us-central1-a/hosts/foo/"+action, "application/json", nil)
+
+		expected := http.StatusOK
+		if res.StatusCode != expected {
+			t.Errorf("%s: unexpected status code <<%d>>, want: %d", action, res.StatusCode, expected)
+		}
+	}
+}
+
+func newSharedHostTestApp(t *testing.T, role acl.Role) *App {
+	dbs := database.NewInMemoryDBService()
+	err := dbs.StoreHostACL(acl.HostACL{
+		Zone:    "us-central1-a",
+		Host:    "shared",
+		Owner:   "janedoe",
+		Entries: []acl.Entry{{Principal: acl.UserPrincipal(testUsername), Role: role}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(ts.Close)
+	hostURL, _ := url.Parse(ts.URL)
+	return NewApp(&testInstanceManager{
+		hostClientFactory: func(_, _ string) instances.HostClient {
+			return &testHostClient{hostURL}
+		},
+		hostOwners: map[string]string{"shared": "janedoe"},
+	}, &testAccountManager{}, nil, nil, dbs, "", nil, config.WebRTCConfig{}, &config.Config{})
+}
+
+func TestSharedHostAccess(t *testing.T) {
+	tests := []struct {
+		name   string
+		role   acl.Role
+		method string
+		path   string
+		code   int
+	}{
+		{"viewer gets host", acl.ViewerRole, "GET", "", http.StatusOK},
+		{"viewer gets acl", acl.ViewerRole, "GET", "/acl", http.StatusOK},
+		{"viewer lists cvds", acl.ViewerRole, "GET", "/cvds", http.StatusOK},
+		{"viewer connects", acl.ViewerRole, "POST", "/polled_connections", http.StatusOK},
+		{"viewer creates cvd", acl.ViewerRole, "POST", "/cvds", http.StatusForbidden},
+		{"viewer deletes host", acl.ViewerRole, "DELETE", "", http.StatusForbidden},
+		{"editor creates cvd", acl.EditorRole, "POST", "/cvds", http.StatusOK},
+		{"editor deletes host", acl.EditorRole, "DELETE", "", http.StatusOK},
+		{"editor sets acl", acl.EditorRole, "PUT", "/acl", http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			controller := newSharedHostTestApp(t, tc.role)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, "/v1/zones/us-central1-a/hosts/shared"+tc.path, strings.NewReader(`{"entries": []}`))
+
+			makeRequest(w, req, controller)
+
+			if diff := cmp.Diff(tc.code, w.Result().StatusCode); diff != "" {
+				t.Errorf("status code mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSharedHostAccessIsCached(t *testing.T) {
+	controller := newSharedHostTestApp(t, acl.ViewerRole)
+	now := time.Now()
+	controller.hostAccess.now = func() time.Time { return now }
+	forward := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/zones/us-central1-a/hosts/shared/cvds", nil)
+		makeRequest(w, req, controller)
+		return w.Result().StatusCode
+	}
+	forward()
+	if err := controller.databaseService.DeleteHostACL("us-central1-a", "shared"); err != nil {
+		t.Fatal(err)
+	}
+
+	cached := forward()
+	now = now.Add(hostAccessCacheTTL)
+	expired := forward()
+
+	if diff := cmp.Diff(http.StatusOK, cached); diff != "" {
+		t.Errorf("status code with cached access mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(http.StatusNotFound, expired); diff != "" {
+		t.Errorf("status code with expired access mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSharedHostAccessIsInvalidatedWhenACLChanges(t *testing.T) {
+	controller := newSharedHostTestApp(t, acl.ViewerRole)
+	forward := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/zones/us-central1-a/hosts/shared/cvds", nil)
+		makeRequest(w, req, controller)
+		return w.Result().StatusCode
+	}
+	granted := forward()
+	req, _ := http.NewRequest("PUT", "/v1/zones/us-central1-a/hosts/shared/acl", strings.NewReader(`{"entries": []}`))
+	req = mux.SetURLVars(req, map[string]string{"zone": "us-central1-a", "host": "shared"})
+	if err := controller.setHostACL(httptest.NewRecorder(), req, namedUser("janedoe")); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked := forward()
+
+	if diff := cmp.Diff(http.StatusOK, granted); diff != "" {
+		t.Errorf("status code with granted access mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(http.StatusNotFound, revoked); diff != "" {
+		t.Errorf("status code with revoked access mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSharedHostOwnerActsOnBehalfOfOwner(t *testing.T) {
+	controller := newSharedHostTestApp(t, acl.EditorRole)
+
+	owner, err := controller.sharedHostOwner("us-central1-a", "shared", &testUser{}, acl.EditorRole)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("janedoe", owner.Username()); diff != "" {
+		t.Errorf("username mismatch (-want +got):\n%s", diff)
+	}
+	delegate, ok := owner.(instances.Delegate)
+	if !ok {
+		t.Fatalf("expected the owner to be an instances.Delegate, got %T", owner)
+	}
+	if diff := cmp.Diff(testUsername, delegate.Actor().Username()); diff != "" {
+		t.Errorf("actor mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestListHostsIncludesSharedHosts(t *testing.T) {
+	controller := newSharedHostTestApp(t, acl.ViewerRole)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/zones/us-central1-a/hosts", nil)
+
+	makeRequest(w, req, controller)
+
+	var got apiv1.ListHostsResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := apiv1.ListHostsResponse{Items: []*apiv1.HostInstance{{Name: "shared", Owner: "janedoe"}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("response mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetHostACL(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, dbs, "", nil, config.WebRTCConfig{}, &config.Config{})
+	body := `{"entries": [{"principal": "user:janedoe", "role": "editor"}, {"principal": "group:camera", "role": "viewer"}]}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/v1/zones/us-central1-a/hosts/foo/acl", strings.NewReader(body))
+
+	makeRequest(w, req, controller)
+
+	if diff := cmp.Diff(http.StatusOK, w.Result().StatusCode); diff != "" {
+		t.Fatalf("status code mismatch (-want +got):\n%s", diff)
+	}
+	got, err := dbs.FetchHostACL("us-central1-a", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &acl.HostACL{
+		Zone:  "us-central1-a",
+		Host:  "foo",
+		Owner: testUsername,
+		Entries: []acl.Entry{
+			{Principal: "user:janedoe", Role: acl.EditorRole},
+			{Principal: "group:camera", Role: acl.ViewerRole},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("acl mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetHostACLInvalidEntries(t *testing.T) {
+	bodies := []string{
+		`{"entries": [{"principal": "janedoe", "role": "editor"}]}`,
+		`{"entries": [{"principal": "user:janedoe", "role": "owner"}]}`,
+		`{"entries": [{"principal": "user:janedoe", "role": "editor"}, {"principal": "user:janedoe", "role": "viewer"}]}`,
+	}
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, database.NewInMemoryDBService(), "", nil, config.WebRTCConfig{}, &config.Config{})
+	for _, body := range bodies {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", "/v1/zones/us-central1-a/hosts/foo/acl", strings.NewReader(body))
+
+		makeRequest(w, req, controller)
+
+		if diff := cmp.Diff(http.StatusBadRequest, w.Result().StatusCode); diff != "" {
+			t.Errorf("%s: status code mismatch (-want +got):\n%s", body, diff)
+		}
+	}
+}
+
+func TestAdminRoutesAuthorization(t *testing.T) {
+	routes := []struct {
+		method string
+		path   string
+		// Minimum role required by the route.
+		role accounts.Role
+	}{
+		{"GET", "/v1/admin/hosts", accounts.AuditorRole},
+		{"DELETE", "/v1/admin/zones/us-central1-a/hosts/foo", accounts.AdminRole},
+		{"DELETE", "/v1/admin/users/janedoe/credentials", accounts.AdminRole},
+		{"PUT", "/v1/admin/users/janedoe/role", accounts.AdminRole},
+		{"GET", "/v1/admin/apikeys", accounts.AuditorRole},
+	}
+	for _, role := range []accounts.Role{accounts.UserRole, accounts.AuditorRole, accounts.AdminRole} {
+		dbs := database.NewInMemoryDBService()
+		if err := dbs.StoreUserRole(testUsername, string(role)); err != nil {
+			t.Fatal(err)
+		}
+		controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, dbs, "", nil, config.WebRTCConfig{}, &config.Config{})
+		for _, route := range routes {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(route.method, route.path, strings.NewReader(`{"role": "auditor"}`))
+
+			makeRequest(w, req, controller)
+
+			want := http.StatusForbidden
+			if role.Includes(route.role) {
+				want = http.StatusOK
+			}
+			if diff := cmp.Diff(want, w.Result().StatusCode); diff != "" {
+				t.Errorf("%s %s as %s: status code mismatch (-want +got):\n%s", route.method, route.path, role, diff)
+			}
+		}
+	}
+}
+
+func TestStoredRolesIgnoredWithoutAuthentication(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	dbs.StoreUserRole(testUsername, string(accounts.AdminRole))
+	cfg := &config.Config{AccountManager: accounts.Config{Type: accounts.UsernameOnlyAMType}}
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, dbs, "", nil, config.WebRTCConfig{}, cfg)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/admin/hosts", nil)
+
+	makeRequest(w, req, controller)
+
+	if diff := cmp.Diff(http.StatusForbidden, w.Result().StatusCode); diff != "" {
+		t.Errorf("status code mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestListAllHosts(t *testing.T) {
+	cfg := &config.Config{AccountManager: accounts.Config{Auditors: []string{testUsername}}}
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, database.NewInMemoryDBService(), "", nil, config.WebRTCConfig{}, cfg)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/admin/hosts", nil)
+
+	makeRequest(w, req, controller)
+
+	var got apiv1.ListHostsResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := apiv1.ListHostsResponse{
+		Items: []*apiv1.HostInstance{{Name: "foo", Owner: "janedoe", Zone: "us-central1-a"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("response mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRevokeUserCredentials(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	dbs.StoreUserRole(testUsername, string(accounts.AdminRole))
+	// Unreadable credentials are deleted without being revoked.
+	dbs.StoreBuildAPICredentials("janedoe", []byte("foo"))
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, encryption.NewFakeEncryptionService(), dbs, "", nil, config.WebRTCConfig{}, &config.Config{})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/v1/admin/users/janedoe/credentials", nil)
+
+	makeRequest(w, req, controller)
+
+	if diff := cmp.Diff(http.StatusOK, w.Result().StatusCode); diff != "" {
+		t.Fatalf("status code mismatch (-want +got):\n%s", diff)
+	}
+	if creds, _ := dbs.FetchBuildAPICredentials("janedoe"); creds != nil {
+		t.Errorf("expected credentials to be deleted, got: %q", creds)
+	}
+}
+
+func TestSetUserRoleSetInConfig(t *testing.T) {
+	cfg := &config.Config{AccountManager: accounts.Config{Admins: []string{testUsername, "janedoe"}}}
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, database.NewInMemoryDBService(), "", nil, config.WebRTCConfig{}, cfg)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/v1/admin/users/janedoe/role", strings.NewReader(`{"role": "user"}`))
+
+	makeRequest(w, req, controller)
+
+	if diff := cmp.Diff(http.StatusBadRequest, w.Result().StatusCode); diff != "" {
+		t.Errorf("status code mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	dbs.StoreUserRole(testUsername, string(accounts.AdminRole))
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, dbs, "", nil, config.WebRTCConfig{}, &config.Config{})
+	am := accounts.NewAPIKeyAccountManager(&testAccountManager{}, dbs)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/admin/apikeys", strings.NewReader(`{"name": "presubmit", "identity": "svc-ci-bot"}`))
+
+	makeRequest(w, req, controller)
+
+	if diff := cmp.Diff(http.StatusOK, w.Result().StatusCode); diff != "" {
+		t.Fatalf("status code mismatch (-want +got):\n%s", diff)
+	}
+	var created apiv1.APIKey
+	if err := json.NewDecoder(w.Result().Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	keyReq, _ := http.NewRequest("GET", "/v1/zones/us-central1-a/hosts", nil)
+	keyReq.Header.Set(accounts.APIKeyHeader, created.Key)
+	user, err := am.UserFromRequest(keyReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("svc-ci-bot", user.Username()); diff != "" {
+		t.Errorf("username mismatch (-want +got):\n%s", diff)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/v1/admin/apikeys/"+created.ID, nil)
+
+	makeRequest(w, req, controller)
+
+	if diff := cmp.Diff(http.StatusOK, w.Result().StatusCode); diff != "" {
+		t.Fatalf("status code mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := am.UserFromRequest(keyReq); err == nil {
+		t.Error("expected error authenticating with a revoked key")
+	}
+}
+
+func TestCreateAPIKeyInvalidIdentity(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	dbs.StoreUserRole(testUsername, string(accounts.AdminRole))
+	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, dbs, "", nil, config.WebRTCConfig{}, &config.Config{})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/admin/apikeys", strings.NewReader(`{"identity": "CI Bot"}`))
+
+	makeRequest(w, req, controller)
+
+	if diff := cmp.Diff(http.StatusBadRequest, w.Result().StatusCode); diff != "" {
+		t.Errorf("status code mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestInfraConfigRequest(t *testing.T) {
 	controller := NewApp(&testInstanceManager{}, &testAccountManager{}, nil, nil, nil, "", nil, config.WebRTCConfig{STUNServers: []string{"foo.com:12345"}}, &config.Config{})
 	ts := httptest.NewServer(controller.Handler())
@@ -277,7 +797,7 @@ func TestHostForwarderRequest(t *testing.T) {
 		hostClientFactory: func(_, _ string) instances.HostClient {
 			return &testHostClient{hostURL}
 		},
-	}, &testAccountManager{}, nil, nil, nil, "", nil, config.WebRTCConfig{}, &config.Config{})
+	}, &testAccountManager{}, nil, nil, database.NewInMemoryDBService(), "", nil, config.WebRTCConfig{}, &config.Config{})
 
 	tests := []struct {
 		method  string
@@ -349,12 +869,12 @@ func TestHostForwarderInjectCredentialsUsingHTTPHeader(t *testing.T) {
 	reqURL := "http://test.com/v1/zones/foo/hosts/bar/foo"
 	credentials := "abcdef"
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if len(r.Header.Values(headerNameHOBuildAPICreds)) == 0 {
+		if len(r.Header.Values(appOAuth2.DefaultHostOrchestratorHeader)) == 0 {
 			t.Errorf("no credentials were injected")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		if diff := cmp.Diff(credentials, r.Header.Get(headerNameHOBuildAPICreds)); diff != "" {
+		if diff := cmp.Diff(credentials, r.Header.Get(appOAuth2.DefaultHostOrchestratorHeader)); diff != "" {
 			t.Errorf("credentials mismatch (-want +got):\n%s", diff)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -521,6 +1041,73 @@ func assertIsAppError(t *testing.T, err error) {
 	}
 }
 
+// Authenticates requests with bearer tokens only, browser redirects carry none.
+type testBearerAccountManager struct{}
+
+func (m *testBearerAccountManager) UserFromRequest(r *http.Request) (accounts.User, error) {
+	return nil, nil
+}
+
+type testIDTokenAccountManager struct {
+	testBearerAccountManager
+}
+
+func (m *testIDTokenAccountManager) UserFromIDToken(idToken string) (accounts.User, error) {
+	return &testUser{}, nil
+}
+
+func newOAuth2CallbackTestApp(t *testing.T, am accounts.Manager, dbs database.Service) *App {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"email": ""}).SignedString([]byte("key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		replyJSON(w, map[string]string{"access_token": "foo", "token_type": "Bearer", "id_token": idToken}, http.StatusOK)
+	}))
+	t.Cleanup(ts.Close)
+	pc := appOAuth2.ProviderConfig{AuthURL: ts.URL + "/auth", TokenURL: ts.URL + "/token"}
+	helper, err := appOAuth2.NewProviderOAuth2Helper(pc, "", secrets.NewEmptySecretManager())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.CreateOrUpdateSession(session.Session{Key: "session", OAuth2State: "state"})
+	return NewApp(&testInstanceManager{}, am, helper, encryption.NewFakeEncryptionService(), dbs, "", nil, config.WebRTCConfig{}, &config.Config{})
+}
+
+func TestOAuth2CallbackWithoutUser(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	controller := newOAuth2CallbackTestApp(t, &testBearerAccountManager{}, dbs)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/oauth2callback?state=state&code=bar", nil)
+	req.AddCookie(&http.Cookie{Name: sessionIdCookie, Value: "session"})
+
+	makeRequest(w, req, controller)
+
+	if diff := cmp.Diff(http.StatusUnauthorized, w.Result().StatusCode); diff != "" {
+		t.Errorf("status code mismatch (-want +got):\n%s", diff)
+	}
+	if creds, _ := dbs.FetchBuildAPICredentials(testUsername); creds != nil {
+		t.Errorf("expected no credentials, got: %q", creds)
+	}
+}
+
+func TestOAuth2CallbackAuthenticatesIDToken(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	controller := newOAuth2CallbackTestApp(t, &testIDTokenAccountManager{}, dbs)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/oauth2callback?state=state&code=bar", nil)
+	req.AddCookie(&http.Cookie{Name: sessionIdCookie, Value: "session"})
+
+	makeRequest(w, req, controller)
+
+	if diff := cmp.Diff(http.StatusOK, w.Result().StatusCode); diff != "" {
+		t.Fatalf("status code mismatch (-want +got):\n%s", diff)
+	}
+	if creds, _ := dbs.FetchBuildAPICredentials(testUsername); creds == nil {
+		t.Error("expected credentials to be stored")
+	}
+}
+
 func makeRequest(w http.ResponseWriter, r *http.Request, controller *App) {
 	router := controller.Handler()
 	router.ServeHTTP(w, r)
@@ -20,8 +20,10 @@ import (
 	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
 	"github.com/google/cloud-android-orchestration/pkg/app/database"
 	"github.com/google/cloud-android-orchestration/pkg/app/encryption"
+	"github.com/google/cloud-android-orchestration/pkg/app/https"
 	"github.com/google/cloud-android-orchestration/pkg/app/instances"
 	"github.com/google/cloud-android-orchestration/pkg/app/secrets"
+	"github.com/google/cloud-android-orchestration/pkg/app/vault"
 
 	toml "github.com/pelletier/go-toml"
 )
@@ -39,6 +41,11 @@ type Config struct {
 	EncryptionService  encryption.Config
 	DatabaseService    database.Config
 	WebRTC             WebRTCConfig
+	// Limits on the hosts users may create.
+	Quota instances.QuotaConfig
+	TLS   https.Config
+	// Connection to the Vault server used by the secret manager or encryption service, if any.
+	Vault vault.Config
 }
 
 const DefaultConfFile = "conf.toml"
@@ -15,6 +15,16 @@
 package database
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/acl"
+	"github.com/google/cloud-android-orchestration/pkg/app/apikey"
+	"github.com/google/cloud-android-orchestration/pkg/app/hostmeta"
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
 	"github.com/google/cloud-android-orchestration/pkg/app/session"
 )
 
@@ -24,16 +34,146 @@ type Service interface {
 	FetchBuildAPICredentials(username string) ([]byte, error)
 	// Store new credentials or overwrite existing ones for the given user.
 	StoreBuildAPICredentials(username string, credentials []byte) error
+	// Replace the credentials of the given user only if they are still the expected ones. Returns
+	// whether they were replaced.
+	ReplaceBuildAPICredentials(username string, expected, credentials []byte) (bool, error)
 	DeleteBuildAPICredentials(username string) error
+	// List the users with stored credentials, sorted by username.
+	ListBuildAPICredentialsUsernames() ([]string, error)
 	// Create or update a user session.
 	CreateOrUpdateSession(s session.Session) error
 	// Fetch a session. Returns nil, nil if the session doesn't exist.
 	FetchSession(key string) (*session.Session, error)
 	// Delete a session. Won't return error if the session doesn't exist.
 	DeleteSession(key string) error
+	// Create or update an operation.
+	CreateOrUpdateOperation(op operation.Operation) error
+	// Update an operation unless it's already done. Returns false without updating it if the stored
+	// operation is done or doesn't exist.
+	UpdateUnfinishedOperation(op operation.Operation) (bool, error)
+	// Fetch an operation. Returns nil, nil if the operation doesn't exist.
+	FetchOperation(name string) (*operation.Operation, error)
+	// List the operations matching the filter, sorted by creation time.
+	ListOperations(filter operation.Filter) ([]*operation.Operation, error)
+	// Create or replace the access control list of a host.
+	StoreHostACL(a acl.HostACL) error
+	// Fetch the access control list of a host. Returns nil, nil if the host has none.
+	FetchHostACL(zone, host string) (*acl.HostACL, error)
+	// Delete the access control list of a host. Won't return error if the host has none.
+	DeleteHostACL(zone, host string) error
+	// List the access control lists matching the filter.
+	ListHostACLs(filter acl.Filter) ([]*acl.HostACL, error)
+	// Create or replace the metadata of a host.
+	StoreHostMetadata(m hostmeta.Metadata) error
+	// Fetch the metadata of a host. Returns nil, nil if the host has none.
+	FetchHostMetadata(zone, host string) (*hostmeta.Metadata, error)
+	// Delete the metadata of a host. Won't return error if the host has none.
+	DeleteHostMetadata(zone, host string) error
+	// List the metadata of the hosts in the zone, sorted by host.
+	ListHostMetadata(zone string) ([]*hostmeta.Metadata, error)
+	// Store the last time activity was detected in a host, unless a later time is already stored.
+	RecordHostActivity(a hostmeta.Activity) error
+	// Fetch the last activity of a host. Returns nil, nil if none is stored.
+	FetchHostActivity(zone, host string) (*hostmeta.Activity, error)
+	// List the last activity of every host, sorted by zone and host.
+	ListHostActivity() ([]*hostmeta.Activity, error)
+	// Delete the last activity of a host. Won't return error if none is stored.
+	DeleteHostActivity(zone, host string) error
+	// Fetch the role assigned to the user. Returns an empty string if the user has none.
+	FetchUserRole(username string) (string, error)
+	// Assign a role to the user, overwriting the existing one.
+	StoreUserRole(username string, role string) error
+	// Create or update an api key.
+	StoreAPIKey(k apikey.Key) error
+	// Fetch an api key. Returns nil, nil if the key doesn't exist.
+	FetchAPIKey(id string) (*apikey.Key, error)
+	// List every api key, sorted by creation time.
+	ListAPIKeys() ([]*apikey.Key, error)
+	// Delete an api key. Won't return error if the key doesn't exist.
+	DeleteAPIKey(id string) error
+}
+
+// Sessions are only used to store the OAuth2 state during the authorization flow, they expire if
+// not updated for this long.
+const sessionStateValidityHours = 48
+
+const sessionTTL = sessionStateValidityHours * time.Hour
+
+// How often CollectExpiredSessions deletes the expired sessions.
+const SessionGCInterval = time.Hour
+
+// Implemented by the database services that need expired sessions to be deleted explicitly.
+type ExpiredSessionsCollector interface {
+	// Deletes the sessions that expired, returns how many were deleted.
+	DeleteExpiredSessions() (int64, error)
+}
+
+// Deletes expired sessions periodically until the context is cancelled.
+func CollectExpiredSessions(ctx context.Context, c ExpiredSessionsCollector, interval time.Duration) {
+	collectPeriodically(ctx, "expired session(s)", c.DeleteExpiredSessions, interval)
+}
+
+// Finished operations are kept for this long after their last update, clients waiting for them
+// are done by then.
+const finishedOperationTTL = 24 * time.Hour
+
+// How often CollectFinishedOperations deletes the old finished operations.
+const OperationGCInterval = time.Hour
+
+// Implemented by the database services that need old finished operations to be deleted explicitly,
+// otherwise every operation would be kept forever.
+type FinishedOperationsCollector interface {
+	// Deletes the operations that finished over finishedOperationTTL ago, returns how many were
+	// deleted.
+	DeleteFinishedOperations() (int64, error)
+}
+
+// Deletes old finished operations periodically until the context is cancelled.
+func CollectFinishedOperations(ctx context.Context, c FinishedOperationsCollector, interval time.Duration) {
+	collectPeriodically(ctx, "finished operation(s)", c.DeleteFinishedOperations, interval)
+}
+
+func collectPeriodically(ctx context.Context, what string, collect func() (int64, error), interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := collect()
+			if err != nil {
+				log.Printf("failed to delete %s: %v", what, err)
+				continue
+			}
+			log.Printf("%d %s deleted", count, what)
+		}
+	}
 }
 
 type Config struct {
-	Type    string
-	Spanner *SpannerConfig
+	Type     string
+	Spanner  *SpannerConfig
+	File     *FileConfig
+	Postgres *PostgresConfig
+}
+
+// Host labels are stored as JSON objects by the databases without a map type.
+func encodeHostLabels(labels map[string]string) (string, error) {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	b, err := json.Marshal(labels)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode host labels: %w", err)
+	}
+	return string(b), nil
+}
+
+func decodeHostLabels(s string) (map[string]string, error) {
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(s), &labels); err != nil {
+		return nil, fmt.Errorf("failed to decode host labels: %w", err)
+	}
+	return labels, nil
 }
@@ -0,0 +1,596 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databasetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/acl"
+	"github.com/google/cloud-android-orchestration/pkg/app/apikey"
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
+	"github.com/google/cloud-android-orchestration/pkg/app/hostmeta"
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
+	"github.com/google/cloud-android-orchestration/pkg/app/session"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// Returns a database service without any data. It's called once per check so checks don't depend on
+// each other.
+type ServiceFactory func(t *testing.T) database.Service
+
+// Verifies that a database service implementation fulfills the contract of the database.Service
+// interface. Meant to be called from the tests of every implementation, including those outside the
+// database package.
+func RunConformanceTests(t *testing.T, newService ServiceFactory) {
+	checks := []struct {
+		name  string
+		check func(t *testing.T, dbs database.Service)
+	}{
+		{"BuildAPICredentials", checkBuildAPICredentials},
+		{"Sessions", checkSessions},
+		{"Operations", checkOperations},
+		{"FinishedOperations", checkFinishedOperations},
+		{"HostACLs", checkHostACLs},
+		{"HostMetadata", checkHostMetadata},
+		{"HostActivity", checkHostActivity},
+		{"UserRoles", checkUserRoles},
+		{"APIKeys", checkAPIKeys},
+		{"ConcurrentAccess", checkConcurrentAccess},
+	}
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			c.check(t, newService(t))
+		})
+	}
+}
+
+// Databases may store timestamps with lower precision or in a different location and may not
+// distinguish nil from empty slices.
+var conformanceCmpOpts = []cmp.Option{
+	cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) }),
+	cmpopts.EquateEmpty(),
+}
+
+func checkBuildAPICredentials(t *testing.T, dbs database.Service) {
+	creds, err := dbs.FetchBuildAPICredentials("johndoe")
+	if err != nil || creds != nil {
+		t.Fatalf("FetchBuildAPICredentials of unknown user = %v, %v, want nil, nil", creds, err)
+	}
+	if err := dbs.StoreBuildAPICredentials("johndoe", []byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	// Stored credentials are overwritten.
+	if err := dbs.StoreBuildAPICredentials("johndoe", []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbs.StoreBuildAPICredentials("janedoe", []byte("baz")); err != nil {
+		t.Fatal(err)
+	}
+	creds, err = dbs.FetchBuildAPICredentials("johndoe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte("bar"), creds); diff != "" {
+		t.Errorf("credentials mismatch (-want +got):\n%s", diff)
+	}
+	// Credentials are only replaced if they are still the expected ones.
+	if replaced, err := dbs.ReplaceBuildAPICredentials("johndoe", []byte("foo"), []byte("qux")); err != nil || replaced {
+		t.Errorf("ReplaceBuildAPICredentials of outdated credentials = %v, %v, want false, nil", replaced, err)
+	}
+	if replaced, err := dbs.ReplaceBuildAPICredentials("unknown", []byte("foo"), []byte("qux")); err != nil || replaced {
+		t.Errorf("ReplaceBuildAPICredentials of unknown user = %v, %v, want false, nil", replaced, err)
+	}
+	if replaced, err := dbs.ReplaceBuildAPICredentials("johndoe", []byte("bar"), []byte("qux")); err != nil || !replaced {
+		t.Errorf("ReplaceBuildAPICredentials = %v, %v, want true, nil", replaced, err)
+	}
+	creds, err = dbs.FetchBuildAPICredentials("johndoe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte("qux"), creds); diff != "" {
+		t.Errorf("replaced credentials mismatch (-want +got):\n%s", diff)
+	}
+	if creds, err := dbs.FetchBuildAPICredentials("unknown"); err != nil || creds != nil {
+		t.Errorf("FetchBuildAPICredentials of unknown user after replacement = %v, %v, want nil, nil", creds, err)
+	}
+	usernames, err := dbs.ListBuildAPICredentialsUsernames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"janedoe", "johndoe"}, usernames); diff != "" {
+		t.Errorf("usernames mismatch (-want +got):\n%s", diff)
+	}
+	if err := dbs.DeleteBuildAPICredentials("johndoe"); err != nil {
+		t.Fatal(err)
+	}
+	if creds, err := dbs.FetchBuildAPICredentials("johndoe"); err != nil || creds != nil {
+		t.Errorf("FetchBuildAPICredentials after deletion = %v, %v, want nil, nil", creds, err)
+	}
+	// Credentials of other users are kept.
+	creds, err = dbs.FetchBuildAPICredentials("janedoe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte("baz"), creds); diff != "" {
+		t.Errorf("credentials of other user mismatch (-want +got):\n%s", diff)
+	}
+	if err := dbs.DeleteBuildAPICredentials("unknown"); err != nil {
+		t.Errorf("DeleteBuildAPICredentials of unknown user failed: %v", err)
+	}
+}
+
+func checkSessions(t *testing.T, dbs database.Service) {
+	s, err := dbs.FetchSession("foo")
+	if err != nil || s != nil {
+		t.Fatalf("FetchSession of unknown session = %v, %v, want nil, nil", s, err)
+	}
+	if err := dbs.CreateOrUpdateSession(session.Session{Key: "foo", OAuth2State: "bar"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbs.CreateOrUpdateSession(session.Session{Key: "foo", OAuth2State: "baz"}); err != nil {
+		t.Fatal(err)
+	}
+	s, err = dbs.FetchSession("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&session.Session{Key: "foo", OAuth2State: "baz"}, s); diff != "" {
+		t.Errorf("session mismatch (-want +got):\n%s", diff)
+	}
+	// Deleting sessions is idempotent.
+	for i := 0; i < 2; i++ {
+		if err := dbs.DeleteSession("foo"); err != nil {
+			t.Fatalf("DeleteSession #%d failed: %v", i+1, err)
+		}
+	}
+	if s, err := dbs.FetchSession("foo"); err != nil || s != nil {
+		t.Errorf("FetchSession after deletion = %v, %v, want nil, nil", s, err)
+	}
+}
+
+func checkOperations(t *testing.T, dbs database.Service) {
+	if op, err := dbs.FetchOperation("unknown"); err != nil || op != nil {
+		t.Fatalf("FetchOperation of unknown operation = %v, %v, want nil, nil", op, err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Stored out of order, listing sorts them by creation time.
+	ops := []operation.Operation{
+		{
+			Name:       "op2",
+			Type:       "deletehost",
+			Username:   "janedoe",
+			Host:       "foo",
+			State:      operation.PendingState,
+			CreateTime: now.Add(time.Second),
+			UpdateTime: now.Add(time.Second),
+		},
+		{
+			Name:       "op1",
+			Type:       "createhost",
+			Username:   "janedoe",
+			State:      operation.RunningState,
+			CreateTime: now,
+			UpdateTime: now,
+		},
+		{
+			Name:       "op3",
+			Type:       "createhost",
+			Username:   "johndoe",
+			State:      operation.DoneState,
+			CreateTime: now.Add(2 * time.Second),
+			UpdateTime: now.Add(3 * time.Second),
+			Result:     []byte(`{"name":"bar"}`),
+		},
+	}
+	for _, op := range ops {
+		if err := dbs.CreateOrUpdateOperation(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ops[1].State = operation.ErrorState
+	ops[1].ErrorCode = 500
+	ops[1].ErrorMsg = "failed"
+	if err := dbs.CreateOrUpdateOperation(ops[1]); err != nil {
+		t.Fatal(err)
+	}
+	op, err := dbs.FetchOperation("op1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&ops[1], op, conformanceCmpOpts...); diff != "" {
+		t.Errorf("operation mismatch (-want +got):\n%s", diff)
+	}
+	filters := []struct {
+		filter operation.Filter
+		want   []*operation.Operation
+	}{
+		{operation.Filter{}, []*operation.Operation{&ops[1], &ops[0], &ops[2]}},
+		{operation.Filter{Username: "janedoe"}, []*operation.Operation{&ops[1], &ops[0]}},
+		{operation.Filter{Type: "createhost", State: operation.DoneState}, []*operation.Operation{&ops[2]}},
+		{operation.Filter{Host: "foo"}, []*operation.Operation{&ops[0]}},
+		{operation.Filter{Username: "unknown"}, []*operation.Operation{}},
+	}
+	for _, f := range filters {
+		got, err := dbs.ListOperations(f.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(f.want, got, conformanceCmpOpts...); diff != "" {
+			t.Errorf("operations matching %+v mismatch (-want +got):\n%s", f.filter, diff)
+		}
+	}
+	// Done operations are not updated.
+	unfinished := ops[0]
+	unfinished.State = operation.RunningState
+	unfinished.UpdateTime = now.Add(4 * time.Second)
+	done := ops[2]
+	done.State = operation.CancelledState
+	unknown := operation.Operation{Name: "unknown", State: operation.RunningState, CreateTime: now, UpdateTime: now}
+	updates := []struct {
+		op   operation.Operation
+		want bool
+	}{
+		{unfinished, true},
+		{done, false},
+		{unknown, false},
+	}
+	for _, u := range updates {
+		updated, err := dbs.UpdateUnfinishedOperation(u.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated != u.want {
+			t.Errorf("UpdateUnfinishedOperation of %q = %t, want %t", u.op.Name, updated, u.want)
+		}
+	}
+	want := map[string]*operation.Operation{"op2": &unfinished, "op3": &ops[2], "unknown": nil}
+	for name, w := range want {
+		op, err := dbs.FetchOperation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(w, op, conformanceCmpOpts...); diff != "" {
+			t.Errorf("operation %q after conditional update mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+}
+
+func checkFinishedOperations(t *testing.T, dbs database.Service) {
+	c, ok := dbs.(database.FinishedOperationsCollector)
+	if !ok {
+		t.Skip("finished operations aren't collected explicitly")
+	}
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	old := now.Add(-48 * time.Hour)
+	ops := []operation.Operation{
+		{Name: "old", Type: "createhost", State: operation.DoneState, CreateTime: old, UpdateTime: old},
+		{Name: "recent", Type: "createhost", State: operation.ErrorState, CreateTime: now, UpdateTime: now},
+		{Name: "running", Type: "createhost", State: operation.RunningState, CreateTime: old, UpdateTime: old},
+	}
+	for _, op := range ops {
+		if err := dbs.CreateOrUpdateOperation(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := c.DeleteFinishedOperations()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(int64(1), count); diff != "" {
+		t.Errorf("deleted operations mismatch (-want +got):\n%s", diff)
+	}
+	got, err := dbs.ListOperations(operation.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, op := range got {
+		names = append(names, op.Name)
+	}
+	if diff := cmp.Diff([]string{"running", "recent"}, names); diff != "" {
+		t.Errorf("operations mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func checkHostACLs(t *testing.T, dbs database.Service) {
+	if got, err := dbs.FetchHostACL("us-central1-a", "foo"); err != nil || got != nil {
+		t.Fatalf("FetchHostACL of unknown host = %v, %v, want nil, nil", got, err)
+	}
+	// Entries are sorted by principal, the order persistent databases return them in.
+	foo := acl.HostACL{
+		Zone:  "us-central1-a",
+		Host:  "foo",
+		Owner: "johndoe",
+		Entries: []acl.Entry{
+			{Principal: "group:testers", Role: acl.ViewerRole},
+			{Principal: "user:janedoe", Role: acl.EditorRole},
+		},
+	}
+	bar := acl.HostACL{
+		Zone:    "us-central1-a",
+		Host:    "bar",
+		Owner:   "janedoe",
+		Entries: []acl.Entry{{Principal: "user:johndoe", Role: acl.ViewerRole}},
+	}
+	baz := acl.HostACL{
+		Zone:    "us-west1-a",
+		Host:    "baz",
+		Owner:   "johndoe",
+		Entries: []acl.Entry{{Principal: "user:janedoe", Role: acl.ViewerRole}},
+	}
+	for _, a := range []acl.HostACL{foo, bar, baz} {
+		if err := dbs.StoreHostACL(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Storing a list replaces the previous one.
+	foo.Entries = foo.Entries[1:]
+	if err := dbs.StoreHostACL(foo); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dbs.FetchHostACL("us-central1-a", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&foo, got, conformanceCmpOpts...); diff != "" {
+		t.Errorf("host acl mismatch (-want +got):\n%s", diff)
+	}
+	filters := []struct {
+		filter acl.Filter
+		want   []*acl.HostACL
+	}{
+		{acl.Filter{Zone: "us-central1-a", Principals: []string{"user:janedoe"}}, []*acl.HostACL{&foo}},
+		{acl.Filter{Zone: "us-central1-a", Principals: []string{"user:janedoe", "user:johndoe"}}, []*acl.HostACL{&bar, &foo}},
+		{acl.Filter{Zone: "us-central1-a", Principals: []string{"group:testers"}}, []*acl.HostACL{}},
+	}
+	for _, f := range filters {
+		got, err := dbs.ListHostACLs(f.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(f.want, got, conformanceCmpOpts...); diff != "" {
+			t.Errorf("host acls matching %+v mismatch (-want +got):\n%s", f.filter, diff)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := dbs.DeleteHostACL("us-central1-a", "foo"); err != nil {
+			t.Fatalf("DeleteHostACL #%d failed: %v", i+1, err)
+		}
+	}
+	if got, err := dbs.FetchHostACL("us-central1-a", "foo"); err != nil || got != nil {
+		t.Errorf("FetchHostACL after deletion = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func checkHostMetadata(t *testing.T, dbs database.Service) {
+	if got, err := dbs.FetchHostMetadata("local", "foo"); err != nil || got != nil {
+		t.Fatalf("FetchHostMetadata of unknown host = %v, %v, want nil, nil", got, err)
+	}
+	foo := hostmeta.Metadata{
+		Zone:       "local",
+		Host:       "foo",
+		Owner:      "johndoe",
+		Labels:     map[string]string{"team": "camera"},
+		ExpireTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	bar := hostmeta.Metadata{Zone: "local", Host: "bar", Owner: "janedoe"}
+	baz := hostmeta.Metadata{Zone: "us-central1-a", Host: "baz", Owner: "johndoe"}
+	for _, m := range []hostmeta.Metadata{foo, bar, baz} {
+		if err := dbs.StoreHostMetadata(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Storing metadata replaces the previous one.
+	foo.Labels = map[string]string{"purpose": "ci"}
+	foo.ExpireTime = time.Time{}
+	if err := dbs.StoreHostMetadata(foo); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dbs.FetchHostMetadata("local", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&foo, got, conformanceCmpOpts...); diff != "" {
+		t.Errorf("host metadata mismatch (-want +got):\n%s", diff)
+	}
+	list, err := dbs.ListHostMetadata("local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*hostmeta.Metadata{&bar, &foo}, list, conformanceCmpOpts...); diff != "" {
+		t.Errorf("host metadata list mismatch (-want +got):\n%s", diff)
+	}
+	for i := 0; i < 2; i++ {
+		if err := dbs.DeleteHostMetadata("local", "foo"); err != nil {
+			t.Fatalf("DeleteHostMetadata #%d failed: %v", i+1, err)
+		}
+	}
+	if got, err := dbs.FetchHostMetadata("local", "foo"); err != nil || got != nil {
+		t.Errorf("FetchHostMetadata after deletion = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func checkHostActivity(t *testing.T, dbs database.Service) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	foo := hostmeta.Activity{Zone: "us-central1-a", Host: "foo", LastActive: t0}
+	bar := hostmeta.Activity{Zone: "local", Host: "bar", LastActive: t0}
+	for _, a := range []hostmeta.Activity{foo, bar} {
+		if err := dbs.RecordHostActivity(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Later activity replaces the stored one, earlier activity is ignored.
+	foo.LastActive = t0.Add(time.Hour)
+	if err := dbs.RecordHostActivity(foo); err != nil {
+		t.Fatal(err)
+	}
+	earlier := bar
+	earlier.LastActive = t0.Add(-time.Hour)
+	if err := dbs.RecordHostActivity(earlier); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dbs.ListHostActivity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*hostmeta.Activity{&bar, &foo}, got, conformanceCmpOpts...); diff != "" {
+		t.Errorf("host activity mismatch (-want +got):\n%s", diff)
+	}
+	fetched, err := dbs.FetchHostActivity("us-central1-a", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&foo, fetched, conformanceCmpOpts...); diff != "" {
+		t.Errorf("fetched host activity mismatch (-want +got):\n%s", diff)
+	}
+	for i := 0; i < 2; i++ {
+		if err := dbs.DeleteHostActivity("local", "bar"); err != nil {
+			t.Fatalf("DeleteHostActivity #%d failed: %v", i+1, err)
+		}
+	}
+	got, err = dbs.ListHostActivity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*hostmeta.Activity{&foo}, got, conformanceCmpOpts...); diff != "" {
+		t.Errorf("host activity after deletion mismatch (-want +got):\n%s", diff)
+	}
+	if got, err := dbs.FetchHostActivity("local", "bar"); err != nil || got != nil {
+		t.Errorf("FetchHostActivity after deletion = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func checkUserRoles(t *testing.T, dbs database.Service) {
+	if role, err := dbs.FetchUserRole("johndoe"); err != nil || role != "" {
+		t.Fatalf("FetchUserRole of unknown user = %q, %v, want empty, nil", role, err)
+	}
+	if err := dbs.StoreUserRole("johndoe", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbs.StoreUserRole("johndoe", "auditor"); err != nil {
+		t.Fatal(err)
+	}
+	role, err := dbs.FetchUserRole("johndoe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("auditor", role); diff != "" {
+		t.Errorf("role mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func checkAPIKeys(t *testing.T, dbs database.Service) {
+	if k, err := dbs.FetchAPIKey("unknown"); err != nil || k != nil {
+		t.Fatalf("FetchAPIKey of unknown key = %v, %v, want nil, nil", k, err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys := []apikey.Key{
+		{
+			ID:         "k2",
+			Name:       "ci",
+			Identity:   "svc-ci-bot",
+			SecretHash: []byte("foo"),
+			CreatedBy:  "johndoe",
+			CreateTime: now.Add(time.Second),
+			ExpireTime: now.Add(time.Hour),
+		},
+		{
+			ID:         "k1",
+			Name:       "lab",
+			Identity:   "lab-bot",
+			SecretHash: []byte("bar"),
+			CreatedBy:  "johndoe",
+			CreateTime: now,
+		},
+	}
+	for _, k := range keys {
+		if err := dbs.StoreAPIKey(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	k, err := dbs.FetchAPIKey("k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&keys[0], k, conformanceCmpOpts...); diff != "" {
+		t.Errorf("api key mismatch (-want +got):\n%s", diff)
+	}
+	list, err := dbs.ListAPIKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*apikey.Key{&keys[1], &keys[0]}, list, conformanceCmpOpts...); diff != "" {
+		t.Errorf("api keys mismatch (-want +got):\n%s", diff)
+	}
+	for i := 0; i < 2; i++ {
+		if err := dbs.DeleteAPIKey("k2"); err != nil {
+			t.Fatalf("DeleteAPIKey #%d failed: %v", i+1, err)
+		}
+	}
+	if k, err := dbs.FetchAPIKey("k2"); err != nil || k != nil {
+		t.Errorf("FetchAPIKey after deletion = %v, %v, want nil, nil", k, err)
+	}
+}
+
+func checkConcurrentAccess(t *testing.T, dbs database.Service) {
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			username := fmt.Sprintf("user%d", i)
+			if err := dbs.StoreBuildAPICredentials(username, []byte(username)); err != nil {
+				errs <- err
+				return
+			}
+			// Every worker writes the same session, the last write wins.
+			if err := dbs.CreateOrUpdateSession(session.Session{Key: "shared", OAuth2State: username}); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := dbs.FetchSession("shared"); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	for i := 0; i < workers; i++ {
+		username := fmt.Sprintf("user%d", i)
+		creds, err := dbs.FetchBuildAPICredentials(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]byte(username), creds); diff != "" {
+			t.Errorf("credentials of %q mismatch (-want +got):\n%s", username, diff)
+		}
+	}
+	s, err := dbs.FetchSession("shared")
+	if err != nil || s == nil {
+		t.Fatalf("FetchSession of shared session = %v, %v, want a session", s, err)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+// Exposes internals to the tests of the database_test package, the conformance tests live there as
+// the databasetest package depends on this one.
+
+var (
+	SkipWithoutSpannerEmulator = skipWithoutSpannerEmulator
+	CreateSpannerTestDatabase  = createSpannerTestDatabase
+)
+
+// Deletes the data of every table, so each conformance check starts with an empty database.
+func TruncatePostgresTables(dbs *PostgresDBService) error {
+	_, err := dbs.db.Exec("truncate credentials, sessions, operations, host_acls, host_metadata, host_activity, user_roles, api_keys")
+	return err
+}
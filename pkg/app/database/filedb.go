@@ -0,0 +1,385 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/acl"
+	"github.com/google/cloud-android-orchestration/pkg/app/apikey"
+	"github.com/google/cloud-android-orchestration/pkg/app/hostmeta"
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
+	"github.com/google/cloud-android-orchestration/pkg/app/session"
+)
+
+const FileDBType = "File"
+
+type FileConfig struct {
+	// Path of the database file, it's created if it doesn't exist.
+	Path string
+}
+
+// Version of the layout of the database file. Bump it and add a migration from the previous
+// version whenever the layout changes in a way older versions of the file can't be read as is.
+const fileDBSchemaVersion = 1
+
+// Migrations of the raw database file contents, keyed by the schema version they migrate from. Each
+// migration brings the contents to the next version.
+var fileDBMigrations = map[int]func(map[string]json.RawMessage) error{}
+
+// Contents of the database file.
+type fileDBData struct {
+	SchemaVersion int                            `json:"schema_version"`
+	Credentials   map[string][]byte              `json:"credentials"`
+	Sessions      map[string]fileDBSession       `json:"sessions"`
+	Operations    map[string]operation.Operation `json:"operations"`
+	HostACLs      map[string]acl.HostACL         `json:"host_acls"`
+	HostMetadata  map[string]hostmeta.Metadata   `json:"host_metadata"`
+	HostActivity  map[string]hostmeta.Activity   `json:"host_activity"`
+	UserRoles     map[string]string              `json:"user_roles"`
+	APIKeys       map[string]apikey.Key          `json:"api_keys"`
+}
+
+type fileDBSession struct {
+	Session   session.Session `json:"session"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Embedded database persisted to a single file, meant for deployments running on a single machine.
+// Data is kept in memory and the whole file is rewritten atomically after every change, so it's
+// only suitable for small databases. Finished operations are dropped once they are old enough, when
+// the file is loaded or by DeleteFinishedOperations, so they don't grow the file forever.
+type FileDBService struct {
+	*InMemoryDBService
+	path string
+	// Serializes writes to the file so the last snapshot written is always the latest.
+	saveMtx sync.Mutex
+}
+
+func NewFileDBService(path string) (*FileDBService, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing database file path")
+	}
+	dbs := &FileDBService{InMemoryDBService: NewInMemoryDBService(), path: path}
+	data, err := loadFileDB(path)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		dbs.restore(data)
+	}
+	// Writes the file right away, creating it or storing the migrated contents.
+	if err := dbs.save(); err != nil {
+		return nil, err
+	}
+	return dbs, nil
+}
+
+// Returns nil, nil if the file doesn't exist.
+func loadFileDB(path string) (*fileDBData, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database file: %w", err)
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode database file: %w", err)
+	}
+	version := 0
+	if v, ok := raw["schema_version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, fmt.Errorf("invalid database file schema version: %w", err)
+		}
+	}
+	if version > fileDBSchemaVersion {
+		return nil, fmt.Errorf("database file schema version %d is newer than the supported version %d", version, fileDBSchemaVersion)
+	}
+	for ; version < fileDBSchemaVersion; version++ {
+		migrate, ok := fileDBMigrations[version]
+		if !ok {
+			return nil, fmt.Errorf("no migration from database file schema version %d", version)
+		}
+		if err := migrate(raw); err != nil {
+			return nil, fmt.Errorf("failed to migrate database file from schema version %d: %w", version, err)
+		}
+	}
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	data := &fileDBData{}
+	if err := json.Unmarshal(migrated, data); err != nil {
+		return nil, fmt.Errorf("failed to decode database file: %w", err)
+	}
+	return data, nil
+}
+
+func (dbs *FileDBService) restore(data *fileDBData) {
+	m := dbs.InMemoryDBService
+	for k, v := range data.Credentials {
+		m.credentials[k] = v
+	}
+	for k, v := range data.Sessions {
+		m.sessions[k] = memorySession{session: v.Session, updatedAt: v.UpdatedAt}
+	}
+	for k, v := range data.Operations {
+		if !m.isFinishedLongAgo(&v) {
+			m.operations[k] = v
+		}
+	}
+	for k, v := range data.HostACLs {
+		m.acls[k] = v
+	}
+	for k, v := range data.HostMetadata {
+		m.hostMetadata[k] = v
+	}
+	for k, v := range data.HostActivity {
+		m.activity[k] = v
+	}
+	for k, v := range data.UserRoles {
+		m.roles[k] = v
+	}
+	for k, v := range data.APIKeys {
+		m.apiKeys[k] = v
+	}
+}
+
+func (dbs *FileDBService) snapshot() *fileDBData {
+	m := dbs.InMemoryDBService
+	data := &fileDBData{
+		SchemaVersion: fileDBSchemaVersion,
+		Credentials:   make(map[string][]byte),
+		Sessions:      make(map[string]fileDBSession),
+		Operations:    make(map[string]operation.Operation),
+		HostACLs:      make(map[string]acl.HostACL),
+		HostMetadata:  make(map[string]hostmeta.Metadata),
+		HostActivity:  make(map[string]hostmeta.Activity),
+		UserRoles:     make(map[string]string),
+		APIKeys:       make(map[string]apikey.Key),
+	}
+	m.credentialsMtx.Lock()
+	for k, v := range m.credentials {
+		data.Credentials[k] = v
+	}
+	m.credentialsMtx.Unlock()
+	m.sessionsMtx.Lock()
+	for k, v := range m.sessions {
+		data.Sessions[k] = fileDBSession{Session: v.session, UpdatedAt: v.updatedAt}
+	}
+	m.sessionsMtx.Unlock()
+	m.operationsMtx.Lock()
+	for k, v := range m.operations {
+		data.Operations[k] = v
+	}
+	m.operationsMtx.Unlock()
+	m.aclsMtx.Lock()
+	for k, v := range m.acls {
+		data.HostACLs[k] = v
+	}
+	m.aclsMtx.Unlock()
+	m.hostMetadataMtx.Lock()
+	for k, v := range m.hostMetadata {
+		data.HostMetadata[k] = v
+	}
+	m.hostMetadataMtx.Unlock()
+	m.activityMtx.Lock()
+	for k, v := range m.activity {
+		data.HostActivity[k] = v
+	}
+	m.activityMtx.Unlock()
+	m.rolesMtx.Lock()
+	for k, v := range m.roles {
+		data.UserRoles[k] = v
+	}
+	m.rolesMtx.Unlock()
+	m.keysMtx.Lock()
+	for k, v := range m.apiKeys {
+		data.APIKeys[k] = v
+	}
+	m.keysMtx.Unlock()
+	return data
+}
+
+// The file is replaced atomically, a crash never leaves it partially written.
+func (dbs *FileDBService) save() error {
+	dbs.saveMtx.Lock()
+	defer dbs.saveMtx.Unlock()
+	content, err := json.Marshal(dbs.snapshot())
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dbs.path), filepath.Base(dbs.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write database file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write database file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write database file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write database file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dbs.path); err != nil {
+		return fmt.Errorf("failed to write database file: %w", err)
+	}
+	return nil
+}
+
+// Every method modifying the data saves the file before returning.
+
+func (dbs *FileDBService) StoreBuildAPICredentials(username string, credentials []byte) error {
+	if err := dbs.InMemoryDBService.StoreBuildAPICredentials(username, credentials); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) ReplaceBuildAPICredentials(username string, expected, credentials []byte) (bool, error) {
+	replaced, err := dbs.InMemoryDBService.ReplaceBuildAPICredentials(username, expected, credentials)
+	if err != nil || !replaced {
+		return replaced, err
+	}
+	return true, dbs.save()
+}
+
+func (dbs *FileDBService) DeleteBuildAPICredentials(username string) error {
+	if err := dbs.InMemoryDBService.DeleteBuildAPICredentials(username); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) CreateOrUpdateSession(s session.Session) error {
+	if err := dbs.InMemoryDBService.CreateOrUpdateSession(s); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) DeleteSession(key string) error {
+	if err := dbs.InMemoryDBService.DeleteSession(key); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) DeleteExpiredSessions() (int64, error) {
+	count, err := dbs.InMemoryDBService.DeleteExpiredSessions()
+	if err != nil || count == 0 {
+		return count, err
+	}
+	return count, dbs.save()
+}
+
+func (dbs *FileDBService) CreateOrUpdateOperation(op operation.Operation) error {
+	if err := dbs.InMemoryDBService.CreateOrUpdateOperation(op); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) DeleteFinishedOperations() (int64, error) {
+	count, err := dbs.InMemoryDBService.DeleteFinishedOperations()
+	if err != nil || count == 0 {
+		return count, err
+	}
+	return count, dbs.save()
+}
+
+func (dbs *FileDBService) UpdateUnfinishedOperation(op operation.Operation) (bool, error) {
+	updated, err := dbs.InMemoryDBService.UpdateUnfinishedOperation(op)
+	if err != nil || !updated {
+		return updated, err
+	}
+	return true, dbs.save()
+}
+
+func (dbs *FileDBService) StoreHostACL(a acl.HostACL) error {
+	if err := dbs.InMemoryDBService.StoreHostACL(a); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) DeleteHostACL(zone, host string) error {
+	if err := dbs.InMemoryDBService.DeleteHostACL(zone, host); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) StoreHostMetadata(m hostmeta.Metadata) error {
+	if err := dbs.InMemoryDBService.StoreHostMetadata(m); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) DeleteHostMetadata(zone, host string) error {
+	if err := dbs.InMemoryDBService.DeleteHostMetadata(zone, host); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) RecordHostActivity(a hostmeta.Activity) error {
+	if err := dbs.InMemoryDBService.RecordHostActivity(a); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) DeleteHostActivity(zone, host string) error {
+	if err := dbs.InMemoryDBService.DeleteHostActivity(zone, host); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) StoreUserRole(username string, role string) error {
+	if err := dbs.InMemoryDBService.StoreUserRole(username, role); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) StoreAPIKey(k apikey.Key) error {
+	if err := dbs.InMemoryDBService.StoreAPIKey(k); err != nil {
+		return err
+	}
+	return dbs.save()
+}
+
+func (dbs *FileDBService) DeleteAPIKey(id string) error {
+	if err := dbs.InMemoryDBService.DeleteAPIKey(id); err != nil {
+		return err
+	}
+	return dbs.save()
+}
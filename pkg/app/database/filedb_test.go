@@ -0,0 +1,103 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/acl"
+	"github.com/google/cloud-android-orchestration/pkg/app/session"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFileDBPersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	dbs, err := NewFileDBService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbs.StoreBuildAPICredentials("johndoe", []byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbs.CreateOrUpdateSession(session.Session{Key: "bar", OAuth2State: "baz"}); err != nil {
+		t.Fatal(err)
+	}
+	hostACL := acl.HostACL{
+		Zone:    "us-central1-a",
+		Host:    "foo",
+		Owner:   "johndoe",
+		Entries: []acl.Entry{{Principal: "user:janedoe", Role: acl.ViewerRole}},
+	}
+	if err := dbs.StoreHostACL(hostACL); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileDBService(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, _ := reopened.FetchBuildAPICredentials("johndoe")
+	if diff := cmp.Diff([]byte("foo"), creds); diff != "" {
+		t.Errorf("credentials mismatch (-want +got):\n%s", diff)
+	}
+	s, _ := reopened.FetchSession("bar")
+	if diff := cmp.Diff(&session.Session{Key: "bar", OAuth2State: "baz"}, s); diff != "" {
+		t.Errorf("session mismatch (-want +got):\n%s", diff)
+	}
+	gotACL, _ := reopened.FetchHostACL("us-central1-a", "foo")
+	if diff := cmp.Diff(&hostACL, gotACL); diff != "" {
+		t.Errorf("host acl mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFileDBDeletesPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	dbs, err := NewFileDBService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.StoreBuildAPICredentials("johndoe", []byte("foo"))
+	if err := dbs.DeleteBuildAPICredentials("johndoe"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileDBService(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds, _ := reopened.FetchBuildAPICredentials("johndoe"); creds != nil {
+		t.Errorf("expected credentials to be deleted, got: %q", creds)
+	}
+}
+
+func TestFileDBUnsupportedSchemaVersion(t *testing.T) {
+	for _, content := range []string{`{"schema_version": 1000}`, `{}`} {
+		path := filepath.Join(t.TempDir(), "db.json")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := NewFileDBService(path)
+
+		if err == nil {
+			t.Errorf("expected error opening %s", content)
+		}
+	}
+}
@@ -15,57 +15,395 @@
 package database
 
 import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/acl"
+	"github.com/google/cloud-android-orchestration/pkg/app/apikey"
+	"github.com/google/cloud-android-orchestration/pkg/app/hostmeta"
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
 	"github.com/google/cloud-android-orchestration/pkg/app/session"
 )
 
 const InMemoryDBType = "InMemory"
 
-type SpannerConfig struct {
-	DatabaseName string
-}
-
-// Simple in memory database to use for testing or local development.
+// Simple in memory database to use for testing or local development. It's safe for concurrent use.
 type InMemoryDBService struct {
-	credentials map[string][]byte
-	session     session.Session
+	credentialsMtx sync.Mutex
+	credentials    map[string][]byte
+	sessionsMtx    sync.Mutex
+	sessions       map[string]memorySession
+	now            func() time.Time
+	// Operations are updated from background goroutines, hence the need for a lock.
+	operationsMtx sync.Mutex
+	operations    map[string]operation.Operation
+	aclsMtx       sync.Mutex
+	// Keyed by zone and host name.
+	acls            map[string]acl.HostACL
+	hostMetadataMtx sync.Mutex
+	// Keyed by zone and host name.
+	hostMetadata map[string]hostmeta.Metadata
+	activityMtx  sync.Mutex
+	// Keyed by zone and host name.
+	activity map[string]hostmeta.Activity
+	rolesMtx sync.Mutex
+	roles    map[string]string
+	keysMtx  sync.Mutex
+	apiKeys  map[string]apikey.Key
 }
 
 func NewInMemoryDBService() *InMemoryDBService {
 	return &InMemoryDBService{
-		credentials: make(map[string][]byte),
+		credentials:  make(map[string][]byte),
+		sessions:     make(map[string]memorySession),
+		now:          time.Now,
+		operations:   make(map[string]operation.Operation),
+		acls:         make(map[string]acl.HostACL),
+		hostMetadata: make(map[string]hostmeta.Metadata),
+		activity:     make(map[string]hostmeta.Activity),
+		roles:        make(map[string]string),
+		apiKeys:      make(map[string]apikey.Key),
 	}
 }
 
+type memorySession struct {
+	session   session.Session
+	updatedAt time.Time
+}
+
 func (dbs *InMemoryDBService) FetchBuildAPICredentials(username string) ([]byte, error) {
+	dbs.credentialsMtx.Lock()
+	defer dbs.credentialsMtx.Unlock()
 	return dbs.credentials[username], nil
 }
 
 func (dbs *InMemoryDBService) StoreBuildAPICredentials(username string, credentials []byte) error {
+	dbs.credentialsMtx.Lock()
+	defer dbs.credentialsMtx.Unlock()
 	dbs.credentials[username] = credentials
 	return nil
 }
 
+func (dbs *InMemoryDBService) ReplaceBuildAPICredentials(username string, expected, credentials []byte) (bool, error) {
+	dbs.credentialsMtx.Lock()
+	defer dbs.credentialsMtx.Unlock()
+	stored, ok := dbs.credentials[username]
+	if !ok || !bytes.Equal(stored, expected) {
+		return false, nil
+	}
+	dbs.credentials[username] = credentials
+	return true, nil
+}
+
 func (dbs *InMemoryDBService) DeleteBuildAPICredentials(username string) error {
+	dbs.credentialsMtx.Lock()
+	defer dbs.credentialsMtx.Unlock()
 	delete(dbs.credentials, username)
 	return nil
 }
 
+func (dbs *InMemoryDBService) ListBuildAPICredentialsUsernames() ([]string, error) {
+	dbs.credentialsMtx.Lock()
+	defer dbs.credentialsMtx.Unlock()
+	res := []string{}
+	for username := range dbs.credentials {
+		res = append(res, username)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
 func (dbs *InMemoryDBService) CreateOrUpdateSession(s session.Session) error {
-	dbs.session = s
+	dbs.sessionsMtx.Lock()
+	defer dbs.sessionsMtx.Unlock()
+	dbs.sessions[s.Key] = memorySession{session: s, updatedAt: dbs.now()}
 	return nil
 }
 
+// Expired sessions are not returned even if they haven't been deleted yet.
 func (dbs *InMemoryDBService) FetchSession(key string) (*session.Session, error) {
-	if dbs.session.Key != key {
+	dbs.sessionsMtx.Lock()
+	defer dbs.sessionsMtx.Unlock()
+	s, ok := dbs.sessions[key]
+	if !ok || dbs.isExpired(s) {
 		return nil, nil
 	}
-	sessionCopy := dbs.session
+	sessionCopy := s.session
 	return &sessionCopy, nil
 }
 
 func (dbs *InMemoryDBService) DeleteSession(key string) error {
-	if dbs.session.Key == key {
-		dbs.session = session.Session{}
+	dbs.sessionsMtx.Lock()
+	defer dbs.sessionsMtx.Unlock()
+	delete(dbs.sessions, key)
+	return nil
+}
+
+func (dbs *InMemoryDBService) DeleteExpiredSessions() (int64, error) {
+	dbs.sessionsMtx.Lock()
+	defer dbs.sessionsMtx.Unlock()
+	var count int64
+	for key, s := range dbs.sessions {
+		if dbs.isExpired(s) {
+			delete(dbs.sessions, key)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (dbs *InMemoryDBService) isExpired(s memorySession) bool {
+	return dbs.now().Sub(s.updatedAt) >= sessionTTL
+}
+
+func (dbs *InMemoryDBService) CreateOrUpdateOperation(op operation.Operation) error {
+	dbs.operationsMtx.Lock()
+	defer dbs.operationsMtx.Unlock()
+	dbs.operations[op.Name] = op
+	return nil
+}
+
+func (dbs *InMemoryDBService) DeleteFinishedOperations() (int64, error) {
+	dbs.operationsMtx.Lock()
+	defer dbs.operationsMtx.Unlock()
+	var count int64
+	for name, op := range dbs.operations {
+		if dbs.isFinishedLongAgo(&op) {
+			delete(dbs.operations, name)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (dbs *InMemoryDBService) isFinishedLongAgo(op *operation.Operation) bool {
+	return op.Done() && dbs.now().Sub(op.UpdateTime) >= finishedOperationTTL
+}
+
+func (dbs *InMemoryDBService) UpdateUnfinishedOperation(op operation.Operation) (bool, error) {
+	dbs.operationsMtx.Lock()
+	defer dbs.operationsMtx.Unlock()
+	stored, ok := dbs.operations[op.Name]
+	if !ok || stored.Done() {
+		return false, nil
+	}
+	dbs.operations[op.Name] = op
+	return true, nil
+}
+
+func (dbs *InMemoryDBService) FetchOperation(name string) (*operation.Operation, error) {
+	dbs.operationsMtx.Lock()
+	defer dbs.operationsMtx.Unlock()
+	op, ok := dbs.operations[name]
+	if !ok {
+		return nil, nil
+	}
+	return &op, nil
+}
+
+func (dbs *InMemoryDBService) ListOperations(filter operation.Filter) ([]*operation.Operation, error) {
+	dbs.operationsMtx.Lock()
+	defer dbs.operationsMtx.Unlock()
+	res := []*operation.Operation{}
+	for _, op := range dbs.operations {
+		op := op
+		if filter.Matches(&op) {
+			res = append(res, &op)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreateTime.Before(res[j].CreateTime) })
+	return res, nil
+}
+
+func (dbs *InMemoryDBService) StoreHostACL(a acl.HostACL) error {
+	dbs.aclsMtx.Lock()
+	defer dbs.aclsMtx.Unlock()
+	a.Entries = append([]acl.Entry{}, a.Entries...)
+	dbs.acls[hostKey(a.Zone, a.Host)] = a
+	return nil
+}
+
+func (dbs *InMemoryDBService) FetchHostACL(zone, host string) (*acl.HostACL, error) {
+	dbs.aclsMtx.Lock()
+	defer dbs.aclsMtx.Unlock()
+	a, ok := dbs.acls[hostKey(zone, host)]
+	if !ok {
+		return nil, nil
+	}
+	a.Entries = append([]acl.Entry{}, a.Entries...)
+	return &a, nil
+}
+
+func (dbs *InMemoryDBService) DeleteHostACL(zone, host string) error {
+	dbs.aclsMtx.Lock()
+	defer dbs.aclsMtx.Unlock()
+	delete(dbs.acls, hostKey(zone, host))
+	return nil
+}
+
+func (dbs *InMemoryDBService) ListHostACLs(filter acl.Filter) ([]*acl.HostACL, error) {
+	dbs.aclsMtx.Lock()
+	defer dbs.aclsMtx.Unlock()
+	res := []*acl.HostACL{}
+	for _, a := range dbs.acls {
+		a := a
+		if filter.Matches(&a) {
+			a.Entries = append([]acl.Entry{}, a.Entries...)
+			res = append(res, &a)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Host < res[j].Host })
+	return res, nil
+}
+
+func (dbs *InMemoryDBService) StoreHostMetadata(m hostmeta.Metadata) error {
+	dbs.hostMetadataMtx.Lock()
+	defer dbs.hostMetadataMtx.Unlock()
+	m.Labels = copyLabels(m.Labels)
+	dbs.hostMetadata[hostKey(m.Zone, m.Host)] = m
+	return nil
+}
+
+func (dbs *InMemoryDBService) FetchHostMetadata(zone, host string) (*hostmeta.Metadata, error) {
+	dbs.hostMetadataMtx.Lock()
+	defer dbs.hostMetadataMtx.Unlock()
+	m, ok := dbs.hostMetadata[hostKey(zone, host)]
+	if !ok {
+		return nil, nil
 	}
+	m.Labels = copyLabels(m.Labels)
+	return &m, nil
+}
+
+func (dbs *InMemoryDBService) DeleteHostMetadata(zone, host string) error {
+	dbs.hostMetadataMtx.Lock()
+	defer dbs.hostMetadataMtx.Unlock()
+	delete(dbs.hostMetadata, hostKey(zone, host))
+	return nil
+}
+
+func (dbs *InMemoryDBService) ListHostMetadata(zone string) ([]*hostmeta.Metadata, error) {
+	dbs.hostMetadataMtx.Lock()
+	defer dbs.hostMetadataMtx.Unlock()
+	res := []*hostmeta.Metadata{}
+	for _, m := range dbs.hostMetadata {
+		m := m
+		if m.Zone == zone {
+			m.Labels = copyLabels(m.Labels)
+			res = append(res, &m)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Host < res[j].Host })
+	return res, nil
+}
+
+func (dbs *InMemoryDBService) RecordHostActivity(a hostmeta.Activity) error {
+	dbs.activityMtx.Lock()
+	defer dbs.activityMtx.Unlock()
+	key := hostKey(a.Zone, a.Host)
+	if stored, ok := dbs.activity[key]; ok && stored.LastActive.After(a.LastActive) {
+		return nil
+	}
+	dbs.activity[key] = a
+	return nil
+}
+
+func (dbs *InMemoryDBService) FetchHostActivity(zone, host string) (*hostmeta.Activity, error) {
+	dbs.activityMtx.Lock()
+	defer dbs.activityMtx.Unlock()
+	a, ok := dbs.activity[hostKey(zone, host)]
+	if !ok {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+func (dbs *InMemoryDBService) ListHostActivity() ([]*hostmeta.Activity, error) {
+	dbs.activityMtx.Lock()
+	defer dbs.activityMtx.Unlock()
+	res := []*hostmeta.Activity{}
+	for _, a := range dbs.activity {
+		a := a
+		res = append(res, &a)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Zone != res[j].Zone {
+			return res[i].Zone < res[j].Zone
+		}
+		return res[i].Host < res[j].Host
+	})
+	return res, nil
+}
+
+func (dbs *InMemoryDBService) DeleteHostActivity(zone, host string) error {
+	dbs.activityMtx.Lock()
+	defer dbs.activityMtx.Unlock()
+	delete(dbs.activity, hostKey(zone, host))
 	return nil
 }
+
+func (dbs *InMemoryDBService) FetchUserRole(username string) (string, error) {
+	dbs.rolesMtx.Lock()
+	defer dbs.rolesMtx.Unlock()
+	return dbs.roles[username], nil
+}
+
+func (dbs *InMemoryDBService) StoreUserRole(username string, role string) error {
+	dbs.rolesMtx.Lock()
+	defer dbs.rolesMtx.Unlock()
+	dbs.roles[username] = role
+	return nil
+}
+
+func (dbs *InMemoryDBService) StoreAPIKey(k apikey.Key) error {
+	dbs.keysMtx.Lock()
+	defer dbs.keysMtx.Unlock()
+	dbs.apiKeys[k.ID] = k
+	return nil
+}
+
+func (dbs *InMemoryDBService) FetchAPIKey(id string) (*apikey.Key, error) {
+	dbs.keysMtx.Lock()
+	defer dbs.keysMtx.Unlock()
+	k, ok := dbs.apiKeys[id]
+	if !ok {
+		return nil, nil
+	}
+	return &k, nil
+}
+
+func (dbs *InMemoryDBService) ListAPIKeys() ([]*apikey.Key, error) {
+	dbs.keysMtx.Lock()
+	defer dbs.keysMtx.Unlock()
+	res := []*apikey.Key{}
+	for _, k := range dbs.apiKeys {
+		k := k
+		res = append(res, &k)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreateTime.Before(res[j].CreateTime) })
+	return res, nil
+}
+
+func (dbs *InMemoryDBService) DeleteAPIKey(id string) error {
+	dbs.keysMtx.Lock()
+	defer dbs.keysMtx.Unlock()
+	delete(dbs.apiKeys, id)
+	return nil
+}
+
+func hostKey(zone, host string) string {
+	return zone + "/" + host
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	res := make(map[string]string, len(labels))
+	for k, v := range labels {
+		res[k] = v
+	}
+	return res
+}
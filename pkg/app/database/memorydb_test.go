@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
+	"github.com/google/cloud-android-orchestration/pkg/app/session"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestInMemorySessionsConcurrentUsers(t *testing.T) {
+	dbs := NewInMemoryDBService()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := session.Session{Key: fmt.Sprintf("key-%d", i), OAuth2State: fmt.Sprintf("state-%d", i)}
+			if err := dbs.CreateOrUpdateSession(s); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 10; i++ {
+		got, err := dbs.FetchSession(fmt.Sprintf("key-%d", i))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := &session.Session{Key: fmt.Sprintf("key-%d", i), OAuth2State: fmt.Sprintf("state-%d", i)}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("session mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestInMemorySessionsExpire(t *testing.T) {
+	dbs := NewInMemoryDBService()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dbs.now = func() time.Time { return now }
+	dbs.CreateOrUpdateSession(session.Session{Key: "old"})
+	now = now.Add(time.Hour)
+	dbs.CreateOrUpdateSession(session.Session{Key: "new"})
+	now = now.Add(sessionTTL - time.Hour)
+
+	old, _ := dbs.FetchSession("old")
+	count, err := dbs.DeleteExpiredSessions()
+
+	if old != nil {
+		t.Errorf("expected expired session not to be returned, got: %+v", old)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(int64(1), count); diff != "" {
+		t.Errorf("deleted sessions mismatch (-want +got):\n%s", diff)
+	}
+	if s, _ := dbs.FetchSession("new"); s == nil {
+		t.Error("expected valid session to be kept")
+	}
+}
+
+func TestInMemoryDeleteFinishedOperations(t *testing.T) {
+	dbs := NewInMemoryDBService()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dbs.now = func() time.Time { return now.Add(finishedOperationTTL) }
+	dbs.CreateOrUpdateOperation(operation.Operation{Name: "old", State: operation.DoneState, UpdateTime: now})
+	dbs.CreateOrUpdateOperation(operation.Operation{Name: "recent", State: operation.ErrorState, UpdateTime: now.Add(time.Hour)})
+	dbs.CreateOrUpdateOperation(operation.Operation{Name: "running", State: operation.RunningState, UpdateTime: now})
+
+	count, err := dbs.DeleteFinishedOperations()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(int64(1), count); diff != "" {
+		t.Errorf("deleted operations mismatch (-want +got):\n%s", diff)
+	}
+	ops, _ := dbs.ListOperations(operation.Filter{})
+	var got []string
+	for _, op := range ops {
+		got = append(got, op.Name)
+	}
+	if diff := cmp.Diff([]string{"recent", "running"}, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Errorf("operations mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -15,19 +15,36 @@
 package database
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
+	"github.com/google/cloud-android-orchestration/pkg/app/acl"
+	"github.com/google/cloud-android-orchestration/pkg/app/apikey"
+	"github.com/google/cloud-android-orchestration/pkg/app/hostmeta"
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
 	"github.com/google/cloud-android-orchestration/pkg/app/session"
 
 	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 )
 
 const SpannerDBType = "Spanner"
 
+type SpannerConfig struct {
+	DatabaseName string
+	// Limits of the client session pool, the client library defaults are used if zero.
+	MinOpenedSessions uint64
+	MaxOpenedSessions uint64
+	// Timeout of each database request, defaults to 30 seconds if zero.
+	RequestTimeoutSeconds int
+}
+
+const defaultSpannerRequestTimeout = 30 * time.Second
+
 const (
 	credentialsTable  = "Credentials"
 	usernameColumn    = "username"
@@ -38,9 +55,96 @@ const (
 	sessionOAuth2StateColumn = "oauth2_state"
 	sessionAccessColumn      = "accessed_at"
 
-	sessionStateValidityHours = 48
+	operationsTable           = "Operations"
+	operationNameColumn       = "name"
+	operationTypeColumn       = "type"
+	operationUsernameColumn   = "username"
+	operationHostColumn       = "host"
+	operationStateColumn      = "state"
+	operationCreateTimeColumn = "create_time"
+	operationUpdateTimeColumn = "update_time"
+	operationResultColumn     = "result"
+	operationErrorCodeColumn  = "error_code"
+	operationErrorMsgColumn   = "error_msg"
+
+	hostACLsTable          = "HostACLs"
+	hostACLZoneColumn      = "zone"
+	hostACLHostColumn      = "host"
+	hostACLPrincipalColumn = "principal"
+	hostACLOwnerColumn     = "owner"
+	hostACLRoleColumn      = "role"
+
+	hostMetadataTable            = "HostMetadata"
+	hostMetadataZoneColumn       = "zone"
+	hostMetadataHostColumn       = "host"
+	hostMetadataOwnerColumn      = "owner"
+	hostMetadataLabelsColumn     = "labels"
+	hostMetadataExpireTimeColumn = "expire_time"
+
+	hostActivityTable            = "HostActivity"
+	hostActivityZoneColumn       = "zone"
+	hostActivityHostColumn       = "host"
+	hostActivityLastActiveColumn = "last_active"
+
+	userRolesTable         = "UserRoles"
+	userRoleUsernameColumn = "username"
+	userRoleRoleColumn     = "role"
+
+	apiKeysTable           = "APIKeys"
+	apiKeyIDColumn         = "id"
+	apiKeyNameColumn       = "name"
+	apiKeyIdentityColumn   = "identity"
+	apiKeySecretHashColumn = "secret_hash"
+	apiKeyCreatedByColumn  = "created_by"
+	apiKeyCreateTimeColumn = "create_time"
+	apiKeyExpireTimeColumn = "expire_time"
 )
 
+var operationColumns = []string{
+	operationNameColumn,
+	operationTypeColumn,
+	operationUsernameColumn,
+	operationHostColumn,
+	operationStateColumn,
+	operationCreateTimeColumn,
+	operationUpdateTimeColumn,
+	operationResultColumn,
+	operationErrorCodeColumn,
+	operationErrorMsgColumn,
+}
+
+var apiKeyColumns = []string{
+	apiKeyIDColumn,
+	apiKeyNameColumn,
+	apiKeyIdentityColumn,
+	apiKeySecretHashColumn,
+	apiKeyCreatedByColumn,
+	apiKeyCreateTimeColumn,
+	apiKeyExpireTimeColumn,
+}
+
+var hostACLColumns = []string{
+	hostACLZoneColumn,
+	hostACLHostColumn,
+	hostACLPrincipalColumn,
+	hostACLOwnerColumn,
+	hostACLRoleColumn,
+}
+
+var hostMetadataColumns = []string{
+	hostMetadataZoneColumn,
+	hostMetadataHostColumn,
+	hostMetadataOwnerColumn,
+	hostMetadataLabelsColumn,
+	hostMetadataExpireTimeColumn,
+}
+
+var hostActivityColumns = []string{
+	hostActivityZoneColumn,
+	hostActivityHostColumn,
+	hostActivityLastActiveColumn,
+}
+
 // A database service that works with a Cloud Spanner database with the following schema:
 //
 //	table Credentials {
@@ -52,23 +156,95 @@ const (
 //	  oauth2_state string
 //	  accessed_at timestamp
 //	}
+//	table Operations {
+//	  name string primary key
+//	  type string
+//	  username string
+//	  host string
+//	  state string
+//	  create_time timestamp
+//	  update_time timestamp
+//	  result byte array # JSON encoded operation response
+//	  error_code int64
+//	  error_msg string
+//	}
+//	table HostACLs {
+//	  zone string primary key
+//	  host string primary key
+//	  principal string primary key
+//	  owner string
+//	  role string
+//	}
+//	table HostMetadata {
+//	  zone string primary key
+//	  host string primary key
+//	  owner string
+//	  labels string # JSON encoded user labels
+//	  expire_time timestamp # null if the host never expires
+//	}
+//	table HostActivity {
+//	  zone string primary key
+//	  host string primary key
+//	  last_active timestamp
+//	}
+//	table UserRoles {
+//	  username string primary key
+//	  role string
+//	}
+//	table APIKeys {
+//	  id string primary key
+//	  name string
+//	  identity string
+//	  secret_hash byte array # SHA-256 hash of the secret
+//	  created_by string
+//	  create_time timestamp
+//	  expire_time timestamp # null if the key never expires
+//	}
+//
+// A single client is shared by all requests so they reuse the sessions of its pool.
 type SpannerDBService struct {
-	db string
-}
-
-func NewSpannerDBService(db string) *SpannerDBService {
-	return &SpannerDBService{db}
+	client  *spanner.Client
+	timeout time.Duration
 }
 
-func (dbs *SpannerDBService) FetchBuildAPICredentials(username string) ([]byte, error) {
-	ctx := context.TODO()
-	client, err := spanner.NewClient(ctx, dbs.db)
+func NewSpannerDBService(cfg SpannerConfig) (*SpannerDBService, error) {
+	poolConfig := spanner.DefaultSessionPoolConfig
+	if cfg.MinOpenedSessions > 0 {
+		poolConfig.MinOpened = cfg.MinOpenedSessions
+	}
+	if cfg.MaxOpenedSessions > 0 {
+		poolConfig.MaxOpened = cfg.MaxOpenedSessions
+	}
+	if poolConfig.MinOpened > poolConfig.MaxOpened {
+		return nil, fmt.Errorf("invalid session pool config: min opened sessions %d exceeds max opened sessions %d",
+			poolConfig.MinOpened, poolConfig.MaxOpened)
+	}
+	clientConfig := spanner.ClientConfig{SessionPoolConfig: poolConfig}
+	client, err := spanner.NewClientWithConfig(context.Background(), cfg.DatabaseName, clientConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create db client: %w", err)
 	}
-	defer client.Close()
+	timeout := defaultSpannerRequestTimeout
+	if cfg.RequestTimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.RequestTimeoutSeconds) * time.Second
+	}
+	return &SpannerDBService{client: client, timeout: timeout}, nil
+}
+
+// Closes the client, releasing the sessions of the pool.
+func (dbs *SpannerDBService) Close() error {
+	dbs.client.Close()
+	return nil
+}
+
+func (dbs *SpannerDBService) requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), dbs.timeout)
+}
 
-	row, err := client.Single().ReadRow(ctx, credentialsTable, spanner.Key{username}, []string{credentialsColumn})
+func (dbs *SpannerDBService) FetchBuildAPICredentials(username string) ([]byte, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	row, err := dbs.client.Single().ReadRow(ctx, credentialsTable, spanner.Key{username}, []string{credentialsColumn})
 	if err != nil {
 		if spanner.ErrCode(err) == codes.NotFound {
 			// Not found is not an error
@@ -83,30 +259,53 @@ func (dbs *SpannerDBService) FetchBuildAPICredentials(username string) ([]byte,
 }
 
 func (dbs *SpannerDBService) StoreBuildAPICredentials(username string, credentials []byte) error {
-	ctx := context.TODO()
-	client, err := spanner.NewClient(ctx, dbs.db)
-	if err != nil {
-		return err
-	}
-	defer client.Close()
-
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
 	columns := []string{usernameColumn, credentialsColumn}
 	mutations := []*spanner.Mutation{
 		spanner.InsertOrUpdate(credentialsTable, columns, []interface{}{username, credentials}),
 	}
-	_, err = client.Apply(ctx, mutations)
+	_, err := dbs.client.Apply(ctx, mutations)
 	return err
 }
 
-func (dbs *SpannerDBService) DeleteBuildAPICredentials(username string) error {
-	ctx := context.TODO()
-	client, err := spanner.NewClient(ctx, dbs.db)
+func (dbs *SpannerDBService) ReplaceBuildAPICredentials(username string, expected, credentials []byte) (bool, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	replaced := false
+	_, err := dbs.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		// The transaction function may be retried.
+		replaced = false
+		row, err := txn.ReadRow(ctx, credentialsTable, spanner.Key{username}, []string{credentialsColumn})
+		if spanner.ErrCode(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var stored []byte
+		if err := row.Column(0, &stored); err != nil {
+			return err
+		}
+		if !bytes.Equal(stored, expected) {
+			return nil
+		}
+		columns := []string{usernameColumn, credentialsColumn}
+		mutation := spanner.Update(credentialsTable, columns, []interface{}{username, credentials})
+		replaced = true
+		return txn.BufferWrite([]*spanner.Mutation{mutation})
+	})
 	if err != nil {
-		return err
+		return false, fmt.Errorf("failed to replace credentials: %w", err)
 	}
-	defer client.Close()
+	return replaced, nil
+}
+
+func (dbs *SpannerDBService) DeleteBuildAPICredentials(username string) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
 	mutation := spanner.Delete(credentialsTable, spanner.KeySetFromKeys(spanner.Key{username}))
-	_, err = client.Apply(ctx, []*spanner.Mutation{mutation})
+	_, err := dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
 	if spanner.ErrCode(err) == codes.NotFound {
 		// Not an error if not found
 		return nil
@@ -114,28 +313,46 @@ func (dbs *SpannerDBService) DeleteBuildAPICredentials(username string) error {
 	return err
 }
 
-func (dbs *SpannerDBService) CreateOrUpdateSession(s session.Session) error {
-	ctx := context.TODO()
-	client, err := spanner.NewClient(ctx, dbs.db)
-	if err != nil {
-		return err
+func (dbs *SpannerDBService) ListBuildAPICredentialsUsernames() ([]string, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf("select %[1]s from %[2]s order by %[1]s", usernameColumn, credentialsTable),
+	}
+	iter := dbs.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+	res := []string{}
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list credentials: %w", err)
+		}
+		var username string
+		if err := row.Column(0, &username); err != nil {
+			return nil, err
+		}
+		res = append(res, username)
 	}
-	defer client.Close()
+	return res, nil
+}
+
+func (dbs *SpannerDBService) CreateOrUpdateSession(s session.Session) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
 	columns := []string{sessionKeyColumn, sessionOAuth2StateColumn, sessionAccessColumn}
 	mutation := spanner.InsertOrUpdate(sessionsTable, columns, []interface{}{s.Key, s.OAuth2State, time.Now()})
-	_, err = client.Apply(ctx, []*spanner.Mutation{mutation})
-	go dbs.deleteExpiredSessions()
+	_, err := dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
 	return err
 }
 
 func (dbs *SpannerDBService) FetchSession(key string) (*session.Session, error) {
-	ctx := context.TODO()
-	client, err := spanner.NewClient(ctx, dbs.db)
-	if err != nil {
-		return nil, err
-	}
-	defer client.Close()
-	row, err := client.Single().ReadRow(ctx, sessionsTable, spanner.Key{key}, []string{sessionKeyColumn, sessionOAuth2StateColumn})
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	columns := []string{sessionKeyColumn, sessionOAuth2StateColumn, sessionAccessColumn}
+	row, err := dbs.client.Single().ReadRow(ctx, sessionsTable, spanner.Key{key}, columns)
 	if err != nil {
 		if spanner.ErrCode(err) == codes.NotFound {
 			// Not found is not an error
@@ -143,6 +360,14 @@ func (dbs *SpannerDBService) FetchSession(key string) (*session.Session, error)
 		}
 		return nil, fmt.Errorf("failed to retrieve session: %w", err)
 	}
+	var accessedAt time.Time
+	if err := row.ColumnByName(sessionAccessColumn, &accessedAt); err != nil {
+		return nil, err
+	}
+	// Expired sessions may not have been deleted yet.
+	if time.Since(accessedAt) >= sessionTTL {
+		return nil, nil
+	}
 	session := &session.Session{
 		Key:         key,
 		OAuth2State: "",
@@ -158,14 +383,10 @@ func (dbs *SpannerDBService) FetchSession(key string) (*session.Session, error)
 }
 
 func (dbs *SpannerDBService) DeleteSession(key string) error {
-	ctx := context.TODO()
-	client, err := spanner.NewClient(ctx, dbs.db)
-	if err != nil {
-		return err
-	}
-	defer client.Close()
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
 	mutation := spanner.Delete(sessionsTable, spanner.KeySetFromKeys(spanner.Key{key}))
-	_, err = client.Apply(ctx, []*spanner.Mutation{mutation})
+	_, err := dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
 	if spanner.ErrCode(err) == codes.NotFound {
 		// Not an error if not found
 		return nil
@@ -173,30 +394,549 @@ func (dbs *SpannerDBService) DeleteSession(key string) error {
 	return err
 }
 
-// TODO(jemoreira): Remove once sessions are used for more than just storing oauth2 states.
-func (dbs *SpannerDBService) deleteExpiredSessions() {
-	ctx := context.TODO()
-	client, err := spanner.NewClient(ctx, dbs.db)
-	if err != nil {
-		log.Println("Failed to create db client to delete expired sessions")
-		return
-	}
-	defer client.Close()
-	_, err = client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+func (dbs *SpannerDBService) CreateOrUpdateOperation(op operation.Operation) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	mutation := spanner.InsertOrUpdate(operationsTable, operationColumns, operationValues(op))
+	_, err := dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
+	return err
+}
+
+func (dbs *SpannerDBService) DeleteFinishedOperations() (int64, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	var rowCount int64
+	_, err := dbs.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
 		stmt := spanner.Statement{
-			SQL: fmt.Sprintf("delete from %s where %s < @threshold", sessionsTable, sessionAccessColumn),
+			SQL: fmt.Sprintf("delete from %s where %s <= @threshold and %s in unnest(@states)",
+				operationsTable, operationUpdateTimeColumn, operationStateColumn),
 			Params: map[string]interface{}{
-				"threshold": time.Now().Add(-sessionStateValidityHours * time.Hour),
+				"threshold": time.Now().Add(-finishedOperationTTL),
+				"states": []string{
+					string(operation.DoneState), string(operation.ErrorState), string(operation.CancelledState),
+				},
 			},
 		}
-		rowCount, err := txn.Update(ctx, stmt)
+		var err error
+		rowCount, err = txn.Update(ctx, stmt)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete finished operations: %w", err)
+	}
+	return rowCount, nil
+}
+
+func (dbs *SpannerDBService) UpdateUnfinishedOperation(op operation.Operation) (bool, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	var updated bool
+	_, err := dbs.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		updated = false
+		row, err := txn.ReadRow(ctx, operationsTable, spanner.Key{op.Name}, operationColumns)
+		if spanner.ErrCode(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stored, err := operationFromRow(row)
 		if err != nil {
 			return err
 		}
-		log.Printf("%d expired session(s) deleted.\n", rowCount)
+		if stored.Done() {
+			return nil
+		}
+		mutation := spanner.Update(operationsTable, operationColumns, operationValues(op))
+		if err := txn.BufferWrite([]*spanner.Mutation{mutation}); err != nil {
+			return err
+		}
+		updated = true
 		return nil
 	})
 	if err != nil {
-		log.Println("Failed to delete expired sessions: ", err)
+		return false, fmt.Errorf("failed to update operation: %w", err)
+	}
+	return updated, nil
+}
+
+func operationValues(op operation.Operation) []interface{} {
+	return []interface{}{
+		op.Name,
+		op.Type,
+		op.Username,
+		op.Host,
+		string(op.State),
+		op.CreateTime,
+		op.UpdateTime,
+		op.Result,
+		int64(op.ErrorCode),
+		op.ErrorMsg,
+	}
+}
+
+func (dbs *SpannerDBService) FetchOperation(name string) (*operation.Operation, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	row, err := dbs.client.Single().ReadRow(ctx, operationsTable, spanner.Key{name}, operationColumns)
+	if err != nil {
+		if spanner.ErrCode(err) == codes.NotFound {
+			// Not found is not an error
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve operation: %w", err)
+	}
+	return operationFromRow(row)
+}
+
+func (dbs *SpannerDBService) ListOperations(filter operation.Filter) ([]*operation.Operation, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	conditions := []string{"true"}
+	params := map[string]interface{}{}
+	if filter.Username != "" {
+		conditions = append(conditions, operationUsernameColumn+" = @username")
+		params["username"] = filter.Username
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, operationTypeColumn+" = @type")
+		params["type"] = filter.Type
+	}
+	if filter.Host != "" {
+		conditions = append(conditions, operationHostColumn+" = @host")
+		params["host"] = filter.Host
+	}
+	if filter.State != "" {
+		conditions = append(conditions, operationStateColumn+" = @state")
+		params["state"] = string(filter.State)
+	}
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf("select %s from %s where %s order by %s",
+			strings.Join(operationColumns, ", "), operationsTable, strings.Join(conditions, " and "),
+			operationCreateTimeColumn),
+		Params: params,
+	}
+	iter := dbs.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+	res := []*operation.Operation{}
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list operations: %w", err)
+		}
+		op, err := operationFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, op)
+	}
+	return res, nil
+}
+
+func operationFromRow(row *spanner.Row) (*operation.Operation, error) {
+	var (
+		name, opType, state      string
+		username, host, errorMsg spanner.NullString
+		createTime, updateTime   time.Time
+		result                   []byte
+		errorCode                spanner.NullInt64
+	)
+	err := row.Columns(&name, &opType, &username, &host, &state, &createTime, &updateTime, &result, &errorCode, &errorMsg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode operation: %w", err)
+	}
+	return &operation.Operation{
+		Name:       name,
+		Type:       opType,
+		Username:   username.StringVal,
+		Host:       host.StringVal,
+		State:      operation.State(state),
+		CreateTime: createTime,
+		UpdateTime: updateTime,
+		Result:     result,
+		ErrorCode:  int(errorCode.Int64),
+		ErrorMsg:   errorMsg.StringVal,
+	}, nil
+}
+
+func (dbs *SpannerDBService) StoreHostACL(a acl.HostACL) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	// Mutations are applied atomically and in order, entries no longer in the list are removed.
+	mutations := []*spanner.Mutation{
+		spanner.Delete(hostACLsTable, spanner.Key{a.Zone, a.Host}.AsPrefix()),
+	}
+	for _, e := range a.Entries {
+		values := []interface{}{a.Zone, a.Host, e.Principal, a.Owner, string(e.Role)}
+		mutations = append(mutations, spanner.Insert(hostACLsTable, hostACLColumns, values))
+	}
+	_, err := dbs.client.Apply(ctx, mutations)
+	return err
+}
+
+func (dbs *SpannerDBService) FetchHostACL(zone, host string) (*acl.HostACL, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	iter := dbs.client.Single().Read(ctx, hostACLsTable, spanner.Key{zone, host}.AsPrefix(), hostACLColumns)
+	acls, err := hostACLsFromRows(iter)
+	if err != nil {
+		return nil, err
+	}
+	if len(acls) == 0 {
+		return nil, nil
+	}
+	return acls[0], nil
+}
+
+func (dbs *SpannerDBService) DeleteHostACL(zone, host string) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	mutation := spanner.Delete(hostACLsTable, spanner.Key{zone, host}.AsPrefix())
+	_, err := dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
+	return err
+}
+
+func (dbs *SpannerDBService) ListHostACLs(filter acl.Filter) ([]*acl.HostACL, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	conditions := []string{hostACLPrincipalColumn + " in unnest(@principals)"}
+	params := map[string]interface{}{"principals": filter.Principals}
+	if filter.Zone != "" {
+		conditions = append(conditions, hostACLZoneColumn+" = @zone")
+		params["zone"] = filter.Zone
+	}
+	columns := []string{}
+	for _, c := range hostACLColumns {
+		columns = append(columns, "a."+c)
+	}
+	// The whole list of every matching host is returned, not only the matching entries.
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf("select %[1]s from %[2]s a join (select distinct %[3]s, %[4]s from %[2]s where %[5]s) m "+
+			"on a.%[3]s = m.%[3]s and a.%[4]s = m.%[4]s order by a.%[3]s, a.%[4]s",
+			strings.Join(columns, ", "), hostACLsTable, hostACLZoneColumn, hostACLHostColumn,
+			strings.Join(conditions, " and ")),
+		Params: params,
+	}
+	return hostACLsFromRows(dbs.client.Single().Query(ctx, stmt))
+}
+
+func (dbs *SpannerDBService) StoreHostMetadata(m hostmeta.Metadata) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	labels, err := encodeHostLabels(m.Labels)
+	if err != nil {
+		return err
+	}
+	expireTime := spanner.NullTime{Time: m.ExpireTime, Valid: !m.ExpireTime.IsZero()}
+	values := []interface{}{m.Zone, m.Host, m.Owner, labels, expireTime}
+	mutation := spanner.InsertOrUpdate(hostMetadataTable, hostMetadataColumns, values)
+	_, err = dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
+	return err
+}
+
+func (dbs *SpannerDBService) FetchHostMetadata(zone, host string) (*hostmeta.Metadata, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	row, err := dbs.client.Single().ReadRow(ctx, hostMetadataTable, spanner.Key{zone, host}, hostMetadataColumns)
+	if err != nil {
+		if spanner.ErrCode(err) == codes.NotFound {
+			// Not found is not an error
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve host metadata: %w", err)
+	}
+	return hostMetadataFromRow(row)
+}
+
+func (dbs *SpannerDBService) DeleteHostMetadata(zone, host string) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	mutation := spanner.Delete(hostMetadataTable, spanner.KeySetFromKeys(spanner.Key{zone, host}))
+	_, err := dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
+	return err
+}
+
+func (dbs *SpannerDBService) ListHostMetadata(zone string) ([]*hostmeta.Metadata, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	// Rows are read in primary key order, so they are sorted by host.
+	iter := dbs.client.Single().Read(ctx, hostMetadataTable, spanner.Key{zone}.AsPrefix(), hostMetadataColumns)
+	defer iter.Stop()
+	res := []*hostmeta.Metadata{}
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list host metadata: %w", err)
+		}
+		m, err := hostMetadataFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+func hostMetadataFromRow(row *spanner.Row) (*hostmeta.Metadata, error) {
+	var (
+		zone, host, owner, labels string
+		expireTime                spanner.NullTime
+	)
+	if err := row.Columns(&zone, &host, &owner, &labels, &expireTime); err != nil {
+		return nil, fmt.Errorf("failed to decode host metadata: %w", err)
+	}
+	decoded, err := decodeHostLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+	m := &hostmeta.Metadata{
+		Zone:   zone,
+		Host:   host,
+		Owner:  owner,
+		Labels: decoded,
+	}
+	if expireTime.Valid {
+		m.ExpireTime = expireTime.Time
+	}
+	return m, nil
+}
+
+func (dbs *SpannerDBService) RecordHostActivity(a hostmeta.Activity) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	_, err := dbs.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		columns := []string{hostActivityLastActiveColumn}
+		row, err := txn.ReadRow(ctx, hostActivityTable, spanner.Key{a.Zone, a.Host}, columns)
+		switch {
+		case spanner.ErrCode(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			var lastActive time.Time
+			if err := row.Column(0, &lastActive); err != nil {
+				return err
+			}
+			if lastActive.After(a.LastActive) {
+				return nil
+			}
+		}
+		values := []interface{}{a.Zone, a.Host, a.LastActive}
+		mutation := spanner.InsertOrUpdate(hostActivityTable, hostActivityColumns, values)
+		return txn.BufferWrite([]*spanner.Mutation{mutation})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record host activity: %w", err)
+	}
+	return nil
+}
+
+func (dbs *SpannerDBService) FetchHostActivity(zone, host string) (*hostmeta.Activity, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	row, err := dbs.client.Single().ReadRow(ctx, hostActivityTable, spanner.Key{zone, host}, hostActivityColumns)
+	if err != nil {
+		if spanner.ErrCode(err) == codes.NotFound {
+			// Not found is not an error
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve host activity: %w", err)
+	}
+	var a hostmeta.Activity
+	if err := row.Columns(&a.Zone, &a.Host, &a.LastActive); err != nil {
+		return nil, fmt.Errorf("failed to decode host activity: %w", err)
+	}
+	return &a, nil
+}
+
+func (dbs *SpannerDBService) ListHostActivity() ([]*hostmeta.Activity, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	// Rows are read in primary key order, so they are sorted by zone and host.
+	iter := dbs.client.Single().Read(ctx, hostActivityTable, spanner.AllKeys(), hostActivityColumns)
+	defer iter.Stop()
+	res := []*hostmeta.Activity{}
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list host activity: %w", err)
+		}
+		var a hostmeta.Activity
+		if err := row.Columns(&a.Zone, &a.Host, &a.LastActive); err != nil {
+			return nil, fmt.Errorf("failed to decode host activity: %w", err)
+		}
+		res = append(res, &a)
+	}
+	return res, nil
+}
+
+func (dbs *SpannerDBService) DeleteHostActivity(zone, host string) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	mutation := spanner.Delete(hostActivityTable, spanner.KeySetFromKeys(spanner.Key{zone, host}))
+	_, err := dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
+	return err
+}
+
+func (dbs *SpannerDBService) FetchUserRole(username string) (string, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	row, err := dbs.client.Single().ReadRow(ctx, userRolesTable, spanner.Key{username}, []string{userRoleRoleColumn})
+	if err != nil {
+		if spanner.ErrCode(err) == codes.NotFound {
+			// Not found is not an error
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to retrieve user role: %w", err)
+	}
+	var role string
+	err = row.Column(0, &role)
+	return role, err
+}
+
+func (dbs *SpannerDBService) StoreUserRole(username string, role string) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	columns := []string{userRoleUsernameColumn, userRoleRoleColumn}
+	mutation := spanner.InsertOrUpdate(userRolesTable, columns, []interface{}{username, role})
+	_, err := dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
+	return err
+}
+
+func (dbs *SpannerDBService) StoreAPIKey(k apikey.Key) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	expireTime := spanner.NullTime{Time: k.ExpireTime, Valid: !k.ExpireTime.IsZero()}
+	values := []interface{}{k.ID, k.Name, k.Identity, k.SecretHash, k.CreatedBy, k.CreateTime, expireTime}
+	mutation := spanner.InsertOrUpdate(apiKeysTable, apiKeyColumns, values)
+	_, err := dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
+	return err
+}
+
+func (dbs *SpannerDBService) FetchAPIKey(id string) (*apikey.Key, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	row, err := dbs.client.Single().ReadRow(ctx, apiKeysTable, spanner.Key{id}, apiKeyColumns)
+	if err != nil {
+		if spanner.ErrCode(err) == codes.NotFound {
+			// Not found is not an error
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to retrieve api key: %w", err)
+	}
+	return apiKeyFromRow(row)
+}
+
+func (dbs *SpannerDBService) ListAPIKeys() ([]*apikey.Key, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf("select %s from %s order by %s",
+			strings.Join(apiKeyColumns, ", "), apiKeysTable, apiKeyCreateTimeColumn),
+	}
+	iter := dbs.client.Single().Query(ctx, stmt)
+	defer iter.Stop()
+	res := []*apikey.Key{}
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list api keys: %w", err)
+		}
+		k, err := apiKeyFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, k)
+	}
+	return res, nil
+}
+
+func (dbs *SpannerDBService) DeleteAPIKey(id string) error {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	mutation := spanner.Delete(apiKeysTable, spanner.KeySetFromKeys(spanner.Key{id}))
+	_, err := dbs.client.Apply(ctx, []*spanner.Mutation{mutation})
+	return err
+}
+
+func apiKeyFromRow(row *spanner.Row) (*apikey.Key, error) {
+	var (
+		id, name, identity, createdBy string
+		secretHash                    []byte
+		createTime                    time.Time
+		expireTime                    spanner.NullTime
+	)
+	err := row.Columns(&id, &name, &identity, &secretHash, &createdBy, &createTime, &expireTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode api key: %w", err)
+	}
+	k := &apikey.Key{
+		ID:         id,
+		Name:       name,
+		Identity:   identity,
+		SecretHash: secretHash,
+		CreatedBy:  createdBy,
+		CreateTime: createTime,
+	}
+	if expireTime.Valid {
+		k.ExpireTime = expireTime.Time
+	}
+	return k, nil
+}
+
+// Rows must be sorted by zone and host.
+func hostACLsFromRows(iter *spanner.RowIterator) ([]*acl.HostACL, error) {
+	defer iter.Stop()
+	res := []*acl.HostACL{}
+	for {
+		row, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read host acls: %w", err)
+		}
+		var zone, host, principal, owner, role string
+		if err := row.Columns(&zone, &host, &principal, &owner, &role); err != nil {
+			return nil, fmt.Errorf("failed to decode host acl: %w", err)
+		}
+		if len(res) == 0 || res[len(res)-1].Zone != zone || res[len(res)-1].Host != host {
+			res = append(res, &acl.HostACL{Zone: zone, Host: host, Owner: owner})
+		}
+		last := res[len(res)-1]
+		last.Entries = append(last.Entries, acl.Entry{Principal: principal, Role: acl.Role(role)})
+	}
+	return res, nil
+}
+
+func (dbs *SpannerDBService) DeleteExpiredSessions() (int64, error) {
+	ctx, cancel := dbs.requestContext()
+	defer cancel()
+	var rowCount int64
+	_, err := dbs.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		stmt := spanner.Statement{
+			SQL: fmt.Sprintf("delete from %s where %s < @threshold", sessionsTable, sessionAccessColumn),
+			Params: map[string]interface{}{
+				"threshold": time.Now().Add(-sessionTTL),
+			},
+		}
+		var err error
+		rowCount, err = txn.Update(ctx, stmt)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
 	}
+	return rowCount, nil
 }
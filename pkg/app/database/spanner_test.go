@@ -0,0 +1,155 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	dbadmin "cloud.google.com/go/spanner/admin/database/apiv1"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+)
+
+// Compares fetching credentials with the shared client against creating a client for each request,
+// as this service used to do. Runs against the Spanner emulator, see TestSpannerDBConformance.
+func BenchmarkSpannerFetchBuildAPICredentials(b *testing.B) {
+	skipWithoutSpannerEmulator(b)
+	name := createSpannerTestDatabase(b)
+	dbs, err := NewSpannerDBService(SpannerConfig{DatabaseName: name})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dbs.Close()
+	if err := dbs.StoreBuildAPICredentials("johndoe", []byte("foo")); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("SharedClient", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := dbs.FetchBuildAPICredentials("johndoe"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ClientPerRequest", func(b *testing.B) {
+		ctx := context.Background()
+		for i := 0; i < b.N; i++ {
+			client, err := spanner.NewClient(ctx, name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, err = client.Single().ReadRow(ctx, credentialsTable, spanner.Key{"johndoe"}, []string{credentialsColumn})
+			client.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// The schema documented in SpannerDBService.
+var spannerTestSchema = []string{
+	`create table Credentials (
+		username string(max) not null,
+		credentials bytes(max),
+	) primary key (username)`,
+	`create table Sessions (
+		session_key string(max) not null,
+		oauth2_state string(max),
+		accessed_at timestamp,
+	) primary key (session_key)`,
+	`create table Operations (
+		name string(max) not null,
+		type string(max),
+		username string(max),
+		host string(max),
+		state string(max),
+		create_time timestamp,
+		update_time timestamp,
+		result bytes(max),
+		error_code int64,
+		error_msg string(max),
+	) primary key (name)`,
+	`create table HostACLs (
+		zone string(max) not null,
+		host string(max) not null,
+		principal string(max) not null,
+		owner string(max),
+		role string(max),
+	) primary key (zone, host, principal)`,
+	`create table HostMetadata (
+		zone string(max) not null,
+		host string(max) not null,
+		owner string(max),
+		labels string(max),
+		expire_time timestamp,
+	) primary key (zone, host)`,
+	`create table HostActivity (
+		zone string(max) not null,
+		host string(max) not null,
+		last_active timestamp,
+	) primary key (zone, host)`,
+	`create table UserRoles (
+		username string(max) not null,
+		role string(max),
+	) primary key (username)`,
+	`create table APIKeys (
+		id string(max) not null,
+		name string(max),
+		identity string(max),
+		secret_hash bytes(max),
+		created_by string(max),
+		create_time timestamp,
+		expire_time timestamp,
+	) primary key (id)`,
+}
+
+func skipWithoutSpannerEmulator(tb testing.TB) {
+	if os.Getenv("SPANNER_EMULATOR_HOST") == "" || os.Getenv("SPANNER_TEST_INSTANCE") == "" {
+		tb.Skip("SPANNER_EMULATOR_HOST or SPANNER_TEST_INSTANCE not set")
+	}
+}
+
+// Creates a database with the documented schema in the test instance, it's dropped when the test
+// completes. Returns the database name.
+func createSpannerTestDatabase(tb testing.TB) string {
+	ctx := context.Background()
+	admin, err := dbadmin.NewDatabaseAdminClient(ctx)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	id := fmt.Sprintf("test-%d", time.Now().UnixNano()%1e12)
+	op, err := admin.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
+		Parent:          os.Getenv("SPANNER_TEST_INSTANCE"),
+		CreateStatement: "create database `" + id + "`",
+		ExtraStatements: spannerTestSchema,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	db, err := op.Wait(ctx)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		admin.DropDatabase(ctx, &databasepb.DropDatabaseRequest{Database: db.Name})
+		admin.Close()
+	})
+	return db.Name
+}
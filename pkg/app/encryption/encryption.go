@@ -22,4 +22,9 @@ type Service interface {
 type Config struct {
 	Type   string
 	GCPKMS *GCPKMSConfig
+	Local  *LocalConfig
+	// Vault's transit secrets engine.
+	VaultTransit *VaultTransitConfig
+	// Wraps the service with envelope encryption if set.
+	Envelope *EnvelopeConfig
 }
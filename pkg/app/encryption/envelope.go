@@ -0,0 +1,220 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type EnvelopeConfig struct {
+	// How long unwrapped data keys are kept in memory, defaults to 5 minutes if zero.
+	DataKeyCacheTTLSeconds int
+	// Maximum number of unwrapped data keys kept in memory, defaults to 1000 if zero.
+	MaxCachedDataKeys int
+}
+
+const (
+	defaultDataKeyCacheTTL   = 5 * time.Minute
+	defaultMaxCachedDataKeys = 1000
+)
+
+// Identifies the ciphertexts produced by the envelope encryption service, data encrypted directly
+// with the key management service before the envelope was enabled is still decrypted.
+var envelopePrefix = []byte("ENV1")
+
+// Decorates an encryption service, usually backed by a key management service, with envelope
+// encryption: each record is encrypted with AES-256-GCM using a new data key, which is in turn
+// encrypted by the decorated service and stored along with the record:
+//
+//	[prefix][4 bytes encrypted data key length][encrypted data key][12 bytes nonce][encrypted data and tag]
+//
+// Decrypted data keys are cached for a bounded time, so decrypting the same record repeatedly only
+// reaches the decorated service once.
+type EnvelopeEncryptionService struct {
+	kms        Service
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+	mtx        sync.Mutex
+	// Decrypted data keys, keyed by the encrypted data key.
+	cache map[string]cachedDataKey
+}
+
+type cachedDataKey struct {
+	key       []byte
+	expiresAt time.Time
+}
+
+func NewEnvelopeEncryptionService(kms Service, cfg EnvelopeConfig) *EnvelopeEncryptionService {
+	ttl := defaultDataKeyCacheTTL
+	if cfg.DataKeyCacheTTLSeconds > 0 {
+		ttl = time.Duration(cfg.DataKeyCacheTTLSeconds) * time.Second
+	}
+	maxEntries := defaultMaxCachedDataKeys
+	if cfg.MaxCachedDataKeys > 0 {
+		maxEntries = cfg.MaxCachedDataKeys
+	}
+	return &EnvelopeEncryptionService{
+		kms:        kms,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		cache:      make(map[string]cachedDataKey),
+	}
+}
+
+func (s *EnvelopeEncryptionService) Encrypt(plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrappedKey, err := s.kms.Encrypt(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt data key: %w", err)
+	}
+	aead, err := newDataKeyAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	s.cacheDataKey(wrappedKey, dataKey)
+	res := append([]byte{}, envelopePrefix...)
+	res = binary.BigEndian.AppendUint32(res, uint32(len(wrappedKey)))
+	res = append(res, wrappedKey...)
+	res = append(res, nonce...)
+	return aead.Seal(res, nonce, plaintext, nil), nil
+}
+
+func (s *EnvelopeEncryptionService) Decrypt(ciphertext []byte) ([]byte, error) {
+	if !bytes.HasPrefix(ciphertext, envelopePrefix) {
+		return s.kms.Decrypt(ciphertext)
+	}
+	wrappedKey, rest, err := splitWrappedDataKey(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := s.unwrapDataKey(wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newDataKeyAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed ciphertext")
+	}
+	nonce, sealed := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with data key: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Splits an envelope ciphertext into the encrypted data key and the rest.
+func splitWrappedDataKey(ciphertext []byte) ([]byte, []byte, error) {
+	rest := ciphertext[len(envelopePrefix):]
+	if len(rest) < 4 {
+		return nil, nil, fmt.Errorf("malformed ciphertext")
+	}
+	keyLen := binary.BigEndian.Uint32(rest)
+	rest = rest[4:]
+	if uint64(len(rest)) < uint64(keyLen) {
+		return nil, nil, fmt.Errorf("malformed ciphertext")
+	}
+	return rest[:keyLen], rest[keyLen:], nil
+}
+
+// Rotates the keys of the decorated service, the key of a record is the one its data key is
+// encrypted with.
+type envelopeKeyRotator struct {
+	*EnvelopeEncryptionService
+	kms KeyRotator
+}
+
+func (r *envelopeKeyRotator) PrimaryKeyID() string {
+	return r.kms.PrimaryKeyID()
+}
+
+func (r *envelopeKeyRotator) KeyID(ciphertext []byte) (string, error) {
+	if !bytes.HasPrefix(ciphertext, envelopePrefix) {
+		return r.kms.KeyID(ciphertext)
+	}
+	wrappedKey, _, err := splitWrappedDataKey(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return r.kms.KeyID(wrappedKey)
+}
+
+func (s *EnvelopeEncryptionService) unwrapDataKey(wrappedKey []byte) ([]byte, error) {
+	s.mtx.Lock()
+	entry, ok := s.cache[string(wrappedKey)]
+	s.mtx.Unlock()
+	if ok && s.now().Before(entry.expiresAt) {
+		return entry.key, nil
+	}
+	dataKey, err := s.kms.Decrypt(wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	s.cacheDataKey(wrappedKey, dataKey)
+	return dataKey, nil
+}
+
+// Expired keys are evicted when the cache is full, followed by the keys closest to expiration if
+// that's not enough.
+func (s *EnvelopeEncryptionService) cacheDataKey(wrappedKey, dataKey []byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := s.now()
+	if len(s.cache) >= s.maxEntries {
+		for k, e := range s.cache {
+			if !now.Before(e.expiresAt) {
+				delete(s.cache, k)
+			}
+		}
+	}
+	for len(s.cache) >= s.maxEntries {
+		var oldest string
+		var oldestExpiration time.Time
+		for k, e := range s.cache {
+			if oldestExpiration.IsZero() || e.expiresAt.Before(oldestExpiration) {
+				oldest, oldestExpiration = k, e.expiresAt
+			}
+		}
+		delete(s.cache, oldest)
+	}
+	s.cache[string(wrappedKey)] = cachedDataKey{key: dataKey, expiresAt: now.Add(s.ttl)}
+}
+
+func newDataKeyAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
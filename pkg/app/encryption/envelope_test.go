@@ -0,0 +1,253 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Counts the requests to the key management service.
+type countingKMS struct {
+	Service
+	encrypts int
+	decrypts int
+}
+
+func (s *countingKMS) Encrypt(plaintext []byte) ([]byte, error) {
+	s.encrypts++
+	return s.Service.Encrypt(plaintext)
+}
+
+func (s *countingKMS) Decrypt(ciphertext []byte) ([]byte, error) {
+	s.decrypts++
+	return s.Service.Decrypt(ciphertext)
+}
+
+func newTestKMS(t *testing.T) *countingKMS {
+	local, err := newLocalEncryptionService([]keyringKey{testKey1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &countingKMS{Service: local}
+}
+
+func TestEnvelopeEncryptionServiceRoundTrip(t *testing.T) {
+	kms := newTestKMS(t)
+	es := NewEnvelopeEncryptionService(kms, EnvelopeConfig{})
+
+	ciphertext, err := es.Encrypt([]byte("foo"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, []byte("foo")) {
+		t.Errorf("plaintext found in ciphertext: %q", ciphertext)
+	}
+	// A new service starts with an empty cache.
+	plaintext, err := NewEnvelopeEncryptionService(kms, EnvelopeConfig{}).Decrypt(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte("foo"), plaintext); diff != "" {
+		t.Errorf("plaintext mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(1, kms.decrypts); diff != "" {
+		t.Errorf("kms decrypts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEnvelopeEncryptionServiceUsesNewDataKeyPerRecord(t *testing.T) {
+	kms := newTestKMS(t)
+	es := NewEnvelopeEncryptionService(kms, EnvelopeConfig{})
+
+	first, err := es.Encrypt([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := es.Encrypt([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(2, kms.encrypts); diff != "" {
+		t.Errorf("kms encrypts mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(2, len(es.cache)); diff != "" {
+		t.Errorf("cached data keys mismatch (-want +got):\n%s", diff)
+	}
+	if bytes.Equal(first, second) {
+		t.Error("expected different ciphertexts")
+	}
+}
+
+func TestEnvelopeEncryptionServiceCachesDataKeys(t *testing.T) {
+	kms := newTestKMS(t)
+	es := NewEnvelopeEncryptionService(kms, EnvelopeConfig{DataKeyCacheTTLSeconds: 60})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	es.now = func() time.Time { return now }
+	ciphertext, err := es.Encrypt([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := es.Decrypt(ciphertext); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff(0, kms.decrypts); diff != "" {
+		t.Errorf("kms decrypts before expiration mismatch (-want +got):\n%s", diff)
+	}
+	now = now.Add(time.Minute)
+	if _, err := es.Decrypt(ciphertext); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(1, kms.decrypts); diff != "" {
+		t.Errorf("kms decrypts after expiration mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEnvelopeEncryptionServiceCacheIsBounded(t *testing.T) {
+	kms := newTestKMS(t)
+	es := NewEnvelopeEncryptionService(kms, EnvelopeConfig{MaxCachedDataKeys: 2})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	es.now = func() time.Time { return now }
+	var ciphertexts [][]byte
+	for i := 0; i < 3; i++ {
+		c, err := es.Encrypt([]byte("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ciphertexts = append(ciphertexts, c)
+		now = now.Add(time.Second)
+	}
+
+	if diff := cmp.Diff(2, len(es.cache)); diff != "" {
+		t.Errorf("cached data keys mismatch (-want +got):\n%s", diff)
+	}
+	// The first data key was evicted.
+	if _, err := es.Decrypt(ciphertexts[0]); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(1, kms.decrypts); diff != "" {
+		t.Errorf("kms decrypts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEnvelopeEncryptionServiceDecryptsDataWithoutEnvelope(t *testing.T) {
+	kms := newTestKMS(t)
+	ciphertext, err := kms.Encrypt([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	es := NewEnvelopeEncryptionService(kms, EnvelopeConfig{})
+
+	plaintext, err := es.Decrypt(ciphertext)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte("foo"), plaintext); diff != "" {
+		t.Errorf("plaintext mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEnvelopeEncryptionServiceDecryptFails(t *testing.T) {
+	es := NewEnvelopeEncryptionService(newTestKMS(t), EnvelopeConfig{})
+	ciphertext, err := es.Encrypt([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{"truncated length", envelopePrefix},
+		{"truncated data key", append(append([]byte{}, envelopePrefix...), 0, 0, 1, 0)},
+		{"tampered", tampered},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := es.Decrypt(tc.ciphertext)
+
+			if err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestReEncryptCredentialsThroughEnvelope(t *testing.T) {
+	old, err := newLocalEncryptionService([]keyringKey{testKey1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := newLocalEncryptionService([]keyringKey{testKey1, testKey2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs := database.NewInMemoryDBService()
+	// Credentials encrypted before and after the envelope was enabled.
+	direct, err := old.Encrypt([]byte("johndoe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.StoreBuildAPICredentials("johndoe", direct)
+	wrapped, err := NewEnvelopeEncryptionService(old, EnvelopeConfig{}).Encrypt([]byte("janedoe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs.StoreBuildAPICredentials("janedoe", wrapped)
+	es, ok := AsKeyRotator(NewEnvelopeEncryptionService(local, EnvelopeConfig{}))
+	if !ok {
+		t.Fatal("expected envelope over local encryption to rotate keys")
+	}
+
+	count, err := ReEncryptCredentials(dbs, es)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(2, count); diff != "" {
+		t.Errorf("count mismatch (-want +got):\n%s", diff)
+	}
+	for _, username := range []string{"johndoe", "janedoe"} {
+		ciphertext, _ := dbs.FetchBuildAPICredentials(username)
+		if id, err := es.KeyID(ciphertext); err != nil || id != "k2" {
+			t.Errorf("key id of %q = %q, %v, want \"k2\", nil", username, id, err)
+		}
+		plaintext, err := es.Decrypt(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]byte(username), plaintext); diff != "" {
+			t.Errorf("credentials of %q mismatch (-want +got):\n%s", username, diff)
+		}
+	}
+}
+
+func TestAsKeyRotatorEnvelopeOverRemoteService(t *testing.T) {
+	if _, ok := AsKeyRotator(NewEnvelopeEncryptionService(newTestKMS(t), EnvelopeConfig{})); ok {
+		t.Error("expected envelope over a service without local keys not to rotate keys")
+	}
+}
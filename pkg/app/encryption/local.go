@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
+)
+
+const LocalESType = "Local"
+
+type LocalConfig struct {
+	// JSON file with the keys, i.e:
+	//
+	//	{"Keys": [{"ID": "2024-01", "Key": "<base64 encoded 32 bytes key>"}]}
+	//
+	// The last key of the list encrypts new data, the others are only used to decrypt data
+	// encrypted before they were rotated.
+	KeyringFile string
+}
+
+type keyringKey struct {
+	ID string
+	// Decoded from base64 by encoding/json.
+	Key []byte
+}
+
+type keyring struct {
+	Keys []keyringKey
+}
+
+// Encrypts data with AES-256-GCM using keys loaded from a local keyring file.
+//
+// Ciphertexts are prefixed with the ID of the key that encrypted them so data encrypted with older
+// keys can still be decrypted after new keys are added to the keyring:
+//
+//	[1 byte key ID length][key ID][12 bytes nonce][encrypted data and tag]
+type LocalEncryptionService struct {
+	aeads     map[string]cipher.AEAD
+	primaryID string
+}
+
+func NewLocalEncryptionService(keyringFile string) (*LocalEncryptionService, error) {
+	data, err := os.ReadFile(keyringFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring file: %w", err)
+	}
+	var kr keyring
+	if err := json.Unmarshal(data, &kr); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring file: %w", err)
+	}
+	return newLocalEncryptionService(kr.Keys)
+}
+
+func newLocalEncryptionService(keys []keyringKey) (*LocalEncryptionService, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keyring is empty")
+	}
+	es := &LocalEncryptionService{aeads: make(map[string]cipher.AEAD)}
+	for _, k := range keys {
+		if k.ID == "" || len(k.ID) > 255 {
+			return nil, fmt.Errorf("invalid key id %q: must be between 1 and 255 bytes long", k.ID)
+		}
+		if _, ok := es.aeads[k.ID]; ok {
+			return nil, fmt.Errorf("duplicated key id %q", k.ID)
+		}
+		if len(k.Key) != 32 {
+			return nil, fmt.Errorf("invalid key %q: AES-256 keys are 32 bytes long, got %d", k.ID, len(k.Key))
+		}
+		block, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		es.aeads[k.ID] = aead
+		es.primaryID = k.ID
+	}
+	return es, nil
+}
+
+func (es *LocalEncryptionService) PrimaryKeyID() string {
+	return es.primaryID
+}
+
+func (es *LocalEncryptionService) Encrypt(plaintext []byte) ([]byte, error) {
+	aead := es.aeads[es.primaryID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	res := append([]byte{byte(len(es.primaryID))}, es.primaryID...)
+	res = append(res, nonce...)
+	// The key ID is authenticated so it can't be swapped for another one.
+	return aead.Seal(res, nonce, plaintext, []byte(es.primaryID)), nil
+}
+
+func (es *LocalEncryptionService) Decrypt(ciphertext []byte) ([]byte, error) {
+	id, rest, err := splitKeyID(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	aead, ok := es.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", id)
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed ciphertext")
+	}
+	nonce, sealed := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with key %q: %w", id, err)
+	}
+	return plaintext, nil
+}
+
+func (es *LocalEncryptionService) KeyID(ciphertext []byte) (string, error) {
+	id, _, err := splitKeyID(ciphertext)
+	return id, err
+}
+
+func splitKeyID(ciphertext []byte) (string, []byte, error) {
+	if len(ciphertext) == 0 || len(ciphertext) < 1+int(ciphertext[0]) {
+		return "", nil, fmt.Errorf("malformed ciphertext")
+	}
+	n := 1 + int(ciphertext[0])
+	return string(ciphertext[1:n]), ciphertext[n:], nil
+}
+
+// Implemented by the encryption services whose keys are rotated by the orchestrator, the stored
+// credentials are re-encrypted with the newest key by ReEncryptCredentials.
+type KeyRotator interface {
+	Service
+	// The ID of the key new data is encrypted with.
+	PrimaryKeyID() string
+	// Returns the ID of the key the ciphertext was encrypted with.
+	KeyID(ciphertext []byte) (string, error)
+}
+
+// Returns the encryption service as a key rotator if its keys are rotated by the orchestrator,
+// which includes envelope encryption whose data keys are encrypted by such a service.
+func AsKeyRotator(es Service) (KeyRotator, bool) {
+	switch s := es.(type) {
+	case KeyRotator:
+		return s, true
+	case *EnvelopeEncryptionService:
+		if kms, ok := s.kms.(KeyRotator); ok {
+			return &envelopeKeyRotator{EnvelopeEncryptionService: s, kms: kms}, true
+		}
+	}
+	return nil, false
+}
+
+// Re-encrypts the stored Build API credentials not encrypted with the primary key, so older keys
+// can eventually be removed from the keyring. Credentials are processed one user at a time, those
+// stored again while being re-encrypted are kept as is since they are already encrypted with the
+// primary key. Returns the number of users whose credentials were re-encrypted.
+func ReEncryptCredentials(dbs database.Service, es KeyRotator) (int, error) {
+	usernames, err := dbs.ListBuildAPICredentialsUsernames()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, username := range usernames {
+		ciphertext, err := dbs.FetchBuildAPICredentials(username)
+		if err != nil {
+			return count, err
+		}
+		if ciphertext == nil {
+			// Deleted since listed.
+			continue
+		}
+		id, err := es.KeyID(ciphertext)
+		if err != nil {
+			log.Printf("skipping credentials of %q: %v", username, err)
+			continue
+		}
+		if id == es.PrimaryKeyID() {
+			continue
+		}
+		plaintext, err := es.Decrypt(ciphertext)
+		if err != nil {
+			log.Printf("skipping credentials of %q: %v", username, err)
+			continue
+		}
+		reEncrypted, err := es.Encrypt(plaintext)
+		if err != nil {
+			return count, err
+		}
+		replaced, err := dbs.ReplaceBuildAPICredentials(username, ciphertext, reEncrypted)
+		if err != nil {
+			return count, fmt.Errorf("failed to store re-encrypted credentials of %q: %w", username, err)
+		}
+		if !replaced {
+			// Stored again or deleted since fetched.
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
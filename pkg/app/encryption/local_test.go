@@ -0,0 +1,262 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	testKey1 = keyringKey{ID: "k1", Key: bytes.Repeat([]byte{1}, 32)}
+	testKey2 = keyringKey{ID: "k2", Key: bytes.Repeat([]byte{2}, 32)}
+)
+
+func TestNewLocalEncryptionServiceFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	// Both keys are the base64 encoding of 32 bytes.
+	content := `{"Keys": [
+		{"ID": "k1", "Key": "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="},
+		{"ID": "k2", "Key": "AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI="}
+	]}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	es, err := NewLocalEncryptionService(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("k2", es.PrimaryKeyID()); diff != "" {
+		t.Errorf("primary key id mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewLocalEncryptionServiceInvalidKeyring(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []keyringKey
+	}{
+		{"empty", nil},
+		{"short key", []keyringKey{{ID: "k1", Key: []byte("foo")}}},
+		{"missing id", []keyringKey{{Key: testKey1.Key}}},
+		{"duplicated id", []keyringKey{testKey1, testKey1}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newLocalEncryptionService(tc.keys)
+
+			if err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLocalEncryptionServiceRoundTrip(t *testing.T) {
+	es, err := newLocalEncryptionService([]keyringKey{testKey1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := es.Encrypt([]byte("foo"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, []byte("foo")) {
+		t.Errorf("plaintext found in ciphertext: %q", ciphertext)
+	}
+	plaintext, err := es.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte("foo"), plaintext); diff != "" {
+		t.Errorf("plaintext mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLocalEncryptionServiceDecryptsWithRotatedKeys(t *testing.T) {
+	old, err := newLocalEncryptionService([]keyringKey{testKey1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := old.Encrypt([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := newLocalEncryptionService([]keyringKey{testKey1, testKey2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := es.Decrypt(ciphertext)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte("foo"), plaintext); diff != "" {
+		t.Errorf("plaintext mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLocalEncryptionServiceDecryptFails(t *testing.T) {
+	es, err := newLocalEncryptionService([]keyringKey{testKey1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := es.Encrypt([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	other, err := newLocalEncryptionService([]keyringKey{testKey2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCiphertext, err := other.Encrypt([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{"empty", nil},
+		{"truncated", ciphertext[:5]},
+		{"tampered", tampered},
+		{"unknown key", otherCiphertext},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := es.Decrypt(tc.ciphertext)
+
+			if err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestReEncryptCredentials(t *testing.T) {
+	old, err := newLocalEncryptionService([]keyringKey{testKey1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := newLocalEncryptionService([]keyringKey{testKey1, testKey2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs := database.NewInMemoryDBService()
+	for username, service := range map[string]*LocalEncryptionService{"johndoe": old, "janedoe": es} {
+		ciphertext, err := service.Encrypt([]byte(username))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dbs.StoreBuildAPICredentials(username, ciphertext); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := ReEncryptCredentials(dbs, es)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(1, count); diff != "" {
+		t.Errorf("count mismatch (-want +got):\n%s", diff)
+	}
+	for _, username := range []string{"johndoe", "janedoe"} {
+		ciphertext, err := dbs.FetchBuildAPICredentials(username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := es.KeyID(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff("k2", id); diff != "" {
+			t.Errorf("key id of %q mismatch (-want +got):\n%s", username, diff)
+		}
+		plaintext, err := es.Decrypt(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]byte(username), plaintext); diff != "" {
+			t.Errorf("credentials of %q mismatch (-want +got):\n%s", username, diff)
+		}
+	}
+}
+
+// Stores fresh credentials right after fetching them, as if the user authorized again meanwhile.
+type racingCredentialsDB struct {
+	database.Service
+	fresh []byte
+}
+
+func (db *racingCredentialsDB) FetchBuildAPICredentials(username string) ([]byte, error) {
+	creds, err := db.Service.FetchBuildAPICredentials(username)
+	if err := db.Service.StoreBuildAPICredentials(username, db.fresh); err != nil {
+		return nil, err
+	}
+	return creds, err
+}
+
+func TestReEncryptCredentialsKeepsFreshCredentials(t *testing.T) {
+	old, err := newLocalEncryptionService([]keyringKey{testKey1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := newLocalEncryptionService([]keyringKey{testKey1, testKey2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := old.Encrypt([]byte("stale"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := es.Encrypt([]byte("fresh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs := &racingCredentialsDB{Service: database.NewInMemoryDBService(), fresh: fresh}
+	if err := dbs.StoreBuildAPICredentials("johndoe", stale); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := ReEncryptCredentials(dbs, es)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(0, count); diff != "" {
+		t.Errorf("count mismatch (-want +got):\n%s", diff)
+	}
+	ciphertext, err := dbs.Service.FetchBuildAPICredentials("johndoe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(fresh, ciphertext); diff != "" {
+		t.Errorf("credentials mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/vault"
+)
+
+const VaultTransitESType = "VaultTransit"
+
+type VaultTransitConfig struct {
+	// Where the transit secrets engine is mounted, defaults to "transit".
+	MountPath string
+	// Name of the transit key, required.
+	KeyName string
+}
+
+// Encrypts data with a key of a Vault transit secrets engine. Ciphertexts are stored as returned by
+// Vault, i.e: "vault:v1:...", so data encrypted with older versions of the key can be decrypted
+// after it's rotated.
+type VaultTransitEncryptionService struct {
+	client *vault.Client
+	mount  string
+	key    string
+}
+
+func NewVaultTransitEncryptionService(client *vault.Client, config *VaultTransitConfig) (*VaultTransitEncryptionService, error) {
+	if config == nil || config.KeyName == "" {
+		return nil, errors.New("missing Vault transit key name")
+	}
+	mount := config.MountPath
+	if mount == "" {
+		mount = "transit"
+	}
+	return &VaultTransitEncryptionService{client: client, mount: mount, key: config.KeyName}, nil
+}
+
+func (s *VaultTransitEncryptionService) Encrypt(plaintext []byte) ([]byte, error) {
+	body := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}
+	res, err := s.client.Write(s.mount+"/encrypt/"+s.key, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed encryption request: %w", err)
+	}
+	var data struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode encryption response: %w", err)
+	}
+	// Storing an empty ciphertext would lose the data for good.
+	if data.Ciphertext == "" {
+		return nil, errors.New("empty ciphertext in encryption response")
+	}
+	return []byte(data.Ciphertext), nil
+}
+
+func (s *VaultTransitEncryptionService) Decrypt(ciphertext []byte) ([]byte, error) {
+	body := map[string]string{"ciphertext": string(ciphertext)}
+	res, err := s.client.Write(s.mount+"/decrypt/"+s.key, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed decryption request: %w", err)
+	}
+	var data struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode decryption response: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(data.Plaintext)
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/vault"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// A fake Vault transit secrets engine, "encrypting" by prefixing the base64 encoded plaintext.
+func newFakeVaultTransit(t *testing.T) *vault.Client {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "foo" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/auth/token/lookup-self":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]int{"ttl": 0}})
+		case "/v1/transit/encrypt/bar":
+			data := map[string]string{"ciphertext": "vault:v1:" + body["plaintext"]}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+		case "/v1/transit/encrypt/empty":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"ciphertext": ""}})
+		case "/v1/transit/decrypt/bar":
+			if !strings.HasPrefix(body["ciphertext"], "vault:v1:") {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors": ["invalid ciphertext"]}`))
+				return
+			}
+			plaintext := strings.TrimPrefix(body["ciphertext"], "vault:v1:")
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"plaintext": plaintext}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	client, err := vault.NewClient(vault.Config{Address: ts.URL, Token: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestVaultTransitEncryptionServiceRoundTrip(t *testing.T) {
+	es, err := NewVaultTransitEncryptionService(newFakeVaultTransit(t), &VaultTransitConfig{KeyName: "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := es.Encrypt([]byte("baz"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "vault:v1:" + base64.StdEncoding.EncodeToString([]byte("baz"))
+	if diff := cmp.Diff(want, string(ciphertext)); diff != "" {
+		t.Errorf("ciphertext mismatch (-want +got):\n%s", diff)
+	}
+	plaintext, err := es.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte("baz"), plaintext); diff != "" {
+		t.Errorf("plaintext mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestVaultTransitEncryptionServiceDecryptFails(t *testing.T) {
+	es, err := NewVaultTransitEncryptionService(newFakeVaultTransit(t), &VaultTransitConfig{KeyName: "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = es.Decrypt([]byte("invalid"))
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestVaultTransitEncryptionServiceEmptyCiphertext(t *testing.T) {
+	es, err := NewVaultTransitEncryptionService(newFakeVaultTransit(t), &VaultTransitConfig{KeyName: "empty"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = es.Encrypt([]byte("baz"))
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestNewVaultTransitEncryptionServiceMissingKeyName(t *testing.T) {
+	_, err := NewVaultTransitEncryptionService(newFakeVaultTransit(t), &VaultTransitConfig{})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
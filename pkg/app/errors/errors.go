@@ -24,6 +24,8 @@ type AppError struct {
 	Msg        string
 	StatusCode int
 	Err        error
+	// Included in the error response, unlike the lower level error.
+	Details any
 }
 
 func (e *AppError) Error() string {
@@ -42,6 +44,7 @@ func (e *AppError) JSONResponse() apiv1.Error {
 	return apiv1.Error{
 		Code:     e.StatusCode,
 		ErrorMsg: e.Msg,
+		Details:  e.Details,
 	}
 }
 
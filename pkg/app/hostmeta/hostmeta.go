@@ -0,0 +1,37 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostmeta
+
+import "time"
+
+// Properties of a host kept by the orchestrator instead of by the host itself, for the instance
+// managers that can't update them in place, i.e: labels of docker containers are fixed at creation.
+// Stored metadata takes precedence over the properties the host was created with.
+type Metadata struct {
+	Zone  string
+	Host  string
+	Owner string
+	// User labels of the host.
+	Labels map[string]string
+	// The zero time if the host never expires.
+	ExpireTime time.Time
+}
+
+// Last time activity was detected in a host, hosts are reclaimed after being idle for too long.
+type Activity struct {
+	Zone       string
+	Host       string
+	LastActive time.Time
+}
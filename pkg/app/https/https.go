@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package https
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// The orchestrator serves HTTPS itself when a certificate is configured, otherwise it serves HTTP and
+// TLS is expected to be terminated by a load balancer or proxy.
+type Config struct {
+	// PEM encoded certificate chain and private key of the server.
+	CertFile string
+	KeyFile  string
+	// How often the certificate files are checked for changes, they are reloaded when rotated. The
+	// files are only loaded at start up if zero.
+	ReloadIntervalSeconds int
+	// Minimum TLS version accepted, either "1.2" or "1.3". Defaults to "1.2".
+	MinVersion string
+	// Plain HTTP requests received on this port are redirected to HTTPS. No HTTP port is opened if
+	// zero.
+	RedirectHTTPPort int
+}
+
+func (c *Config) Enabled() bool {
+	return c.CertFile != ""
+}
+
+func (c *Config) MinTLSVersion() (uint16, error) {
+	switch c.MinVersion {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid minimum TLS version %q, expected 1.2 or 1.3", c.MinVersion)
+	}
+}
+
+// Provides the server certificate to the TLS listener, reloading it from its files when they
+// change so rotated certificates are picked up without restarting the orchestrator.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	mtx      sync.RWMutex
+	cert     *tls.Certificate
+	// Latest modification time of the files when the certificate was loaded.
+	modTime time.Time
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Meant to be used as tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.cert, nil
+}
+
+// Loads the certificate again if its files changed, returns whether it was reloaded. The current
+// certificate is kept if loading fails, i.e: when only one of the files has been replaced yet.
+func (r *CertReloader) Reload() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mtx.RLock()
+	unchanged := r.cert != nil && !modTime.After(r.modTime)
+	r.mtx.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return true, nil
+}
+
+// Checks the certificate files periodically until the context is cancelled.
+func (r *CertReloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				log.Printf("failed to reload TLS certificate: %v", err)
+			} else if reloaded {
+				log.Printf("TLS certificate reloaded from %q", r.certFile)
+			}
+		}
+	}
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Redirects every request to the same URL using the https scheme and the given port.
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = host
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package https
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Writes a self signed certificate and its key to the given files.
+func writeTestCert(t *testing.T, certFile, keyFile, cn string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func certCommonName(t *testing.T, r *CertReloader) string {
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+	writeTestCert(t, certFile, keyFile, "foo", start)
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := r.Reload()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded {
+		t.Error("expected unchanged certificate not to be reloaded")
+	}
+	writeTestCert(t, certFile, keyFile, "bar", start.Add(time.Minute))
+
+	reloaded, err = r.Reload()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded {
+		t.Error("expected rotated certificate to be reloaded")
+	}
+	if diff := cmp.Diff("bar", certCommonName(t, r)); diff != "" {
+		t.Errorf("common name mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCertReloaderKeepsCertificateOnError(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "foo", time.Now().Add(-time.Hour))
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Reload()
+
+	if err == nil {
+		t.Error("expected error")
+	}
+	if diff := cmp.Diff("foo", certCommonName(t, r)); diff != "" {
+		t.Errorf("common name mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+	}{
+		{"", tls.VersionTLS12},
+		{"1.2", tls.VersionTLS12},
+		{"1.3", tls.VersionTLS13},
+	}
+	for _, tc := range tests {
+		c := &Config{MinVersion: tc.version}
+
+		got, err := c.MinTLSVersion()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("version %q mismatch (-want +got):\n%s", tc.version, diff)
+		}
+	}
+	if _, err := (&Config{MinVersion: "1.1"}).MinTLSVersion(); err == nil {
+		t.Error("expected error for version 1.1")
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		port string
+		want string
+	}{
+		{"443", "https://example.com/v1/zones?foo=bar"},
+		{"8443", "https://example.com:8443/v1/zones?foo=bar"},
+	}
+	for _, tc := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "http://example.com:8080/v1/zones?foo=bar", nil)
+
+		RedirectHandler(tc.port).ServeHTTP(w, r)
+
+		if diff := cmp.Diff(http.StatusMovedPermanently, w.Code); diff != "" {
+			t.Errorf("status code mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(tc.want, w.Header().Get("Location")); diff != "" {
+			t.Errorf("location mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
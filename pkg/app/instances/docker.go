@@ -17,8 +17,11 @@ package instances
 import (
 	"context"
 	"fmt"
+	"io"
+	"log"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -28,7 +31,10 @@ import (
 
 	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
 	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
 	"github.com/google/cloud-android-orchestration/pkg/app/errors"
+	"github.com/google/cloud-android-orchestration/pkg/app/hostmeta"
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
 )
 
 const DockerIMType IMType = "docker"
@@ -36,27 +42,52 @@ const DockerIMType IMType = "docker"
 type DockerIMConfig struct {
 	DockerImageName      string
 	HostOrchestratorPort int
+	// How idle hosts are reclaimed.
+	IdlePolicy IdlePolicy
+	// Pools of pre-booted hosts, the zone must be `local`.
+	WarmPools []WarmPoolConfig
 }
 
-const dockerLabelCreatedBy = "created_by"
+const (
+	dockerLabelCreatedBy  = "created_by"
+	dockerLabelExpireTime = "expire_time"
+	// Set in the containers of the warm pool. Labels of existing containers can't be updated, so the
+	// owner of an assigned pool container is stored in its host metadata.
+	dockerLabelPool = "pool"
+)
 
 // Docker implementation of the instance manager.
+//
+// Host creation and deletion are executed in the background, the state of these operations is
+// stored through the database service. Labels of existing containers can't be updated, so changes
+// to the properties of a host after its creation are stored through the database service as well.
 type DockerInstanceManager struct {
-	Config Config
-	Client client.Client
+	Config     Config
+	Client     client.Client
+	dbs        database.Service
+	operations *operationRunner
+	// Serializes the updates of host metadata, which read it before storing it.
+	metadataMtx sync.Mutex
 }
 
 type OPType string
 
 const (
-	CreateHostOPType OPType = "createhost"
-	DeleteHostOPType OPType = "deletehost"
+	CreateHostOPType  OPType = "createhost"
+	DeleteHostOPType  OPType = "deletehost"
+	StopHostOPType    OPType = "stophost"
+	StartHostOPType   OPType = "starthost"
+	SuspendHostOPType OPType = "suspendhost"
+	// Started by `StartHost` when the host is suspended.
+	ResumeHostOPType OPType = "resumehost"
 )
 
-func NewDockerInstanceManager(cfg Config, cli client.Client) *DockerInstanceManager {
+func NewDockerInstanceManager(cfg Config, cli client.Client, dbs database.Service) *DockerInstanceManager {
 	return &DockerInstanceManager{
-		Config: cfg,
-		Client: cli,
+		Config:     cfg,
+		Client:     cli,
+		dbs:        dbs,
+		operations: newOperationRunner(dbs),
 	}
 }
 
@@ -68,66 +99,169 @@ func (m *DockerInstanceManager) ListZones() (*apiv1.ListZonesResponse, error) {
 	}, nil
 }
 
-func (m *DockerInstanceManager) CreateHost(zone string, _ *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error) {
+func (m *DockerInstanceManager) CreateHost(zone string, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error) {
 	if zone != "local" {
 		return nil, errors.NewBadRequestError("Invalid zone. It should be 'local'.", nil)
 	}
-	ctx := context.TODO()
+	userLabels, err := validateDockerRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	expireTime := expireTimeFromTTL(req.TTLSeconds)
+	return m.operations.Start(CreateHostOPType, user, "", func(ctx context.Context, op *operation.Operation) (any, error) {
+		return m.createHost(ctx, op, userLabels, expireTime)
+	})
+}
+
+// Returns the user labels of the request.
+func validateDockerRequest(req *apiv1.CreateHostRequest) (map[string]string, error) {
+	if req.TTLSeconds < 0 {
+		return nil, errors.NewBadRequestError("The time to live can't be negative.", nil)
+	}
+	var userLabels map[string]string
+	if req.HostInstance != nil {
+		userLabels = req.HostInstance.Labels
+	}
+	if err := validateUserLabels(userLabels); err != nil {
+		return nil, err
+	}
+	return userLabels, nil
+}
+
+func (m *DockerInstanceManager) createHost(ctx context.Context, op *operation.Operation, userLabels map[string]string, expireTime time.Time) (*apiv1.HostInstance, error) {
+	labels := map[string]string{
+		dockerLabelCreatedBy: op.Username,
+	}
+	for k, v := range userLabels {
+		labels[k] = v
+	}
+	if !expireTime.IsZero() {
+		labels[dockerLabelExpireTime] = expireTimeLabelValue(expireTime)
+	}
+	id, err := m.createContainer(ctx, labels)
+	if err != nil {
+		return nil, err
+	}
+	// The container is removed if the operation is cancelled, even after it started running.
+	m.operations.OnCancel(op, func() { m.removeCancelledContainer(id) })
+	// Record the host as soon as it exists so it can be found even if the operation fails later.
+	op.Host = id
+	m.operations.Update(op)
+	err = m.Client.ContainerStart(ctx, id, types.ContainerStartOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to start docker container: %w", err)
+	}
+	return m.waitContainerRunning(ctx, id)
+}
+
+func (m *DockerInstanceManager) createContainer(ctx context.Context, labels map[string]string) (string, error) {
+	if err := m.ensureImage(ctx); err != nil {
+		return "", err
+	}
 	config := &container.Config{
 		AttachStdin: true,
 		Image:       m.Config.Docker.DockerImageName,
 		Tty:         true,
-		Labels: map[string]string{
-			dockerLabelCreatedBy: user.Username(),
-		},
+		Labels:      labels,
 	}
 	hostConfig := &container.HostConfig{
 		Privileged: true,
 	}
 	createRes, err := m.Client.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
 	if err != nil {
-		return nil, fmt.Errorf("Failed to create docker container: %w", err)
+		return "", fmt.Errorf("Failed to create docker container: %w", err)
 	}
-	err = m.Client.ContainerStart(ctx, createRes.ID, types.ContainerStartOptions{})
+	return createRes.ID, nil
+}
+
+// Removes a container created by an operation that was cancelled.
+func (m *DockerInstanceManager) removeCancelledContainer(host string) {
+	opts := types.ContainerRemoveOptions{Force: true}
+	if err := m.Client.ContainerRemove(context.TODO(), host, opts); err != nil {
+		log.Printf("failed to remove container %q of cancelled operation: %v", host, err)
+		return
+	}
+	m.forgetHost(host)
+}
+
+// Pulls the host image unless it's already available locally, which is the case for images built
+// in the same machine.
+func (m *DockerInstanceManager) ensureImage(ctx context.Context) error {
+	image := m.Config.Docker.DockerImageName
+	_, _, err := m.Client.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return fmt.Errorf("Failed to inspect docker image: %w", err)
+	}
+	rc, err := m.Client.ImagePull(ctx, image, types.ImagePullOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("Failed to start docker container: %w", err)
+		return fmt.Errorf("Failed to pull docker image: %w", err)
 	}
-	return &apiv1.Operation{
-		Name: EncodeOperationName(CreateHostOPType, createRes.ID),
-		Done: true,
-	}, nil
+	defer rc.Close()
+	// The pull doesn't complete until the progress stream is fully consumed.
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		return fmt.Errorf("Failed to pull docker image: %w", err)
+	}
+	return nil
+}
+
+func (m *DockerInstanceManager) ListHosts(zone string, user accounts.User, req *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
+	return m.listHosts(zone, user.Username(), req)
 }
 
-func (m *DockerInstanceManager) ListHosts(zone string, user accounts.User, _ *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
+// Unassigned warm pool containers have no owner, they are not listed.
+func (m *DockerInstanceManager) ListAllHosts(req *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
+	res, err := m.listHosts("local", "", req)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range res.Items {
+		h.Zone = "local"
+	}
+	return res, nil
+}
+
+// Lists the hosts of every user if the owner is empty.
+func (m *DockerInstanceManager) listHosts(zone string, owner string, req *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
 	if zone != "local" {
 		return nil, errors.NewBadRequestError("Invalid zone. It should be 'local'.", nil)
 	}
-	ctx := context.TODO()
-	ownerFilterExpr := fmt.Sprintf("%s=%s", dockerLabelCreatedBy, user.Username())
-	listFilters := filters.NewArgs(
-		filters.KeyValuePair{
-			Key:   "label",
-			Value: ownerFilterExpr,
-		},
-	)
-	listRes, err := m.Client.ContainerList(ctx, types.ContainerListOptions{
-		Filters: listFilters,
-	})
+	// Stopped containers are included, they can be started again.
+	hosts, err := m.listDockerHosts(context.TODO(), true)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to list docker containers: %w", err)
+		return nil, err
 	}
 	var items []*apiv1.HostInstance
-	for _, container := range listRes {
+	for _, h := range hosts {
+		if h.meta.Owner == "" || (owner != "" && h.meta.Owner != owner) {
+			continue
+		}
+		if !MatchesLabelSelector(h.meta.Labels, req.LabelSelector) {
+			continue
+		}
+		container := h.container
 		ipAddr, err := m.getIpAddr(&container)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to get IP address of docker instance: %w", err)
 		}
+		var ipAddrs []string
+		if ipAddr != "" {
+			ipAddrs = append(ipAddrs, ipAddr)
+		}
 		items = append(items, &apiv1.HostInstance{
 			Name: container.ID,
 			Docker: &apiv1.DockerInstance{
 				ImageName: container.Image,
 				IPAddress: ipAddr,
 			},
+			ExpireTime:  formatExpireTime(h.meta.ExpireTime),
+			Status:      dockerHostStatus(container.State),
+			CreateTime:  time.Unix(container.Created, 0).Format(time.RFC3339),
+			IPAddresses: ipAddrs,
+			Labels:      h.meta.Labels,
+			Owner:       h.meta.Owner,
 		})
 	}
 	return &apiv1.ListHostsResponse{
@@ -135,15 +269,81 @@ func (m *DockerInstanceManager) ListHosts(zone string, user accounts.User, _ *Li
 	}, nil
 }
 
+func (m *DockerInstanceManager) GetHost(zone string, user accounts.User, host string) (*apiv1.HostInstance, error) {
+	if zone != "local" {
+		return nil, errors.NewBadRequestError("Invalid zone. It should be 'local'.", nil)
+	}
+	res, err := m.Client.ContainerInspect(context.TODO(), host)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Host %q not found.", host), err)
+		}
+		return nil, fmt.Errorf("Failed to inspect docker container: %w", err)
+	}
+	meta, err := m.fetchContainerMetadata(res.ID, res.Config.Labels)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Owner != user.Username() {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Host %q not found.", host), nil)
+	}
+	var ipAddrs []string
+	for _, n := range res.NetworkSettings.Networks {
+		if n.IPAddress != "" {
+			ipAddrs = append(ipAddrs, n.IPAddress)
+		}
+	}
+	ipAddr := ""
+	if bridge := res.NetworkSettings.Networks["bridge"]; bridge != nil {
+		ipAddr = bridge.IPAddress
+	}
+	createTime := ""
+	if t, err := time.Parse(time.RFC3339Nano, res.Created); err == nil {
+		createTime = t.Format(time.RFC3339)
+	}
+	return &apiv1.HostInstance{
+		Name: res.ID,
+		Docker: &apiv1.DockerInstance{
+			ImageName: res.Config.Image,
+			IPAddress: ipAddr,
+		},
+		ExpireTime:  formatExpireTime(meta.ExpireTime),
+		Status:      dockerHostStatus(res.State.Status),
+		CreateTime:  createTime,
+		IPAddresses: ipAddrs,
+		Labels:      meta.Labels,
+		Owner:       meta.Owner,
+	}, nil
+}
+
 func (m *DockerInstanceManager) DeleteHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
 	if zone != "local" {
 		return nil, errors.NewBadRequestError("Invalid zone. It should be 'local'.", nil)
 	}
-	ctx := context.TODO()
-	owner, _ := m.getContainerLabel(host, dockerLabelCreatedBy)
-	if owner != user.Username() {
-		return nil, fmt.Errorf("User %s cannot delete docker host owned by %s", user.Username(), owner)
+	if _, err := m.checkContainerOwner(zone, user, host); err != nil {
+		return nil, err
+	}
+	return m.operations.Start(DeleteHostOPType, user, host, func(ctx context.Context, _ *operation.Operation) (any, error) {
+		return m.deleteHost(ctx, host)
+	})
+}
+
+func (m *DockerInstanceManager) ForceDeleteHost(zone string, admin accounts.User, host string) (*apiv1.Operation, error) {
+	if zone != "local" {
+		return nil, errors.NewBadRequestError("Invalid zone. It should be 'local'.", nil)
 	}
+	if _, err := m.Client.ContainerInspect(context.TODO(), host); err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Host %q not found.", host), err)
+		}
+		return nil, fmt.Errorf("Failed to inspect docker container: %w", err)
+	}
+	return m.operations.Start(DeleteHostOPType, admin, host, func(ctx context.Context, _ *operation.Operation) (any, error) {
+		return m.deleteHost(ctx, host)
+	})
+}
+
+func (m *DockerInstanceManager) deleteHost(ctx context.Context, host string) (*apiv1.HostInstance, error) {
 	err := m.Client.ContainerStop(ctx, host, container.StopOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("Failed to stop docker container: %w", err)
@@ -152,12 +352,86 @@ func (m *DockerInstanceManager) DeleteHost(zone string, user accounts.User, host
 	if err != nil {
 		return nil, fmt.Errorf("Failed to remove docker container: %w", err)
 	}
-	return &apiv1.Operation{
-		Name: EncodeOperationName(DeleteHostOPType, host),
-		Done: true,
+	m.forgetHost(host)
+	return &apiv1.HostInstance{
+		Name: host,
 	}, nil
 }
 
+func (m *DockerInstanceManager) StopHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	if _, err := m.checkContainerOwner(zone, user, host); err != nil {
+		return nil, err
+	}
+	return m.operations.Start(StopHostOPType, user, host, func(ctx context.Context, _ *operation.Operation) (any, error) {
+		if err := m.Client.ContainerStop(ctx, host, container.StopOptions{}); err != nil {
+			return nil, fmt.Errorf("Failed to stop docker container: %w", err)
+		}
+		return &apiv1.HostInstance{Name: host}, nil
+	})
+}
+
+func (m *DockerInstanceManager) StartHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	if _, err := m.checkContainerOwner(zone, user, host); err != nil {
+		return nil, err
+	}
+	res, err := m.Client.ContainerInspect(context.TODO(), host)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect docker container: %w", err)
+	}
+	if res.State.Paused {
+		return m.operations.Start(ResumeHostOPType, user, host, func(ctx context.Context, _ *operation.Operation) (any, error) {
+			if err := m.Client.ContainerUnpause(ctx, host); err != nil {
+				return nil, fmt.Errorf("Failed to unpause docker container: %w", err)
+			}
+			return m.waitContainerRunning(ctx, host)
+		})
+	}
+	return m.operations.Start(StartHostOPType, user, host, func(ctx context.Context, _ *operation.Operation) (any, error) {
+		if err := m.Client.ContainerStart(ctx, host, types.ContainerStartOptions{}); err != nil {
+			return nil, fmt.Errorf("Failed to start docker container: %w", err)
+		}
+		return m.waitContainerRunning(ctx, host)
+	})
+}
+
+// Docker containers are suspended by pausing their processes.
+func (m *DockerInstanceManager) SuspendHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	if _, err := m.checkContainerOwner(zone, user, host); err != nil {
+		return nil, err
+	}
+	return m.operations.Start(SuspendHostOPType, user, host, func(ctx context.Context, _ *operation.Operation) (any, error) {
+		if err := m.Client.ContainerPause(ctx, host); err != nil {
+			return nil, fmt.Errorf("Failed to pause docker container: %w", err)
+		}
+		return &apiv1.HostInstance{Name: host}, nil
+	})
+}
+
+// Returns the metadata of the host. Hosts owned by other users are reported as not found.
+func (m *DockerInstanceManager) checkContainerOwner(zone string, user accounts.User, host string) (*hostmeta.Metadata, error) {
+	if zone != "local" {
+		return nil, errors.NewBadRequestError("Invalid zone. It should be 'local'.", nil)
+	}
+	inspect, err := m.Client.ContainerInspect(context.TODO(), host)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("Host %q not found.", host), err)
+		}
+		return nil, fmt.Errorf("Failed to inspect docker container: %w", err)
+	}
+	meta, err := m.fetchContainerMetadata(inspect.ID, inspect.Config.Labels)
+	if err != nil || meta.Owner != user.Username() {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Host %q not found.", host), err)
+	}
+	return meta, nil
+}
+
+// Marks the operations abandoned by previous executions of the orchestrator as failed, returns
+// how many were marked.
+func (m *DockerInstanceManager) FailStaleOperations() (int, error) {
+	return m.operations.FailStaleOperations()
+}
+
 func EncodeOperationName(opType OPType, host string) string {
 	return string(opType) + "_" + host
 }
@@ -171,21 +445,34 @@ func DecodeOperationName(name string) (OPType, string, error) {
 	}
 }
 
-func (m *DockerInstanceManager) waitCreateHostOperation(host string) (*apiv1.HostInstance, error) {
-	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Minute)
+func (m *DockerInstanceManager) waitContainerRunning(ctx context.Context, host string) (*apiv1.HostInstance, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
 	defer cancel()
 	for {
 		select {
 		case <-ctx.Done():
-			return nil, errors.NewServiceUnavailableError("Wait for operation timed out", nil)
+			return nil, errors.NewServiceUnavailableError("Wait for container to run timed out", nil)
 		default:
 			res, err := m.Client.ContainerInspect(ctx, host)
 			if err != nil {
 				return nil, fmt.Errorf("Failed to inspect docker container: %w", err)
 			}
 			if res.State.Running {
+				meta, err := m.fetchContainerMetadata(host, res.Config.Labels)
+				if err != nil {
+					return nil, err
+				}
+				ipAddr := ""
+				if bridge := res.NetworkSettings.Networks["bridge"]; bridge != nil {
+					ipAddr = bridge.IPAddress
+				}
 				return &apiv1.HostInstance{
 					Name: host,
+					Docker: &apiv1.DockerInstance{
+						ImageName: res.Config.Image,
+						IPAddress: ipAddr,
+					},
+					ExpireTime: formatExpireTime(meta.ExpireTime),
 				}, nil
 			}
 			time.Sleep(time.Second)
@@ -193,38 +480,367 @@ func (m *DockerInstanceManager) waitCreateHostOperation(host string) (*apiv1.Hos
 	}
 }
 
-func (m *DockerInstanceManager) waitDeleteHostOperation(host string) (*apiv1.HostInstance, error) {
-	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Minute)
-	defer cancel()
-	resCh, errCh := m.Client.ContainerWait(ctx, host, "")
-	select {
-	case <-ctx.Done():
-		return nil, errors.NewServiceUnavailableError("Wait for operation timed out", nil)
-	case err := <-errCh:
-		return nil, fmt.Errorf("Error is thrown while waiting for deleting host: %w", err)
-	case <-resCh:
-		return &apiv1.HostInstance{
-			Name: host,
-		}, nil
+func (m *DockerInstanceManager) WaitOperation(zone string, user accounts.User, name string) (any, error) {
+	if zone != "local" {
+		return nil, errors.NewBadRequestError("Invalid zone. It should be 'local'.", nil)
+	}
+	return m.operations.Wait(user, name)
+}
+
+func (m *DockerInstanceManager) ListOperations(zone string, user accounts.User, req *ListOperationsRequest) (*apiv1.ListOperationsResponse, error) {
+	if zone != "local" {
+		return nil, errors.NewBadRequestError("Invalid zone. It should be 'local'.", nil)
 	}
+	return m.operations.List(user, req)
 }
 
-func (m *DockerInstanceManager) WaitOperation(zone string, _ accounts.User, name string) (any, error) {
+func (m *DockerInstanceManager) CancelOperation(zone string, user accounts.User, name string) (*apiv1.Operation, error) {
 	if zone != "local" {
 		return nil, errors.NewBadRequestError("Invalid zone. It should be 'local'.", nil)
 	}
-	opType, host, err := DecodeOperationName(name)
+	return m.operations.Cancel(user, name)
+}
+
+// The new expiration time is stored in the host metadata, it overrides the container label.
+func (m *DockerInstanceManager) ExtendHost(zone string, user accounts.User, host string, req *apiv1.ExtendHostRequest) (*apiv1.HostInstance, error) {
+	if req.TTLSeconds <= 0 {
+		return nil, errors.NewBadRequestError("The time to live must be a positive number of seconds", nil)
+	}
+	err := m.updateHostMetadata(zone, user, host, func(meta *hostmeta.Metadata) {
+		meta.ExpireTime = expireTimeFromTTL(req.TTLSeconds)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.GetHost(zone, user, host)
+}
+
+// The new labels are stored in the host metadata, they override the container labels.
+func (m *DockerInstanceManager) SetHostLabels(zone string, user accounts.User, host string, req *apiv1.SetHostLabelsRequest) (*apiv1.HostInstance, error) {
+	if err := validateUserLabels(req.Labels); err != nil {
+		return nil, err
+	}
+	err := m.updateHostMetadata(zone, user, host, func(meta *hostmeta.Metadata) {
+		meta.Labels = req.Labels
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.GetHost(zone, user, host)
+}
+
+func (m *DockerInstanceManager) DeleteExpiredHosts() ([]*ExpiredHost, error) {
+	ctx := context.TODO()
+	hosts, err := m.listDockerHosts(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var deleted []*ExpiredHost
+	for _, h := range hosts {
+		t := h.meta.ExpireTime
+		if t.IsZero() || t.After(now) {
+			continue
+		}
+		opts := types.ContainerRemoveOptions{Force: true}
+		if err := m.Client.ContainerRemove(ctx, h.container.ID, opts); err != nil {
+			return deleted, fmt.Errorf("Failed to remove docker container: %w", err)
+		}
+		m.forgetHost(h.container.ID)
+		deleted = append(deleted, &ExpiredHost{
+			Zone:       "local",
+			Name:       h.container.ID,
+			Owner:      h.meta.Owner,
+			ExpireTime: t,
+		})
+	}
+	return deleted, m.deleteOrphanMetadata(ctx, hosts)
+}
+
+func (m *DockerInstanceManager) listRunningHosts() ([]*runningHost, error) {
+	hosts, err := m.listDockerHosts(context.TODO(), false)
+	if err != nil {
+		return nil, err
+	}
+	var res []*runningHost
+	for _, h := range hosts {
+		// Paused containers are listed along with the running ones, but they are suspended.
+		if h.meta.Owner == "" || h.container.State == "paused" {
+			continue
+		}
+		res = append(res, &runningHost{
+			Zone:  "local",
+			Name:  h.container.ID,
+			Owner: h.meta.Owner,
+		})
+	}
+	return res, nil
+}
+
+// Hosts being created count before their containers exist. Creations are listed first, so a
+// container created in between is counted twice rather than missed.
+func (m *DockerInstanceManager) listHostsUsage() ([]*hostUsage, error) {
+	creations, err := m.operations.listUnfinished(CreateHostOPType)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := m.listDockerHosts(context.TODO(), true)
+	if err != nil {
+		return nil, err
+	}
+	var res []*hostUsage
+	for _, op := range creations {
+		// The host of the operation is set once its container exists.
+		if op.Host == "" {
+			res = append(res, &hostUsage{Zone: "local", Owner: op.Username})
+		}
+	}
+	// Unassigned pool containers have no owner.
+	for _, h := range hosts {
+		res = append(res, &hostUsage{
+			Zone:  "local",
+			Owner: h.meta.Owner,
+		})
+	}
+	return res, nil
+}
+
+// A container created by the orchestrator along with its metadata.
+type dockerHost struct {
+	container types.Container
+	meta      *hostmeta.Metadata
+}
+
+// Lists the containers created by the orchestrator, including those of the warm pool. Unassigned
+// pool containers have no owner.
+func (m *DockerInstanceManager) listDockerHosts(ctx context.Context, all bool) ([]*dockerHost, error) {
+	var containers []types.Container
+	// Label filters are combined with a logical and, so each label is listed separately.
+	for _, label := range []string{dockerLabelCreatedBy, dockerLabelPool} {
+		listRes, err := m.Client.ContainerList(ctx, types.ContainerListOptions{
+			All:     all,
+			Filters: filters.NewArgs(filters.KeyValuePair{Key: "label", Value: label}),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list docker containers: %w", err)
+		}
+		containers = append(containers, listRes...)
+	}
+	stored, err := m.dbs.ListHostMetadata("local")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list host metadata: %w", err)
+	}
+	storedByHost := make(map[string]*hostmeta.Metadata)
+	for _, meta := range stored {
+		storedByHost[meta.Host] = meta
+	}
+	var res []*dockerHost
+	for _, c := range containers {
+		meta, err := m.containerMetadata(c.ID, c.Labels, storedByHost[c.ID])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &dockerHost{container: c, meta: meta})
+	}
+	return res, nil
+}
+
+func (m *DockerInstanceManager) fetchContainerMetadata(id string, labels map[string]string) (*hostmeta.Metadata, error) {
+	stored, err := m.dbs.FetchHostMetadata("local", id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve host metadata: %w", err)
+	}
+	return m.containerMetadata(id, labels, stored)
+}
+
+// Stored metadata takes precedence over the labels the container was created with.
+func (m *DockerInstanceManager) containerMetadata(id string, labels map[string]string, stored *hostmeta.Metadata) (*hostmeta.Metadata, error) {
+	if stored != nil {
+		return stored, nil
+	}
+	meta := &hostmeta.Metadata{
+		Zone:       "local",
+		Host:       id,
+		Owner:      labels[dockerLabelCreatedBy],
+		Labels:     containerUserLabels(labels),
+		ExpireTime: containerExpireTime(id, labels),
+	}
+	_, created := labels[dockerLabelCreatedBy]
+	_, pooled := labels[dockerLabelPool]
+	if !created && !pooled {
+		return nil, fmt.Errorf("Failed to find docker label: %s", dockerLabelCreatedBy)
+	}
+	return meta, nil
+}
+
+// Applies the update to the metadata of a host owned by the user and stores it.
+func (m *DockerInstanceManager) updateHostMetadata(zone string, user accounts.User, host string, update func(*hostmeta.Metadata)) error {
+	m.metadataMtx.Lock()
+	defer m.metadataMtx.Unlock()
+	meta, err := m.checkContainerOwner(zone, user, host)
+	if err != nil {
+		return err
+	}
+	update(meta)
+	if err := m.dbs.StoreHostMetadata(*meta); err != nil {
+		return fmt.Errorf("Failed to store host metadata: %w", err)
+	}
+	return nil
+}
+
+// Removed containers leave no metadata nor access control list behind, failures are only logged
+// since the container is already gone and the reaper deletes orphan metadata eventually.
+func (m *DockerInstanceManager) forgetHost(host string) {
+	if err := m.dbs.DeleteHostMetadata("local", host); err != nil {
+		log.Printf("failed to delete metadata of docker container %q: %v", host, err)
+	}
+	deleteHostACL(m.dbs, "local", host)
+}
+
+// Deletes the metadata of the containers that no longer exist, i.e: removed outside the
+// orchestrator.
+func (m *DockerInstanceManager) deleteOrphanMetadata(ctx context.Context, hosts []*dockerHost) error {
+	listed := make(map[string]bool)
+	for _, h := range hosts {
+		listed[h.container.ID] = true
+	}
+	stored, err := m.dbs.ListHostMetadata("local")
+	if err != nil {
+		return fmt.Errorf("Failed to list host metadata: %w", err)
+	}
+	for _, meta := range stored {
+		if listed[meta.Host] {
+			continue
+		}
+		// The container may have been created after the hosts were listed.
+		_, err := m.Client.ContainerInspect(ctx, meta.Host)
+		if err == nil {
+			continue
+		}
+		if !client.IsErrNotFound(err) {
+			return fmt.Errorf("Failed to inspect docker container: %w", err)
+		}
+		if err := m.dbs.DeleteHostMetadata("local", meta.Host); err != nil {
+			return fmt.Errorf("Failed to delete host metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m *DockerInstanceManager) listPoolHosts(pool *WarmPoolConfig) ([]*poolHost, error) {
+	listRes, err := m.listDockerHosts(context.TODO(), true)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []*poolHost
+	for _, h := range listRes {
+		c := h.container
+		if _, ok := c.Labels[dockerLabelPool]; !ok || h.meta.Owner != "" {
+			continue
+		}
+		if c.State == "exited" || c.State == "dead" {
+			continue
+		}
+		hosts = append(hosts, &poolHost{Name: c.ID, Ready: c.State == "running"})
+	}
+	return hosts, nil
+}
+
+func (m *DockerInstanceManager) createPoolHost(pool *WarmPoolConfig) error {
+	ctx := context.TODO()
+	id, err := m.createContainer(ctx, map[string]string{dockerLabelPool: "true"})
 	if err != nil {
+		return err
+	}
+	if err := m.Client.ContainerStart(ctx, id, types.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("Failed to start docker container: %w", err)
+	}
+	return nil
+}
+
+// Pool containers are created without owner, the owner, labels and expiration time are stored in
+// the host metadata when handing them out.
+func (m *DockerInstanceManager) assignPoolHost(pool *WarmPoolConfig, host string, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error) {
+	userLabels, err := validateDockerRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	m.metadataMtx.Lock()
+	defer m.metadataMtx.Unlock()
+	stored, err := m.dbs.FetchHostMetadata("local", host)
+	if err != nil || stored != nil {
 		return nil, err
 	}
-	switch opType {
-	case CreateHostOPType:
-		return m.waitCreateHostOperation(host)
-	case DeleteHostOPType:
-		return m.waitDeleteHostOperation(host)
+	meta := hostmeta.Metadata{
+		Zone:       "local",
+		Host:       host,
+		Owner:      user.Username(),
+		Labels:     userLabels,
+		ExpireTime: expireTimeFromTTL(req.TTLSeconds),
+	}
+	if err := m.dbs.StoreHostMetadata(meta); err != nil {
+		return nil, fmt.Errorf("Failed to store host metadata: %w", err)
+	}
+	return m.operations.Start(CreateHostOPType, user, host, func(ctx context.Context, _ *operation.Operation) (any, error) {
+		return m.waitContainerRunning(ctx, host)
+	})
+}
+
+func (m *DockerInstanceManager) validatePoolConfig(pool *WarmPoolConfig) error {
+	if pool.Zone != "local" {
+		return fmt.Errorf("invalid warm pool zone %q, it should be 'local'", pool.Zone)
+	}
+	if pool.MachineType != "" {
+		return fmt.Errorf("docker warm pools have no machine type")
+	}
+	return nil
+}
+
+// Returns the zero time if the container never expires.
+func containerExpireTime(host string, labels map[string]string) time.Time {
+	v, ok := labels[dockerLabelExpireTime]
+	if !ok {
+		return time.Time{}
+	}
+	t, err := parseExpireTimeLabel(v)
+	if err != nil {
+		log.Printf("invalid expire time label %q in docker container %q: %v", v, host, err)
+		return time.Time{}
+	}
+	return t
+}
+
+// Maps the state of docker containers to the lifecycle status of hosts.
+func dockerHostStatus(state string) string {
+	switch state {
+	case "created", "restarting":
+		return HostStatusProvisioning
+	case "running":
+		return HostStatusRunning
+	case "removing":
+		return HostStatusStopping
+	case "paused":
+		return HostStatusSuspended
+	case "exited", "dead":
+		return HostStatusTerminated
 	default:
-		return nil, errors.NewBadRequestError(fmt.Sprintf("operation type %s not found.", opType), nil)
+		return strings.ToUpper(state)
+	}
+}
+
+// Labels set by the orchestrator are left out.
+func containerUserLabels(labels map[string]string) map[string]string {
+	var res map[string]string
+	for k, v := range labels {
+		if isReservedLabelKey(k) {
+			continue
+		}
+		if res == nil {
+			res = make(map[string]string)
+		}
+		res[k] = v
 	}
+	return res
 }
 
 func (m *DockerInstanceManager) getIpAddr(container *types.Container) (string, error) {
@@ -280,16 +896,3 @@ func (m *DockerInstanceManager) GetHostClient(zone string, host string) (HostCli
 	}
 	return NewNetHostClient(url, m.Config.AllowSelfSignedHostSSLCertificate), nil
 }
-
-func (m *DockerInstanceManager) getContainerLabel(host string, key string) (string, error) {
-	ctx := context.TODO()
-	inspect, err := m.Client.ContainerInspect(ctx, host)
-	if err != nil {
-		return "", fmt.Errorf("Failed to inspect container: %w", err)
-	}
-	value, exist := inspect.Config.Labels[key]
-	if !exist {
-		return "", fmt.Errorf("Failed to find docker label: %s", key)
-	}
-	return value, nil
-}
@@ -18,14 +18,21 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"path"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
 	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
 	"github.com/google/cloud-android-orchestration/pkg/app/errors"
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
 
+	"github.com/hashicorp/go-multierror"
 	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/googleapi"
 )
@@ -38,26 +45,38 @@ type GCPIMConfig struct {
 	HostOrchestratorPort int
 	// If true, instances created should be compatible with `acloud CLI`.
 	AcloudCompatible bool
+	// How idle hosts are reclaimed.
+	IdlePolicy IdlePolicy
+	// Pools of pre-booted hosts.
+	WarmPools []WarmPoolConfig
 }
 
 const (
 	labelPrefix          = "cf-"
 	labelAcloudCreatedBy = "created_by" // required for acloud backwards compatibility
 	labelCreatedBy       = labelPrefix + "created_by"
+	labelExpireTime      = labelPrefix + "expire_time"
+	// Set in unassigned warm pool hosts, the value is the machine type.
+	labelPool = labelPrefix + "pool"
 )
 
 // GCP implementation of the instance manager.
+//
+// Compute operations don't tell on whose behalf they were started, so the user starting each of
+// them is recorded through the database service.
 type GCEInstanceManager struct {
 	Config                Config
 	Service               *compute.Service
 	InstanceNameGenerator NameGenerator
+	dbs                   database.Service
 }
 
-func NewGCEInstanceManager(cfg Config, service *compute.Service, nameGenerator NameGenerator) *GCEInstanceManager {
+func NewGCEInstanceManager(cfg Config, service *compute.Service, nameGenerator NameGenerator, dbs database.Service) *GCEInstanceManager {
 	return &GCEInstanceManager{
 		Config:                cfg,
 		Service:               service,
 		InstanceNameGenerator: nameGenerator,
+		dbs:                   dbs,
 	}
 }
 
@@ -105,6 +124,26 @@ func (m *GCEInstanceManager) CreateHost(zone string, req *apiv1.CreateHostReques
 	if err := validateRequest(req); err != nil {
 		return nil, err
 	}
+	payload := m.buildInstance(zone, req)
+	payload.Labels[labelCreatedBy] = user.Username()
+	if m.Config.GCP.AcloudCompatible {
+		payload.Labels[labelAcloudCreatedBy] = user.Username()
+	}
+	if expireTime := expireTimeFromTTL(req.TTLSeconds); !expireTime.IsZero() {
+		payload.Labels[labelExpireTime] = expireTimeLabelValue(expireTime)
+	}
+	op, err := m.Service.Instances.
+		Insert(m.Config.GCP.ProjectID, zone, payload).
+		Context(context.TODO()).
+		Do()
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	return m.recordOperation(op, CreateHostOPType, user, payload.Name), nil
+}
+
+// Builds the instance to insert with the user labels but without any owner labels.
+func (m *GCEInstanceManager) buildInstance(zone string, req *apiv1.CreateHostRequest) *compute.Instance {
 	payload := &compute.Instance{
 		Name: m.InstanceNameGenerator.NewName(),
 		// This is required in the format: "zones/zone/machineTypes/machine-type".
@@ -133,9 +172,10 @@ func (m *GCEInstanceManager) CreateHost(zone string, req *apiv1.CreateHostReques
 				},
 			},
 		},
-		Labels: map[string]string{
-			labelCreatedBy: user.Username(),
-		},
+		Labels: map[string]string{},
+	}
+	for k, v := range req.HostInstance.Labels {
+		payload.Labels[k] = v
 	}
 	if len(req.HostInstance.GCP.AcceleratorConfigs) != 0 {
 		configs := []*compute.AcceleratorConfig{}
@@ -151,7 +191,6 @@ func (m *GCEInstanceManager) CreateHost(zone string, req *apiv1.CreateHostReques
 		}
 	}
 	if m.Config.GCP.AcloudCompatible {
-		payload.Labels[labelAcloudCreatedBy] = user.Username()
 		startupScript := acloudSetupScript
 		payload.Metadata = &compute.Metadata{
 			Items: []*compute.MetadataItems{
@@ -162,33 +201,73 @@ func (m *GCEInstanceManager) CreateHost(zone string, req *apiv1.CreateHostReques
 			},
 		}
 	}
-	op, err := m.Service.Instances.
-		Insert(m.Config.GCP.ProjectID, zone, payload).
+	return payload
+}
+
+const listHostsRequestMaxResultsLimit uint32 = 500
+
+func (m *GCEInstanceManager) ListHosts(zone string, user accounts.User, req *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
+	return m.listHosts(zone, user.Username(), req)
+}
+
+// Hosts of every zone are listed with a single aggregated request. Unassigned warm pool hosts have
+// no owner, they are not listed.
+func (m *GCEInstanceManager) ListAllHosts(req *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
+	res, err := m.Service.Instances.
+		AggregatedList(m.Config.GCP.ProjectID).
 		Context(context.TODO()).
+		MaxResults(int64(listHostsMaxResults(req))).
+		PageToken(req.PageToken).
+		Filter(listHostsFilter("*", req)).
 		Do()
 	if err != nil {
 		return nil, toAppError(err)
 	}
-	return &apiv1.Operation{Name: op.Name, Done: op.Status == operationStatusDone}, nil
+	scopes := make([]string, 0, len(res.Items))
+	for scope := range res.Items {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	var items []*apiv1.HostInstance
+	for _, scope := range scopes {
+		for _, item := range res.Items[scope].Instances {
+			hi, err := BuildHostInstance(item)
+			if err != nil {
+				return nil, err
+			}
+			hi.Zone = path.Base(item.Zone)
+			items = append(items, hi)
+		}
+	}
+	return &apiv1.ListHostsResponse{
+		Items:         items,
+		NextPageToken: res.NextPageToken,
+	}, nil
 }
 
-const listHostsRequestMaxResultsLimit uint32 = 500
-
-func (m *GCEInstanceManager) ListHosts(zone string, user accounts.User, req *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
-	var maxResults uint32
+func listHostsMaxResults(req *ListHostsRequest) uint32 {
 	if req.MaxResults <= listHostsRequestMaxResultsLimit {
-		maxResults = req.MaxResults
-	} else {
-		maxResults = listHostsRequestMaxResultsLimit
+		return req.MaxResults
 	}
-	statusFilterExpr := "status=RUNNING"
-	ownerFilterExpr := fmt.Sprintf("labels.%s:%s", labelCreatedBy, user.Username())
+	return listHostsRequestMaxResultsLimit
+}
+
+// The owner is either a username or `*` to match the hosts of every user.
+func listHostsFilter(owner string, req *ListHostsRequest) string {
+	filters := []string{fmt.Sprintf("labels.%s:%s", labelCreatedBy, owner)}
+	for _, r := range labelSelectorRequirements(req.LabelSelector) {
+		filters = append(filters, "labels."+r)
+	}
+	return strings.Join(filters, " AND ")
+}
+
+func (m *GCEInstanceManager) listHosts(zone string, owner string, req *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
 	res, err := m.Service.Instances.
 		List(m.Config.GCP.ProjectID, zone).
 		Context(context.TODO()).
-		MaxResults(int64(maxResults)).
+		MaxResults(int64(listHostsMaxResults(req))).
 		PageToken(req.PageToken).
-		Filter(fmt.Sprintf("%s AND %s", ownerFilterExpr, statusFilterExpr)).
+		Filter(listHostsFilter(owner, req)).
 		Do()
 	if err != nil {
 		return nil, toAppError(err)
@@ -207,6 +286,67 @@ func (m *GCEInstanceManager) ListHosts(zone string, user accounts.User, req *Lis
 	}, nil
 }
 
+func (m *GCEInstanceManager) GetHost(zone string, user accounts.User, host string) (*apiv1.HostInstance, error) {
+	ins, err := m.getUserHostInstance(zone, user, host)
+	if err != nil {
+		return nil, err
+	}
+	return BuildHostInstance(ins)
+}
+
+func (m *GCEInstanceManager) StopHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	if _, err := m.getUserHostInstance(zone, user, host); err != nil {
+		return nil, err
+	}
+	op, err := m.Service.Instances.
+		Stop(m.Config.GCP.ProjectID, zone, host).
+		Context(context.TODO()).
+		Do()
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	return m.recordOperation(op, StopHostOPType, user, host), nil
+}
+
+func (m *GCEInstanceManager) StartHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	ins, err := m.getUserHostInstance(zone, user, host)
+	if err != nil {
+		return nil, err
+	}
+	var op *compute.Operation
+	opType := StartHostOPType
+	if ins.Status == "SUSPENDED" {
+		opType = ResumeHostOPType
+		op, err = m.Service.Instances.
+			Resume(m.Config.GCP.ProjectID, zone, host).
+			Context(context.TODO()).
+			Do()
+	} else {
+		op, err = m.Service.Instances.
+			Start(m.Config.GCP.ProjectID, zone, host).
+			Context(context.TODO()).
+			Do()
+	}
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	return m.recordOperation(op, opType, user, host), nil
+}
+
+func (m *GCEInstanceManager) SuspendHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	if _, err := m.getUserHostInstance(zone, user, host); err != nil {
+		return nil, err
+	}
+	op, err := m.Service.Instances.
+		Suspend(m.Config.GCP.ProjectID, zone, host).
+		Context(context.TODO()).
+		Do()
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	return m.recordOperation(op, SuspendHostOPType, user, host), nil
+}
+
 func (m *GCEInstanceManager) DeleteHost(zone string, user accounts.User, name string) (*apiv1.Operation, error) {
 	nameFilterExpr := "name=" + name
 	ownerFilterExpr := fmt.Sprintf("labels.%s:%s", labelCreatedBy, user.Username())
@@ -221,14 +361,51 @@ func (m *GCEInstanceManager) DeleteHost(zone string, user accounts.User, name st
 	if len(res.Items) == 0 {
 		return nil, errors.NewBadRequestError(fmt.Sprintf("Host instance %q not found.", name), nil)
 	}
+	return m.deleteInstance(zone, user, name)
+}
+
+func (m *GCEInstanceManager) ForceDeleteHost(zone string, admin accounts.User, host string) (*apiv1.Operation, error) {
+	if _, err := m.getHostInstance(zone, host); err != nil {
+		return nil, err
+	}
+	return m.deleteInstance(zone, admin, host)
+}
+
+// Every host deletion goes through here.
+func (m *GCEInstanceManager) deleteInstance(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
 	op, err := m.Service.Instances.
-		Delete(m.Config.GCP.ProjectID, zone, name).
+		Delete(m.Config.GCP.ProjectID, zone, host).
 		Context(context.TODO()).
 		Do()
 	if err != nil {
 		return nil, toAppError(err)
 	}
-	return &apiv1.Operation{Name: op.Name, Done: op.Status == operationStatusDone}, nil
+	go m.forgetHostWhenDeleted(zone, host, op.Name)
+	return m.recordOperation(op, DeleteHostOPType, user, host), nil
+}
+
+// How long to wait for a host to be deleted before giving up on deleting its access control list.
+const forgetDeletedHostTimeout = 30 * time.Minute
+
+// Deletes the access control list of the host once the deletion operation succeeds, the host is
+// still shared if it fails.
+func (m *GCEInstanceManager) forgetHostWhenDeleted(zone, host, opName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), forgetDeletedHostTimeout)
+	defer cancel()
+	for {
+		op, err := m.Service.ZoneOperations.Wait(m.Config.GCP.ProjectID, zone, opName).Context(ctx).Do()
+		if err != nil {
+			log.Printf("failed to wait for the deletion of host %q in zone %q: %v", host, zone, err)
+			return
+		}
+		if op.Status != operationStatusDone {
+			continue
+		}
+		if op.Error == nil {
+			deleteHostACL(m.dbs, zone, host)
+		}
+		return
+	}
 }
 
 func (m *GCEInstanceManager) WaitOperation(zone string, user accounts.User, name string) (any, error) {
@@ -239,10 +416,451 @@ func (m *GCEInstanceManager) WaitOperation(zone string, user accounts.User, name
 	if op.Status != operationStatusDone {
 		return nil, errors.NewServiceUnavailableError("Wait for operation timed out", nil)
 	}
+	rec, err := m.dbs.FetchOperation(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch operation: %w", err)
+	}
+	if rec != nil {
+		m.finishRecord(rec, op)
+	}
 	getter := opResultGetter{Service: m.Service, Op: op}
 	return getter.Get()
 }
 
+func (m *GCEInstanceManager) ExtendHost(zone string, user accounts.User, host string, req *apiv1.ExtendHostRequest) (*apiv1.HostInstance, error) {
+	if req.TTLSeconds <= 0 {
+		return nil, errors.NewBadRequestError("The time to live must be a positive number of seconds", nil)
+	}
+	ins, err := m.getUserHostInstance(zone, user, host)
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string)
+	for k, v := range ins.Labels {
+		labels[k] = v
+	}
+	labels[labelExpireTime] = expireTimeLabelValue(expireTimeFromTTL(req.TTLSeconds))
+	setLabelsReq := &compute.InstancesSetLabelsRequest{
+		Labels:           labels,
+		LabelFingerprint: ins.LabelFingerprint,
+	}
+	_, err = m.Service.Instances.
+		SetLabels(m.Config.GCP.ProjectID, zone, host, setLabelsReq).
+		Context(context.TODO()).
+		Do()
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	ins.Labels = labels
+	return BuildHostInstance(ins)
+}
+
+func (m *GCEInstanceManager) SetHostLabels(zone string, user accounts.User, host string, req *apiv1.SetHostLabelsRequest) (*apiv1.HostInstance, error) {
+	if err := validateUserLabels(req.Labels); err != nil {
+		return nil, err
+	}
+	ins, err := m.getUserHostInstance(zone, user, host)
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string)
+	for k, v := range ins.Labels {
+		if isReservedLabelKey(k) {
+			labels[k] = v
+		}
+	}
+	for k, v := range req.Labels {
+		labels[k] = v
+	}
+	setLabelsReq := &compute.InstancesSetLabelsRequest{
+		Labels:           labels,
+		LabelFingerprint: ins.LabelFingerprint,
+	}
+	_, err = m.Service.Instances.
+		SetLabels(m.Config.GCP.ProjectID, zone, host, setLabelsReq).
+		Context(context.TODO()).
+		Do()
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	ins.Labels = labels
+	return BuildHostInstance(ins)
+}
+
+func (m *GCEInstanceManager) DeleteExpiredHosts() ([]*ExpiredHost, error) {
+	now := time.Now()
+	var expired []*ExpiredHost
+	err := m.Service.Instances.
+		AggregatedList(m.Config.GCP.ProjectID).
+		Filter(fmt.Sprintf("labels.%s:*", labelExpireTime)).
+		Pages(context.TODO(), func(l *compute.InstanceAggregatedList) error {
+			for _, scoped := range l.Items {
+				for _, in := range scoped.Instances {
+					if t := instanceExpireTime(in); !t.IsZero() && t.Before(now) {
+						expired = append(expired, &ExpiredHost{
+							Zone:       path.Base(in.Zone),
+							Name:       in.Name,
+							Owner:      in.Labels[labelCreatedBy],
+							ExpireTime: t,
+						})
+					}
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	var deleted []*ExpiredHost
+	var merr error
+	for _, h := range expired {
+		if _, err := m.deleteInstance(h.Zone, hostOwner(h.Owner), h.Name); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to delete host %q: %w", h.Name, err))
+			continue
+		}
+		deleted = append(deleted, h)
+	}
+	return deleted, merr
+}
+
+func (m *GCEInstanceManager) listRunningHosts() ([]*runningHost, error) {
+	var hosts []*runningHost
+	err := m.Service.Instances.
+		AggregatedList(m.Config.GCP.ProjectID).
+		Filter(fmt.Sprintf("labels.%s:* AND status=RUNNING", labelCreatedBy)).
+		Pages(context.TODO(), func(l *compute.InstanceAggregatedList) error {
+			for _, scoped := range l.Items {
+				for _, in := range scoped.Instances {
+					hosts = append(hosts, &runningHost{
+						Zone:  path.Base(in.Zone),
+						Name:  in.Name,
+						Owner: in.Labels[labelCreatedBy],
+					})
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	return hosts, nil
+}
+
+func (m *GCEInstanceManager) listHostsUsage() ([]*hostUsage, error) {
+	var hosts []*hostUsage
+	err := m.Service.Instances.
+		AggregatedList(m.Config.GCP.ProjectID).
+		Filter(fmt.Sprintf("(labels.%s:*) OR (labels.%s:*)", labelCreatedBy, labelPool)).
+		Pages(context.TODO(), func(l *compute.InstanceAggregatedList) error {
+			for _, scoped := range l.Items {
+				for _, in := range scoped.Instances {
+					var accelerators int64
+					for _, c := range in.GuestAccelerators {
+						accelerators += c.AcceleratorCount
+					}
+					hosts = append(hosts, &hostUsage{
+						Zone:         path.Base(in.Zone),
+						Owner:        in.Labels[labelCreatedBy],
+						Accelerators: accelerators,
+					})
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	return hosts, nil
+}
+
+func (m *GCEInstanceManager) listPoolHosts(pool *WarmPoolConfig) ([]*poolHost, error) {
+	var hosts []*poolHost
+	err := m.Service.Instances.
+		List(m.Config.GCP.ProjectID, pool.Zone).
+		Filter(fmt.Sprintf("labels.%s=%s", labelPool, pool.MachineType)).
+		Pages(context.TODO(), func(l *compute.InstanceList) error {
+			for _, in := range l.Items {
+				if _, ok := in.Labels[labelCreatedBy]; ok {
+					continue
+				}
+				switch in.Status {
+				case "STOPPING", "TERMINATED", "SUSPENDING", "SUSPENDED":
+					continue
+				}
+				hosts = append(hosts, &poolHost{Name: in.Name, Ready: in.Status == "RUNNING"})
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	return hosts, nil
+}
+
+func (m *GCEInstanceManager) createPoolHost(pool *WarmPoolConfig) error {
+	req := &apiv1.CreateHostRequest{
+		HostInstance: &apiv1.HostInstance{
+			GCP: &apiv1.GCPInstance{MachineType: pool.MachineType},
+		},
+	}
+	payload := m.buildInstance(pool.Zone, req)
+	payload.Labels[labelPool] = pool.MachineType
+	_, err := m.Service.Instances.
+		Insert(m.Config.GCP.ProjectID, pool.Zone, payload).
+		Context(context.TODO()).
+		Do()
+	if err != nil {
+		return toAppError(err)
+	}
+	return nil
+}
+
+// Pool hosts are labeled with their machine type, which is how requests are matched to pools.
+func (m *GCEInstanceManager) validatePoolConfig(pool *WarmPoolConfig) error {
+	if pool.MachineType == "" {
+		return fmt.Errorf("missing machine type of warm pool in zone %q", pool.Zone)
+	}
+	return nil
+}
+
+// The label fingerprint guarantees the host isn't handed to more than one user.
+func (m *GCEInstanceManager) assignPoolHost(pool *WarmPoolConfig, host string, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+	ins, err := m.getHostInstance(pool.Zone, host)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ins.Labels[labelCreatedBy]; ok || ins.Labels[labelPool] != pool.MachineType {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for k, v := range ins.Labels {
+		labels[k] = v
+	}
+	delete(labels, labelPool)
+	for k, v := range req.HostInstance.Labels {
+		labels[k] = v
+	}
+	labels[labelCreatedBy] = user.Username()
+	if m.Config.GCP.AcloudCompatible {
+		labels[labelAcloudCreatedBy] = user.Username()
+	}
+	if expireTime := expireTimeFromTTL(req.TTLSeconds); !expireTime.IsZero() {
+		labels[labelExpireTime] = expireTimeLabelValue(expireTime)
+	}
+	setLabelsReq := &compute.InstancesSetLabelsRequest{
+		Labels:           labels,
+		LabelFingerprint: ins.LabelFingerprint,
+	}
+	op, err := m.Service.Instances.
+		SetLabels(m.Config.GCP.ProjectID, pool.Zone, host, setLabelsReq).
+		Context(context.TODO()).
+		Do()
+	if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusPreconditionFailed {
+		// Taken by someone else in the meantime.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	return m.recordOperation(op, CreateHostOPType, user, host), nil
+}
+
+// Maps the operation types exposed by the API to the compute operation types.
+var gceOperationTypes = map[string]string{
+	string(CreateHostOPType):  "insert",
+	string(DeleteHostOPType):  "delete",
+	string(StopHostOPType):    "stop",
+	string(StartHostOPType):   "start",
+	string(SuspendHostOPType): "suspend",
+	string(ResumeHostOPType):  "resume",
+}
+
+const listOperationsRequestMaxResultsLimit uint32 = 500
+
+func (m *GCEInstanceManager) ListOperations(zone string, user accounts.User, req *ListOperationsRequest) (*apiv1.ListOperationsResponse, error) {
+	recs, err := m.dbs.ListOperations(operation.Filter{Username: user.Username()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+	started := make(map[string]*operation.Operation)
+	for _, rec := range recs {
+		started[rec.Name] = rec
+	}
+	var filters []string
+	if req.Type != "" {
+		opType, ok := gceOperationTypes[req.Type]
+		if !ok {
+			return nil, errors.NewBadRequestError(fmt.Sprintf("Invalid operation type: %q", req.Type), nil)
+		}
+		filters = append(filters, "operationType="+opType)
+	}
+	switch state := operation.State(req.State); state {
+	case "":
+	case operation.PendingState, operation.RunningState:
+		filters = append(filters, "status="+string(state))
+	case operation.DoneState, operation.ErrorState:
+		filters = append(filters, "status="+operationStatusDone)
+	default:
+		return nil, errors.NewBadRequestError(fmt.Sprintf("Invalid operation state: %q", req.State), nil)
+	}
+	maxResults := req.MaxResults
+	if maxResults > listOperationsRequestMaxResultsLimit {
+		maxResults = listOperationsRequestMaxResultsLimit
+	}
+	res, err := m.Service.ZoneOperations.
+		List(m.Config.GCP.ProjectID, zone).
+		Context(context.TODO()).
+		MaxResults(int64(maxResults)).
+		PageToken(req.PageToken).
+		Filter(strings.Join(filters, " AND ")).
+		Do()
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	items := []*apiv1.Operation{}
+	for _, op := range res.Items {
+		// Operations started by the user are listed even if their host is gone already.
+		rec, ok := started[op.Name]
+		if !ok {
+			continue
+		}
+		if op.Status == operationStatusDone {
+			m.finishRecord(rec, op)
+		}
+		apiOp := buildGCEAPIOperation(op, user)
+		if req.State != "" && apiOp.Metadata.State != req.State {
+			continue
+		}
+		items = append(items, apiOp)
+	}
+	return &apiv1.ListOperationsResponse{
+		Items:         items,
+		NextPageToken: res.NextPageToken,
+	}, nil
+}
+
+// Cancels a host creation by deleting the instance being created.
+func (m *GCEInstanceManager) CancelOperation(zone string, user accounts.User, name string) (*apiv1.Operation, error) {
+	op, err := m.Service.ZoneOperations.
+		Get(m.Config.GCP.ProjectID, zone, name).
+		Context(context.TODO()).
+		Do()
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	matches := instanceTargetLinkRe.FindStringSubmatch(op.TargetLink)
+	if len(matches) != 4 {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Operation %q not found.", name), nil)
+	}
+	hosts, err := m.listUserHostNames(zone, user)
+	if err != nil {
+		return nil, err
+	}
+	if !hosts[matches[3]] {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Operation %q not found.", name), nil)
+	}
+	if op.OperationType != "insert" {
+		return nil, errors.NewBadRequestError("Only host creation operations can be cancelled.", nil)
+	}
+	if op.Status == operationStatusDone {
+		return nil, errors.NewBadRequestError(fmt.Sprintf("Operation %q is already done.", name), nil)
+	}
+	_, err = m.Service.Instances.
+		Delete(m.Config.GCP.ProjectID, zone, matches[3]).
+		Context(context.TODO()).
+		Do()
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	return buildGCEAPIOperation(op, user), nil
+}
+
+// Records the user who started the operation. Failures are only logged since the operation was
+// started already, it's just not listed then.
+func (m *GCEInstanceManager) recordOperation(op *compute.Operation, opType OPType, user accounts.User, host string) *apiv1.Operation {
+	now := time.Now()
+	rec := operation.Operation{
+		Name:       op.Name,
+		Type:       string(opType),
+		Username:   operationUser(user).Username(),
+		Host:       host,
+		State:      operation.PendingState,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err := m.dbs.CreateOrUpdateOperation(rec); err != nil {
+		log.Printf("failed to record operation %q: %v", op.Name, err)
+	}
+	return &apiv1.Operation{Name: op.Name, Done: op.Status == operationStatusDone}
+}
+
+// Stores the final state of a recorded operation once it's done, so the record is eventually
+// garbage collected.
+func (m *GCEInstanceManager) finishRecord(rec *operation.Operation, op *compute.Operation) {
+	if rec.Done() {
+		return
+	}
+	rec.State = operation.DoneState
+	if op.Error != nil {
+		rec.State = operation.ErrorState
+	}
+	rec.UpdateTime = time.Now()
+	if _, err := m.dbs.UpdateUnfinishedOperation(*rec); err != nil {
+		log.Printf("failed to update operation %q: %v", op.Name, err)
+	}
+}
+
+// Returns the set of names of the hosts owned by the given user, regardless of their status.
+func (m *GCEInstanceManager) listUserHostNames(zone string, user accounts.User) (map[string]bool, error) {
+	ownerFilterExpr := fmt.Sprintf("labels.%s:%s", labelCreatedBy, user.Username())
+	names := make(map[string]bool)
+	err := m.Service.Instances.
+		List(m.Config.GCP.ProjectID, zone).
+		Filter(ownerFilterExpr).
+		Pages(context.TODO(), func(l *compute.InstanceList) error {
+			for _, item := range l.Items {
+				names[item.Name] = true
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, toAppError(err)
+	}
+	return names, nil
+}
+
+func buildGCEAPIOperation(op *compute.Operation, user accounts.User) *apiv1.Operation {
+	opType := op.OperationType
+	for k, v := range gceOperationTypes {
+		if v == op.OperationType {
+			opType = k
+		}
+	}
+	state := op.Status
+	if op.Status == operationStatusDone && op.Error != nil {
+		state = string(operation.ErrorState)
+	}
+	host := ""
+	if matches := instanceTargetLinkRe.FindStringSubmatch(op.TargetLink); len(matches) == 4 {
+		host = matches[3]
+	}
+	return &apiv1.Operation{
+		Name: op.Name,
+		Metadata: &apiv1.OperationMetadata{
+			Type:       opType,
+			User:       user.Username(),
+			Host:       host,
+			State:      state,
+			CreateTime: op.CreationTimestamp,
+			UpdateTime: op.EndTime,
+		},
+		Done: op.Status == operationStatusDone,
+	}
+}
+
 func (m *GCEInstanceManager) GetHostClient(zone string, host string) (HostClient, error) {
 	url, err := m.GetHostURL(zone, host)
 	if err != nil {
@@ -262,15 +880,29 @@ func (m *GCEInstanceManager) getHostInstance(zone string, host string) (*compute
 	return ins, nil
 }
 
+// Hosts owned by other users are reported as not found.
+func (m *GCEInstanceManager) getUserHostInstance(zone string, user accounts.User, host string) (*compute.Instance, error) {
+	ins, err := m.getHostInstance(zone, host)
+	if err != nil {
+		return nil, err
+	}
+	if ins.Labels[labelCreatedBy] != user.Username() {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Host instance %q not found.", host), nil)
+	}
+	return ins, nil
+}
+
 func validateRequest(r *apiv1.CreateHostRequest) error {
 	if r.HostInstance == nil ||
 		r.HostInstance.Name != "" ||
 		r.HostInstance.BootDiskSizeGB != 0 ||
+		r.HostInstance.ExpireTime != "" ||
+		r.TTLSeconds < 0 ||
 		r.HostInstance.GCP == nil ||
 		r.HostInstance.GCP.MachineType == "" {
 		return errors.NewBadRequestError("invalid CreateHostRequest", nil)
 	}
-	return nil
+	return validateUserLabels(r.HostInstance.Labels)
 }
 
 func buildDefaultNetworkName(projectID string) string {
@@ -293,9 +925,89 @@ func BuildHostInstance(in *compute.Instance) (*apiv1.HostInstance, error) {
 			MachineType:    path.Base(in.MachineType),
 			MinCPUPlatform: in.MinCpuPlatform,
 		},
+		ExpireTime:  formatExpireTime(instanceExpireTime(in)),
+		Status:      gceHostStatus(in.Status),
+		CreateTime:  formatCreationTimestamp(in),
+		IPAddresses: instanceIPAddresses(in),
+		Labels:      instanceUserLabels(in),
+		Owner:       in.Labels[labelCreatedBy],
 	}, nil
 }
 
+// Maps the status of GCE instances to the lifecycle status of hosts.
+func gceHostStatus(status string) string {
+	switch status {
+	case "PROVISIONING", "STAGING", "REPAIRING":
+		return HostStatusProvisioning
+	case "RUNNING":
+		return HostStatusRunning
+	case "STOPPING", "SUSPENDING":
+		return HostStatusStopping
+	case "SUSPENDED":
+		return HostStatusSuspended
+	case "STOPPED", "TERMINATED":
+		return HostStatusTerminated
+	default:
+		return status
+	}
+}
+
+func formatCreationTimestamp(in *compute.Instance) string {
+	if in.CreationTimestamp == "" {
+		return ""
+	}
+	t, err := time.Parse(time.RFC3339, in.CreationTimestamp)
+	if err != nil {
+		log.Printf("invalid creation timestamp %q in host instance %q: %v", in.CreationTimestamp, in.SelfLink, err)
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func instanceIPAddresses(in *compute.Instance) []string {
+	var addrs []string
+	for _, ni := range in.NetworkInterfaces {
+		if ni.NetworkIP != "" {
+			addrs = append(addrs, ni.NetworkIP)
+		}
+		for _, ac := range ni.AccessConfigs {
+			if ac.NatIP != "" {
+				addrs = append(addrs, ac.NatIP)
+			}
+		}
+	}
+	return addrs
+}
+
+// Labels set by the orchestrator are left out.
+func instanceUserLabels(in *compute.Instance) map[string]string {
+	var labels map[string]string
+	for k, v := range in.Labels {
+		if isReservedLabelKey(k) {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[k] = v
+	}
+	return labels
+}
+
+// Returns the zero time if the instance never expires.
+func instanceExpireTime(in *compute.Instance) time.Time {
+	v, ok := in.Labels[labelExpireTime]
+	if !ok {
+		return time.Time{}
+	}
+	t, err := parseExpireTimeLabel(v)
+	if err != nil {
+		log.Printf("invalid expire time label %q in host instance %q: %v", v, in.SelfLink, err)
+		return time.Time{}
+	}
+	return t
+}
+
 const hostInstanceNamePrefix = "cf-"
 
 type NameGenerator interface {
@@ -331,19 +1043,25 @@ func (g *opResultGetter) Get() (any, error) {
 			Err:        fmt.Errorf("gcp operation failed: %+v", g.Op),
 		}
 	}
-	if g.Op.OperationType == "delete" && instanceTargetLinkRe.MatchString(g.Op.TargetLink) {
-		return struct{}{}, nil
+	if !instanceTargetLinkRe.MatchString(g.Op.TargetLink) {
+		return nil, errors.NewNotFoundError("operation result not found", nil)
 	}
-	if g.Op.OperationType == "insert" && instanceTargetLinkRe.MatchString(g.Op.TargetLink) {
-		return g.buildCreateInstanceResult()
+	switch g.Op.OperationType {
+	case "delete":
+		return struct{}{}, nil
+	case "insert", "stop", "start", "suspend", "resume":
+		return g.buildInstanceResult()
+	case "setLabels":
+		// Hosts taken from a warm pool are handed to the user by setting their labels.
+		return g.buildInstanceResult()
 	}
 	return nil, errors.NewNotFoundError("operation result not found", nil)
 }
 
-func (g *opResultGetter) buildCreateInstanceResult() (*apiv1.HostInstance, error) {
+func (g *opResultGetter) buildInstanceResult() (*apiv1.HostInstance, error) {
 	matches := instanceTargetLinkRe.FindStringSubmatch(g.Op.TargetLink)
 	if len(matches) != 4 {
-		err := fmt.Errorf("invalid target link for instance insert operation: %q", g.Op.TargetLink)
+		err := fmt.Errorf("invalid target link for instance operation: %q", g.Op.TargetLink)
 		return nil, err
 	}
 	ins, err := g.Service.Instances.
@@ -26,9 +26,13 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
+	"github.com/google/cloud-android-orchestration/pkg/app/acl"
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
 	apperr "github.com/google/cloud-android-orchestration/pkg/app/errors"
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/sergi/go-diff/diffmatchpatch"
@@ -59,7 +63,7 @@ func TestCreateHostInvalidRequests(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 	var validRequest = func() *apiv1.CreateHostRequest {
 		return &apiv1.CreateHostRequest{
 			HostInstance: &apiv1.HostInstance{
@@ -83,6 +87,8 @@ func TestCreateHostInvalidRequests(t *testing.T) {
 		{func(r *apiv1.CreateHostRequest) { r.HostInstance.BootDiskSizeGB = 1 }},
 		{func(r *apiv1.CreateHostRequest) { r.HostInstance.GCP = nil }},
 		{func(r *apiv1.CreateHostRequest) { r.HostInstance.GCP.MachineType = "" }},
+		{func(r *apiv1.CreateHostRequest) { r.HostInstance.ExpireTime = "2024-01-01T00:00:00Z" }},
+		{func(r *apiv1.CreateHostRequest) { r.TTLSeconds = -1 }},
 	}
 
 	for _, test := range tests {
@@ -104,7 +110,7 @@ func TestCreateHostRequestPath(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 
 	im.CreateHost("us-central1-a",
 		&apiv1.CreateHostRequest{
@@ -132,7 +138,7 @@ func TestCreateHostRequestBody(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 
 	im.CreateHost("us-central1-a",
 		&apiv1.CreateHostRequest{
@@ -190,17 +196,14 @@ func TestCreateHostAcloudCompatible(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := GCEInstanceManager{
-		Config: Config{
-			GCP: &GCPIMConfig{
-				ProjectID:        "google.com:test-project",
-				HostImageFamily:  "projects/test-project-releases/global/images/family/foo",
-				AcloudCompatible: true,
-			},
+	cfg := Config{
+		GCP: &GCPIMConfig{
+			ProjectID:        "google.com:test-project",
+			HostImageFamily:  "projects/test-project-releases/global/images/family/foo",
+			AcloudCompatible: true,
 		},
-		Service:               testService,
-		InstanceNameGenerator: testNameGenerator,
 	}
+	im := NewGCEInstanceManager(cfg, testService, testNameGenerator, database.NewInMemoryDBService())
 
 	_, err := im.CreateHost("us-central1-a",
 		&apiv1.CreateHostRequest{
@@ -227,6 +230,40 @@ func TestCreateHostAcloudCompatible(t *testing.T) {
 	}
 }
 
+func TestCreateHostWithTTL(t *testing.T) {
+	var postedInstance compute.Instance
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &postedInstance)
+		replyJSON(w, &compute.Operation{Name: "operation-1"})
+	}))
+	defer ts.Close()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
+	before := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	_, err := im.CreateHost("us-central1-a",
+		&apiv1.CreateHostRequest{
+			HostInstance: &apiv1.HostInstance{
+				GCP: &apiv1.GCPInstance{
+					MachineType: "n1-standard-1",
+				},
+			},
+			TTLSeconds: 3600,
+		},
+		&TestUser{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expireTime, err := parseExpireTimeLabel(postedInstance.Labels[labelExpireTime])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expireTime.Before(before) || expireTime.After(time.Now().Add(time.Hour)) {
+		t.Errorf("unexpected expire time %s", expireTime)
+	}
+}
+
 func TestCreateHostSuccess(t *testing.T) {
 	expectedName := "operation-1"
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -238,7 +275,7 @@ func TestCreateHostSuccess(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 
 	op, _ := im.CreateHost("us-central1-a",
 		&apiv1.CreateHostRequest{
@@ -267,7 +304,7 @@ func TestGetHostAddrRequestPath(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 
 	im.GetHostAddr("us-central1-a", "foo")
 
@@ -283,7 +320,7 @@ func TestGetHostAddrMissingNetworkInterface(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 
 	_, err := im.GetHostAddr("us-central1-a", "foo")
 
@@ -307,7 +344,7 @@ func TestGetHostAddrSuccess(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 
 	addr, _ := im.GetHostAddr("us-central1-a", "foo")
 
@@ -324,7 +361,7 @@ func TestListHostsRequestQuery(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 	req := &ListHostsRequest{
 		MaxResults: 100,
 		PageToken:  "foo",
@@ -333,7 +370,7 @@ func TestListHostsRequestQuery(t *testing.T) {
 	im.ListHosts("us-central1-a", &TestUser{}, req)
 
 	m, _ := url.ParseQuery(usedQuery)
-	got, expected := m["filter"][0], "labels.cf-created_by:johndoe AND status=RUNNING"
+	got, expected := m["filter"][0], "labels.cf-created_by:johndoe"
 	if got != expected {
 		t.Errorf("expected <<%q>>, got %q", expected, got)
 	}
@@ -351,7 +388,7 @@ func TestListHostsOverMaxResultsLimit(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 	req := &ListHostsRequest{
 		MaxResults: 501,
 		PageToken:  "foo",
@@ -390,7 +427,7 @@ func TestListHostsSucceeds(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 
 	resp, err := im.ListHosts("us-central1-a", &TestUser{}, &ListHostsRequest{})
 
@@ -409,6 +446,60 @@ func TestListHostsSucceeds(t *testing.T) {
 	}
 }
 
+func TestListAllHostsUsesAggregatedList(t *testing.T) {
+	var usedPath, usedQuery string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		usedPath = r.URL.Path
+		usedQuery = r.URL.Query().Encode()
+		list := &compute.InstanceAggregatedList{
+			Items: map[string]compute.InstancesScopedList{
+				"zones/us-west1-b": {Instances: []*compute.Instance{{
+					Disks: []*compute.AttachedDisk{{DiskSizeGb: 20}},
+					Name:  "bar",
+					Zone:  "https://www.googleapis.com/compute/v1/projects/google.com:test-project/zones/us-west1-b",
+				}}},
+				"zones/us-central1-a": {Instances: []*compute.Instance{{
+					Disks: []*compute.AttachedDisk{{DiskSizeGb: 10}},
+					Name:  "foo",
+					Zone:  "https://www.googleapis.com/compute/v1/projects/google.com:test-project/zones/us-central1-a",
+				}}},
+				"regions/us-central1": {},
+			},
+			NextPageToken: "test-token",
+		}
+		replyJSON(w, list)
+	}))
+	defer ts.Close()
+	testService := buildTestService(t, ts)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
+
+	resp, err := im.ListAllHosts(&ListHostsRequest{MaxResults: 501})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("/projects/google.com:test-project/aggregated/instances", usedPath); diff != "" {
+		t.Errorf("path mismatch (-want +got):\n%s", diff)
+	}
+	m, _ := url.ParseQuery(usedQuery)
+	if diff := cmp.Diff("labels.cf-created_by:*", m.Get("filter")); diff != "" {
+		t.Errorf("filter mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("500", m.Get("maxResults")); diff != "" {
+		t.Errorf("max results mismatch (-want +got):\n%s", diff)
+	}
+	var got []string
+	for _, h := range resp.Items {
+		got = append(got, h.Zone+"/"+h.Name)
+	}
+	if diff := cmp.Diff([]string{"us-central1-a/foo", "us-west1-b/bar"}, got); diff != "" {
+		t.Errorf("hosts mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("test-token", resp.NextPageToken); diff != "" {
+		t.Errorf("next page token mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestDeleteHostVerifyUserOwnsTheHost(t *testing.T) {
 	var usedListQuery string
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -417,7 +508,7 @@ func TestDeleteHostVerifyUserOwnsTheHost(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 
 	im.DeleteHost("us-central1-a", &TestUser{}, "foo")
 
@@ -433,7 +524,7 @@ func TestDeleteHostHostDoesNotExist(t *testing.T) {
 	}))
 	defer ts.Close()
 	testService := buildTestService(t, ts)
-	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, testService, testNameGenerator, database.NewInMemoryDBService())
 
 	_, err := im.DeleteHost("us-central1-a", &TestUser{}, "foo")
 
@@ -458,12 +549,14 @@ func TestDeleteHostSucceeds(t *testing.T) {
 			replyJSON(w, operation)
 		} else if r.URL.Path == "/projects/google.com:test-project/zones/us-central1-a/instances" {
 			replyJSON(w, &compute.InstanceList{Items: []*compute.Instance{{}}})
+		} else if r.URL.Path == "/projects/google.com:test-project/zones/us-central1-a/operations/operation-1/wait" {
+			replyJSON(w, &compute.Operation{Name: opName, Status: "DONE"})
 		} else {
 			t.Fatalf("unexpected path: %q", r.URL.Path)
 		}
 	}))
 	defer ts.Close()
-	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
 
 	op, _ := im.DeleteHost(zone, &TestUser{}, "foo")
 
@@ -472,6 +565,51 @@ func TestDeleteHostSucceeds(t *testing.T) {
 	}
 }
 
+func TestForgetHostWhenDeleted(t *testing.T) {
+	tests := []struct {
+		name    string
+		opError *compute.OperationError
+		want    bool
+	}{
+		{name: "deleted", want: false},
+		{name: "failed", opError: &compute.OperationError{}, want: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch path := r.URL.Path; path {
+				case "/projects/google.com:test-project/zones/us-central1-a/operations/op-1/wait":
+					replyJSON(w, &compute.Operation{Name: "op-1", Status: "DONE", Error: tc.opError})
+				default:
+					t.Fatalf("unexpected path: %q", path)
+				}
+			}))
+			defer ts.Close()
+			dbs := database.NewInMemoryDBService()
+			hostACL := acl.HostACL{
+				Zone:    "us-central1-a",
+				Host:    "foo",
+				Owner:   fakeUsername,
+				Entries: []acl.Entry{{Principal: "user:janedoe", Role: acl.EditorRole}},
+			}
+			if err := dbs.StoreHostACL(hostACL); err != nil {
+				t.Fatal(err)
+			}
+			im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, dbs)
+
+			im.forgetHostWhenDeleted("us-central1-a", "foo", "op-1")
+
+			got, err := dbs.FetchHostACL("us-central1-a", "foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got != nil); diff != "" {
+				t.Errorf("acl kept mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestWaitOperationAndOperationIsNotDone(t *testing.T) {
 	zone := "us-central1-a"
 	opName := "operation-1"
@@ -488,7 +626,7 @@ func TestWaitOperationAndOperationIsNotDone(t *testing.T) {
 		}
 	}))
 	defer ts.Close()
-	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
 
 	_, err := im.WaitOperation(zone, &TestUser{}, opName)
 
@@ -525,7 +663,7 @@ func TestWaitCreateInstanceOperationSucceeds(t *testing.T) {
 		}
 	}))
 	defer ts.Close()
-	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
 
 	res, _ := im.WaitOperation(zone, &TestUser{}, opName)
 
@@ -548,7 +686,7 @@ func TestWaitDeleteInstanceOperationSucceeds(t *testing.T) {
 		replyJSON(w, operation)
 	}))
 	defer ts.Close()
-	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
 
 	res, _ := im.WaitOperation(zone, &TestUser{}, opName)
 
@@ -583,7 +721,7 @@ func TestWaitOperationInvalidDoneOperations(t *testing.T) {
 		t.Fatalf("unexpected path: %q", r.URL.Path)
 	}))
 	defer ts.Close()
-	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
 
 	for name := range operations {
 
@@ -611,7 +749,7 @@ func TestWaitOperationFailedOperation(t *testing.T) {
 		replyJSON(w, operation)
 	}))
 	defer ts.Close()
-	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator)
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
 
 	_, err := im.WaitOperation(zone, &TestUser{}, opName)
 
@@ -624,6 +762,405 @@ func TestWaitOperationFailedOperation(t *testing.T) {
 	}
 }
 
+func TestListOperationsOnlyReturnsUserOperations(t *testing.T) {
+	targetLinkPrefix := "https://xyzzy.com/compute/v1/projects/google.com:test-project/zones/us-central1-a/instances/"
+	var usedOpsQuery url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; path {
+		case "/projects/google.com:test-project/zones/us-central1-a/operations":
+			usedOpsQuery = r.URL.Query()
+			replyJSON(w, &compute.OperationList{
+				Items: []*compute.Operation{
+					{Name: "op-1", OperationType: "insert", Status: "RUNNING", TargetLink: targetLinkPrefix + "foo"},
+					{Name: "op-2", OperationType: "insert", Status: "RUNNING", TargetLink: targetLinkPrefix + "bar"},
+				},
+			})
+		default:
+			t.Fatalf("unexpected path: %q", path)
+		}
+	}))
+	defer ts.Close()
+	dbs := database.NewInMemoryDBService()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, dbs)
+	ops := []operation.Operation{
+		{Name: "op-1", Type: "createhost", Username: fakeUsername, Host: "foo", State: operation.PendingState},
+		{Name: "op-2", Type: "createhost", Username: "janedoe", Host: "bar", State: operation.PendingState},
+	}
+	for _, op := range ops {
+		if err := dbs.CreateOrUpdateOperation(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := &ListOperationsRequest{Type: "createhost", State: "RUNNING"}
+
+	res, err := im.ListOperations("us-central1-a", &TestUser{}, req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("operationType=insert AND status=RUNNING", usedOpsQuery.Get("filter")); diff != "" {
+		t.Errorf("filter mismatch (-want +got):\n%s", diff)
+	}
+	want := &apiv1.ListOperationsResponse{
+		Items: []*apiv1.Operation{{
+			Name: "op-1",
+			Metadata: &apiv1.OperationMetadata{
+				Type:  "createhost",
+				User:  fakeUsername,
+				Host:  "foo",
+				State: "RUNNING",
+			},
+		}},
+	}
+	if diff := cmp.Diff(want, res); diff != "" {
+		t.Errorf("response mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestListOperationsOfDeletedHosts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; path {
+		case "/projects/google.com:test-project/zones/us-central1-a/instances":
+			replyJSON(w, &compute.InstanceList{Items: []*compute.Instance{{Name: "foo"}}})
+		case "/projects/google.com:test-project/zones/us-central1-a/instances/foo":
+			replyJSON(w, &compute.Operation{Name: "op-1", Status: "RUNNING"})
+		case "/projects/google.com:test-project/zones/us-central1-a/operations/op-1/wait":
+			replyJSON(w, &compute.Operation{Name: "op-1", Status: "DONE"})
+		case "/projects/google.com:test-project/zones/us-central1-a/operations":
+			replyJSON(w, &compute.OperationList{
+				Items: []*compute.Operation{{
+					Name:          "op-1",
+					OperationType: "delete",
+					Status:        "DONE",
+					TargetLink:    "https://xyzzy.com/compute/v1/projects/google.com:test-project/zones/us-central1-a/instances/foo",
+				}},
+			})
+		default:
+			t.Fatalf("unexpected path: %q", path)
+		}
+	}))
+	defer ts.Close()
+	dbs := database.NewInMemoryDBService()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, dbs)
+	if _, err := im.DeleteHost("us-central1-a", &TestUser{}, "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := im.ListOperations("us-central1-a", &TestUser{}, &ListOperationsRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, op := range res.Items {
+		names = append(names, op.Name)
+	}
+	if diff := cmp.Diff([]string{"op-1"}, names); diff != "" {
+		t.Errorf("operations mismatch (-want +got):\n%s", diff)
+	}
+	stored, err := dbs.FetchOperation("op-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(operation.DoneState, stored.State); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCancelOperationDeletesInstance(t *testing.T) {
+	op := &compute.Operation{
+		Name:          "op-1",
+		OperationType: "insert",
+		Status:        "RUNNING",
+		TargetLink:    "https://xyzzy.com/compute/v1/projects/google.com:test-project/zones/us-central1-a/instances/foo",
+	}
+	deleted := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; path {
+		case "/projects/google.com:test-project/zones/us-central1-a/operations/op-1":
+			replyJSON(w, op)
+		case "/projects/google.com:test-project/zones/us-central1-a/instances":
+			replyJSON(w, &compute.InstanceList{Items: []*compute.Instance{{Name: "foo"}}})
+		case "/projects/google.com:test-project/zones/us-central1-a/instances/foo":
+			deleted = r.Method == "DELETE"
+			replyJSON(w, &compute.Operation{Name: "op-2"})
+		default:
+			t.Fatalf("unexpected path: %q", path)
+		}
+	}))
+	defer ts.Close()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
+
+	res, err := im.CancelOperation("us-central1-a", &TestUser{}, "op-1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deleted {
+		t.Errorf("expected instance to be deleted")
+	}
+	if diff := cmp.Diff("op-1", res.Name); diff != "" {
+		t.Errorf("name mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCancelOperationOtherUserHost(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; path {
+		case "/projects/google.com:test-project/zones/us-central1-a/operations/op-1":
+			replyJSON(w, &compute.Operation{
+				Name:          "op-1",
+				OperationType: "insert",
+				Status:        "RUNNING",
+				TargetLink:    "https://xyzzy.com/compute/v1/projects/google.com:test-project/zones/us-central1-a/instances/bar",
+			})
+		case "/projects/google.com:test-project/zones/us-central1-a/instances":
+			replyJSON(w, &compute.InstanceList{})
+		default:
+			t.Fatalf("unexpected path: %q", path)
+		}
+	}))
+	defer ts.Close()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
+
+	_, err := im.CancelOperation("us-central1-a", &TestUser{}, "op-1")
+
+	appErr, ok := err.(*apperr.AppError)
+	if !ok || appErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func TestExtendHostSetsExpireTimeLabel(t *testing.T) {
+	var setLabelsReq compute.InstancesSetLabelsRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; path {
+		case "/projects/google.com:test-project/zones/us-central1-a/instances/foo":
+			replyJSON(w, &compute.Instance{
+				Name:             "foo",
+				Disks:            []*compute.AttachedDisk{{DiskSizeGb: 10}},
+				Labels:           map[string]string{labelCreatedBy: fakeUsername},
+				LabelFingerprint: "fingerprint",
+			})
+		case "/projects/google.com:test-project/zones/us-central1-a/instances/foo/setLabels":
+			body, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(body, &setLabelsReq)
+			replyJSON(w, &compute.Operation{Name: "operation-1"})
+		default:
+			t.Fatalf("unexpected path: %q", path)
+		}
+	}))
+	defer ts.Close()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
+
+	res, err := im.ExtendHost("us-central1-a", &TestUser{}, "foo", &apiv1.ExtendHostRequest{TTLSeconds: 3600})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("fingerprint", setLabelsReq.LabelFingerprint); diff != "" {
+		t.Errorf("label fingerprint mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(fakeUsername, setLabelsReq.Labels[labelCreatedBy]); diff != "" {
+		t.Errorf("created by label mismatch (-want +got):\n%s", diff)
+	}
+	if res.ExpireTime == "" {
+		t.Errorf("expected expire time to be set")
+	}
+}
+
+func TestExtendHostOtherUserHost(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replyJSON(w, &compute.Instance{
+			Name:   "foo",
+			Labels: map[string]string{labelCreatedBy: "janedoe"},
+		})
+	}))
+	defer ts.Close()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
+
+	_, err := im.ExtendHost("us-central1-a", &TestUser{}, "foo", &apiv1.ExtendHostRequest{TTLSeconds: 3600})
+
+	appErr, ok := err.(*apperr.AppError)
+	if !ok || appErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func TestGetHostSucceeds(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path := r.URL.Path; path != "/projects/google.com:test-project/zones/us-central1-a/instances/foo" {
+			t.Fatalf("unexpected path: %q", path)
+		}
+		replyJSON(w, &compute.Instance{
+			Name:              "foo",
+			Disks:             []*compute.AttachedDisk{{DiskSizeGb: 10}},
+			MachineType:       "zones/us-central1-a/machineTypes/n1-standard-4",
+			Status:            "STAGING",
+			CreationTimestamp: "2024-01-01T10:00:00.000-07:00",
+			NetworkInterfaces: []*compute.NetworkInterface{
+				{
+					NetworkIP:     "10.128.0.2",
+					AccessConfigs: []*compute.AccessConfig{{NatIP: "34.1.2.3"}},
+				},
+			},
+			Labels: map[string]string{labelCreatedBy: fakeUsername, labelAcloudCreatedBy: fakeUsername, "team": "camera"},
+		})
+	}))
+	defer ts.Close()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
+
+	res, err := im.GetHost("us-central1-a", &TestUser{}, "foo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &apiv1.HostInstance{
+		Name:           "foo",
+		BootDiskSizeGB: 10,
+		GCP:            &apiv1.GCPInstance{MachineType: "n1-standard-4"},
+		Status:         HostStatusProvisioning,
+		CreateTime:     "2024-01-01T10:00:00-07:00",
+		IPAddresses:    []string{"10.128.0.2", "34.1.2.3"},
+		Labels:         map[string]string{"team": "camera"},
+		Owner:          fakeUsername,
+	}
+	if diff := cmp.Diff(want, res); diff != "" {
+		t.Errorf("host instance mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetHostOtherUserHost(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replyJSON(w, &compute.Instance{
+			Name:   "foo",
+			Labels: map[string]string{labelCreatedBy: "janedoe"},
+		})
+	}))
+	defer ts.Close()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
+
+	_, err := im.GetHost("us-central1-a", &TestUser{}, "foo")
+
+	appErr, ok := err.(*apperr.AppError)
+	if !ok || appErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func TestStartHost(t *testing.T) {
+	tests := []struct {
+		status string
+		path   string
+	}{
+		{status: "TERMINATED", path: "/projects/google.com:test-project/zones/us-central1-a/instances/foo/start"},
+		{status: "SUSPENDED", path: "/projects/google.com:test-project/zones/us-central1-a/instances/foo/resume"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.status, func(t *testing.T) {
+			var usedPath string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "GET" {
+					replyJSON(w, &compute.Instance{
+						Name:   "foo",
+						Status: tc.status,
+						Labels: map[string]string{labelCreatedBy: fakeUsername},
+					})
+					return
+				}
+				usedPath = r.URL.Path
+				replyJSON(w, &compute.Operation{Name: "operation-1"})
+			}))
+			defer ts.Close()
+			im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
+
+			op, err := im.StartHost("us-central1-a", &TestUser{}, "foo")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.path, usedPath); diff != "" {
+				t.Errorf("request path mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff("operation-1", op.Name); diff != "" {
+				t.Errorf("operation name mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStopHostOtherUserHost(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		replyJSON(w, &compute.Instance{
+			Name:   "foo",
+			Labels: map[string]string{labelCreatedBy: "janedoe"},
+		})
+	}))
+	defer ts.Close()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
+
+	_, err := im.StopHost("us-central1-a", &TestUser{}, "foo")
+
+	appErr, ok := err.(*apperr.AppError)
+	if !ok || appErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func TestDeleteExpiredHosts(t *testing.T) {
+	past := expireTimeLabelValue(time.Now().Add(-time.Minute))
+	future := expireTimeLabelValue(time.Now().Add(time.Hour))
+	var deleted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/projects/google.com:test-project/aggregated/instances":
+			replyJSON(w, &compute.InstanceAggregatedList{
+				Items: map[string]compute.InstancesScopedList{
+					"zones/us-central1-a": {
+						Instances: []*compute.Instance{
+							{
+								Name:   "foo",
+								Zone:   "https://xyzzy.com/compute/v1/projects/google.com:test-project/zones/us-central1-a",
+								Labels: map[string]string{labelCreatedBy: fakeUsername, labelExpireTime: past},
+							},
+							{
+								Name:   "bar",
+								Zone:   "https://xyzzy.com/compute/v1/projects/google.com:test-project/zones/us-central1-a",
+								Labels: map[string]string{labelCreatedBy: fakeUsername, labelExpireTime: future},
+							},
+						},
+					},
+				},
+			})
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+			replyJSON(w, &compute.Operation{Name: "operation-1"})
+		case r.URL.Path == "/projects/google.com:test-project/zones/us-central1-a/operations/operation-1/wait":
+			replyJSON(w, &compute.Operation{Name: "operation-1", Status: "DONE"})
+		default:
+			t.Fatalf("unexpected path: %q", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	im := NewGCEInstanceManager(testConfig, buildTestService(t, ts), testNameGenerator, database.NewInMemoryDBService())
+
+	res, err := im.DeleteExpiredHosts()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/projects/google.com:test-project/zones/us-central1-a/instances/foo"}
+	if diff := cmp.Diff(want, deleted); diff != "" {
+		t.Errorf("deleted instances mismatch (-want +got):\n%s", diff)
+	}
+	if len(res) != 1 || res[0].Name != "foo" || res[0].Owner != fakeUsername {
+		t.Errorf("unexpected expired hosts: %+v", res)
+	}
+}
+
 func TestBuildHostInstance(t *testing.T) {
 	input := &compute.Instance{
 		Disks:          []*compute.AttachedDisk{{DiskSizeGb: 10}},
@@ -0,0 +1,323 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
+	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
+	"github.com/google/cloud-android-orchestration/pkg/app/hostmeta"
+
+	hoapi "github.com/google/android-cuttlefish/frontend/src/liboperator/api/v1"
+)
+
+type IdleAction string
+
+const (
+	StopIdleAction   IdleAction = "stop"
+	DeleteIdleAction IdleAction = "delete"
+)
+
+type IdlePolicy struct {
+	// Hosts without running CVDs nor proxied traffic for this many minutes are reclaimed. Idle hosts
+	// are never reclaimed if zero.
+	TimeoutMinutes int
+	// What to do with idle hosts, either `stop` or `delete`.
+	Action IdleAction
+}
+
+func (p *IdlePolicy) Enabled() bool {
+	return p.TimeoutMinutes > 0
+}
+
+func (p *IdlePolicy) timeout() time.Duration {
+	return time.Duration(p.TimeoutMinutes) * time.Minute
+}
+
+type runningHost struct {
+	Zone  string
+	Name  string
+	Owner string
+}
+
+// Implemented by the instance managers able to reclaim idle hosts.
+type runningHostsLister interface {
+	// Lists the running hosts of every user.
+	listRunningHosts() ([]*runningHost, error)
+}
+
+// Decorates an instance manager reclaiming the hosts that have been idle for longer than the
+// policy allows. A host is considered active while it has running CVDs or while requests are
+// proxied to it, which go through `GetHostClient`. Idle hosts are stopped or deleted with the same
+// operations users start, so they are tracked and cleaned up the same way.
+//
+// Activity is stored through the database service, so idle periods survive restarts and are shared
+// by every orchestrator replica. Requests are proxied often, the activity of each host is stored at
+// most once per `activityStoreInterval`.
+type IdleHostMonitor struct {
+	Manager
+	policy IdlePolicy
+	lister runningHostsLister
+	dbs    database.Service
+	now    func() time.Time
+	mtx    sync.Mutex
+	// Last time activity was detected in each host, keyed by zone and host name.
+	lastActive map[string]hostmeta.Activity
+	// Last time the activity of each host was stored, keyed by zone and host name.
+	storedAt map[string]time.Time
+}
+
+const activityStoreInterval = time.Minute
+
+func NewIdleHostMonitor(m Manager, policy IdlePolicy, dbs database.Service) (*IdleHostMonitor, error) {
+	if policy.Action != StopIdleAction && policy.Action != DeleteIdleAction {
+		return nil, fmt.Errorf("invalid idle host action: %q", policy.Action)
+	}
+	lister, ok := asBackend[runningHostsLister](m)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't support reclaiming idle hosts", m)
+	}
+	return &IdleHostMonitor{
+		Manager:    m,
+		policy:     policy,
+		lister:     lister,
+		dbs:        dbs,
+		now:        time.Now,
+		lastActive: make(map[string]hostmeta.Activity),
+		storedAt:   make(map[string]time.Time),
+	}, nil
+}
+
+func (m *IdleHostMonitor) unwrap() Manager {
+	return m.Manager
+}
+
+// Only running hosts are reclaimed, the policy isn't reported for the others.
+func (m *IdleHostMonitor) ListHosts(zone string, user accounts.User, req *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
+	res, err := m.Manager.ListHosts(zone, user, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Items) > 0 {
+		m.loadActivity()
+	}
+	for _, h := range res.Items {
+		if h.Status == HostStatusRunning {
+			h.IdlePolicy = m.hostIdlePolicy(zone, h.Name)
+		}
+	}
+	return res, nil
+}
+
+func (m *IdleHostMonitor) GetHost(zone string, user accounts.User, host string) (*apiv1.HostInstance, error) {
+	res, err := m.Manager.GetHost(zone, user, host)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status == HostStatusRunning {
+		m.loadHostActivity(zone, res.Name)
+		res.IdlePolicy = m.hostIdlePolicy(zone, res.Name)
+	}
+	return res, nil
+}
+
+func (m *IdleHostMonitor) GetHostClient(zone string, host string) (HostClient, error) {
+	m.recordActivity(zone, host)
+	return m.Manager.GetHostClient(zone, host)
+}
+
+// Checks the running hosts periodically until the context is cancelled.
+func (m *IdleHostMonitor) Run(ctx context.Context) {
+	interval := m.policy.timeout() / 4
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.CheckOnce()
+		}
+	}
+}
+
+// Reclaims the hosts that have been idle for too long and returns them.
+func (m *IdleHostMonitor) CheckOnce() []*runningHost {
+	hosts, err := m.lister.listRunningHosts()
+	if err != nil {
+		log.Printf("failed to list running hosts: %v", err)
+		return nil
+	}
+	m.loadActivity()
+	var reclaimed []*runningHost
+	running := make(map[string]bool)
+	for _, h := range hosts {
+		key := idleHostKey(h.Zone, h.Name)
+		running[key] = true
+		if m.hasRunningCVDs(h) {
+			m.recordActivity(h.Zone, h.Name)
+			continue
+		}
+		if m.now().Sub(m.lastActivity(h.Zone, h.Name)) < m.policy.timeout() {
+			continue
+		}
+		if err := m.reclaim(h); err != nil {
+			log.Printf("failed to %s idle host %q in zone %q: %v", m.policy.Action, h.Name, h.Zone, err)
+			continue
+		}
+		log.Printf("idle host %q in zone %q owned by %q: %s action executed", h.Name, h.Zone, h.Owner, m.policy.Action)
+		delete(running, key)
+		reclaimed = append(reclaimed, h)
+	}
+	// Forget the hosts that are no longer running.
+	var forgotten []hostmeta.Activity
+	m.mtx.Lock()
+	for key, a := range m.lastActive {
+		if !running[key] {
+			delete(m.lastActive, key)
+			delete(m.storedAt, key)
+			forgotten = append(forgotten, a)
+		}
+	}
+	m.mtx.Unlock()
+	for _, a := range forgotten {
+		if err := m.dbs.DeleteHostActivity(a.Zone, a.Host); err != nil {
+			log.Printf("failed to delete activity of host %q in zone %q: %v", a.Host, a.Zone, err)
+		}
+	}
+	return reclaimed
+}
+
+func (m *IdleHostMonitor) reclaim(h *runningHost) error {
+	var err error
+	switch m.policy.Action {
+	case StopIdleAction:
+		_, err = m.Manager.StopHost(h.Zone, hostOwner(h.Owner), h.Name)
+	case DeleteIdleAction:
+		_, err = m.Manager.DeleteHost(h.Zone, hostOwner(h.Owner), h.Name)
+	default:
+		err = fmt.Errorf("unknown idle host action: %q", m.policy.Action)
+	}
+	return err
+}
+
+// Hosts that can't be reached are considered active, they may still be booting.
+func (m *IdleHostMonitor) hasRunningCVDs(h *runningHost) bool {
+	hc, err := m.Manager.GetHostClient(h.Zone, h.Name)
+	if err != nil {
+		log.Printf("failed to get client for host %q in zone %q: %v", h.Name, h.Zone, err)
+		return true
+	}
+	res := &hoapi.ListCVDsResponse{}
+	status, err := hc.Get("/cvds", "", &HostResponse{Result: res})
+	if err != nil || status != http.StatusOK {
+		log.Printf("failed to list cvds of host %q in zone %q: status %d, %v", h.Name, h.Zone, status, err)
+		return true
+	}
+	for _, cvd := range res.CVDs {
+		if strings.EqualFold(cvd.Status, "running") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the time the activity was recorded at.
+func (m *IdleHostMonitor) recordActivity(zone, host string) time.Time {
+	key := idleHostKey(zone, host)
+	a := hostmeta.Activity{Zone: zone, Host: host, LastActive: m.now()}
+	m.mtx.Lock()
+	m.lastActive[key] = a
+	store := a.LastActive.Sub(m.storedAt[key]) >= activityStoreInterval
+	if store {
+		m.storedAt[key] = a.LastActive
+	}
+	m.mtx.Unlock()
+	if store {
+		if err := m.dbs.RecordHostActivity(a); err != nil {
+			log.Printf("failed to store activity of host %q in zone %q: %v", host, zone, err)
+		}
+	}
+	return a.LastActive
+}
+
+// Merges the activity stored by every orchestrator replica into the activity known to this one.
+func (m *IdleHostMonitor) loadActivity() {
+	stored, err := m.dbs.ListHostActivity()
+	if err != nil {
+		log.Printf("failed to list host activity: %v", err)
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, a := range stored {
+		m.mergeActivityLocked(a)
+	}
+}
+
+// Like loadActivity, but only for the given host.
+func (m *IdleHostMonitor) loadHostActivity(zone, host string) {
+	a, err := m.dbs.FetchHostActivity(zone, host)
+	if err != nil {
+		log.Printf("failed to fetch activity of host %q in zone %q: %v", host, zone, err)
+		return
+	}
+	if a == nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.mergeActivityLocked(a)
+}
+
+func (m *IdleHostMonitor) mergeActivityLocked(a *hostmeta.Activity) {
+	key := idleHostKey(a.Zone, a.Host)
+	if known, ok := m.lastActive[key]; !ok || a.LastActive.After(known.LastActive) {
+		m.lastActive[key] = *a
+	}
+}
+
+// Hosts seen for the first time are considered active at that moment.
+func (m *IdleHostMonitor) lastActivity(zone, host string) time.Time {
+	m.mtx.Lock()
+	a, ok := m.lastActive[idleHostKey(zone, host)]
+	m.mtx.Unlock()
+	if ok {
+		return a.LastActive
+	}
+	return m.recordActivity(zone, host)
+}
+
+func (m *IdleHostMonitor) hostIdlePolicy(zone, host string) *apiv1.IdlePolicy {
+	return &apiv1.IdlePolicy{
+		Action:      string(m.policy.Action),
+		ReclaimTime: m.lastActivity(zone, host).Add(m.policy.timeout()).Format(time.RFC3339),
+	}
+}
+
+func idleHostKey(zone, host string) string {
+	return zone + "/" + host
+}
@@ -0,0 +1,205 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"testing"
+	"time"
+
+	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
+	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
+	"github.com/google/cloud-android-orchestration/pkg/app/hostmeta"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeCVDsHostClient struct {
+	cvds string
+}
+
+func (c *fakeCVDsHostClient) Get(URLPath, URLQuery string, res *HostResponse) (int, error) {
+	return http.StatusOK, json.Unmarshal([]byte(c.cvds), res.Result)
+}
+
+func (c *fakeCVDsHostClient) Post(URLPath, URLQuery string, bodyJSON any, res *HostResponse) (int, error) {
+	return http.StatusOK, nil
+}
+
+func (c *fakeCVDsHostClient) GetReverseProxy() *httputil.ReverseProxy {
+	return nil
+}
+
+type fakeIdleHostsManager struct {
+	Manager
+	hosts     []*runningHost
+	cvds      map[string]string
+	reclaimed []string
+}
+
+func (m *fakeIdleHostsManager) ListHosts(zone string, _ accounts.User, _ *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
+	res := &apiv1.ListHostsResponse{}
+	for _, h := range m.hosts {
+		res.Items = append(res.Items, &apiv1.HostInstance{Name: h.Name, Status: HostStatusRunning})
+	}
+	return res, nil
+}
+
+func (m *fakeIdleHostsManager) GetHost(zone string, _ accounts.User, host string) (*apiv1.HostInstance, error) {
+	return &apiv1.HostInstance{Name: host, Status: HostStatusRunning}, nil
+}
+
+func (m *fakeIdleHostsManager) GetHostClient(zone string, host string) (HostClient, error) {
+	return &fakeCVDsHostClient{cvds: m.cvds[host]}, nil
+}
+
+func (m *fakeIdleHostsManager) listRunningHosts() ([]*runningHost, error) {
+	return m.hosts, nil
+}
+
+func (m *fakeIdleHostsManager) StopHost(zone string, _ accounts.User, host string) (*apiv1.Operation, error) {
+	m.reclaimed = append(m.reclaimed, host)
+	return &apiv1.Operation{}, nil
+}
+
+func (m *fakeIdleHostsManager) DeleteHost(zone string, _ accounts.User, host string) (*apiv1.Operation, error) {
+	m.reclaimed = append(m.reclaimed, host)
+	return &apiv1.Operation{}, nil
+}
+
+func TestNewIdleHostMonitorInvalidAction(t *testing.T) {
+	_, err := NewIdleHostMonitor(&fakeIdleHostsManager{}, IdlePolicy{TimeoutMinutes: 1, Action: "foo"}, database.NewInMemoryDBService())
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestIdleHostMonitorReclaimsIdleHosts(t *testing.T) {
+	im := &fakeIdleHostsManager{
+		hosts: []*runningHost{
+			{Zone: "local", Name: "idle"},
+			{Zone: "local", Name: "running"},
+			{Zone: "local", Name: "proxied"},
+		},
+		cvds: map[string]string{
+			"idle":    `{"cvds": [{"status": "Stopped"}]}`,
+			"running": `{"cvds": [{"status": "Running"}]}`,
+			"proxied": `{"cvds": []}`,
+		},
+	}
+	m, err := NewIdleHostMonitor(im, IdlePolicy{TimeoutMinutes: 30, Action: StopIdleAction}, database.NewInMemoryDBService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	m.CheckOnce()
+	now = now.Add(20 * time.Minute)
+	m.GetHostClient("local", "proxied")
+	now = now.Add(20 * time.Minute)
+
+	m.CheckOnce()
+
+	if diff := cmp.Diff([]string{"idle"}, im.reclaimed); diff != "" {
+		t.Errorf("reclaimed hosts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestIdleHostMonitorListHostsReportsPolicy(t *testing.T) {
+	im := &fakeIdleHostsManager{hosts: []*runningHost{{Zone: "local", Name: "foo"}}}
+	m, err := NewIdleHostMonitor(im, IdlePolicy{TimeoutMinutes: 30, Action: DeleteIdleAction}, database.NewInMemoryDBService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	res, err := m.ListHosts("local", &TestUser{}, &ListHostsRequest{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &apiv1.IdlePolicy{Action: "delete", ReclaimTime: "2024-01-01T00:30:00Z"}
+	if diff := cmp.Diff(want, res.Items[0].IdlePolicy); diff != "" {
+		t.Errorf("idle policy mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestIdleHostMonitorUsesStoredActivity(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	im := &fakeIdleHostsManager{
+		hosts: []*runningHost{{Zone: "local", Name: "foo"}},
+		cvds:  map[string]string{"foo": `{"cvds": []}`},
+	}
+	policy := IdlePolicy{TimeoutMinutes: 30, Action: StopIdleAction}
+	now := time.Now()
+	// The host is first seen by a previous execution of the orchestrator.
+	previous, err := NewIdleHostMonitor(im, policy, dbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous.now = func() time.Time { return now }
+	previous.CheckOnce()
+	now = now.Add(40 * time.Minute)
+	m, err := NewIdleHostMonitor(im, policy, dbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return now }
+
+	m.CheckOnce()
+
+	if diff := cmp.Diff([]string{"foo"}, im.reclaimed); diff != "" {
+		t.Errorf("reclaimed hosts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Fails to list the activity of every host.
+type noListActivityDB struct {
+	database.Service
+}
+
+func (db *noListActivityDB) ListHostActivity() ([]*hostmeta.Activity, error) {
+	return nil, errors.New("listing every host activity is not expected")
+}
+
+func TestIdleHostMonitorGetHostFetchesHostActivity(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	lastActive := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := dbs.RecordHostActivity(hostmeta.Activity{Zone: "local", Host: "foo", LastActive: lastActive}); err != nil {
+		t.Fatal(err)
+	}
+	im := &fakeIdleHostsManager{hosts: []*runningHost{{Zone: "local", Name: "foo"}}}
+	m, err := NewIdleHostMonitor(im, IdlePolicy{TimeoutMinutes: 30, Action: StopIdleAction}, &noListActivityDB{Service: dbs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return lastActive.Add(time.Minute) }
+
+	res, err := m.GetHost("local", &TestUser{}, "foo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &apiv1.IdlePolicy{Action: "stop", ReclaimTime: "2024-01-01T00:30:00Z"}
+	if diff := cmp.Diff(want, res.IdlePolicy); diff != "" {
+		t.Errorf("idle policy mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -15,10 +15,13 @@
 package instances
 
 import (
+	"log"
 	"net/http/httputil"
+	"time"
 
 	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
 	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
 )
 
 type Manager interface {
@@ -28,12 +31,36 @@ type Manager interface {
 	CreateHost(zone string, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error)
 	// List hosts
 	ListHosts(zone string, user accounts.User, req *ListHostsRequest) (*apiv1.ListHostsResponse, error)
-	// Deletes the given host instance.
+	// Lists the hosts of every user across all zones, meant for administrators. The zone of every
+	// listed host is set.
+	ListAllHosts(req *ListHostsRequest) (*apiv1.ListHostsResponse, error)
+	// Returns the given host instance along with its current status.
+	GetHost(zone string, user accounts.User, host string) (*apiv1.HostInstance, error)
+	// Deletes the given host instance. Its access control list is deleted once it's gone.
 	DeleteHost(zone string, user accounts.User, name string) (*apiv1.Operation, error)
+	// Deletes the given host instance regardless of its owner, the operation is started on behalf
+	// of the given administrator.
+	ForceDeleteHost(zone string, admin accounts.User, host string) (*apiv1.Operation, error)
+	// Stops the given host instance keeping its disk, it can be started again later.
+	StopHost(zone string, user accounts.User, host string) (*apiv1.Operation, error)
+	// Starts the given host instance if stopped or resumes it if suspended.
+	StartHost(zone string, user accounts.User, host string) (*apiv1.Operation, error)
+	// Suspends the given host instance preserving its memory, it can be resumed with `StartHost`.
+	SuspendHost(zone string, user accounts.User, host string) (*apiv1.Operation, error)
 	// Waits until operation is DONE or earlier. If DONE return the expected  response of the operation. If the
 	// original method returns no data on success, such as `Delete`, response will be empty. If the original method
 	// is standard `Get`/`Create`/`Update`, the response should be the relevant resource.
 	WaitOperation(zone string, user accounts.User, name string) (any, error)
+	// Lists the operations started by the given user.
+	ListOperations(zone string, user accounts.User, req *ListOperationsRequest) (*apiv1.ListOperationsResponse, error)
+	// Requests the cancellation of an operation that is not done yet.
+	CancelOperation(zone string, user accounts.User, name string) (*apiv1.Operation, error)
+	// Replaces the user labels of the given host.
+	SetHostLabels(zone string, user accounts.User, host string, req *apiv1.SetHostLabelsRequest) (*apiv1.HostInstance, error)
+	// Sets the expiration time of the given host.
+	ExtendHost(zone string, user accounts.User, host string, req *apiv1.ExtendHostRequest) (*apiv1.HostInstance, error)
+	// Deletes the hosts of every user whose expiration time has passed.
+	DeleteExpiredHosts() ([]*ExpiredHost, error)
 	// Creates a connector to the given host.
 	GetHostClient(zone string, host string) (HostClient, error)
 }
@@ -51,6 +78,15 @@ type HostResponse struct {
 	Error  *apiv1.Error
 }
 
+// Lifecycle status of the hosts.
+const (
+	HostStatusProvisioning = "PROVISIONING"
+	HostStatusRunning      = "RUNNING"
+	HostStatusStopping     = "STOPPING"
+	HostStatusSuspended    = "SUSPENDED"
+	HostStatusTerminated   = "TERMINATED"
+)
+
 type ListHostsRequest struct {
 	// The maximum number of results per page that should be returned. If the number of available results is larger
 	// than MaxResults, a `NextPageToken` will be returned which can be used to get the next page of results
@@ -59,6 +95,59 @@ type ListHostsRequest struct {
 	// Specifies a page token to use.
 	// Use the `NextPageToken` value returned by a previous List request.
 	PageToken string
+	// Only return hosts having all these labels if not empty.
+	LabelSelector map[string]string
+}
+
+// Implemented by users acting on behalf of the owner of a host, i.e: users the host is shared with.
+// Their username is the one of the owner, but the operations they start are recorded as started by
+// the acting user, who may then wait for them, list them and cancel them.
+type Delegate interface {
+	accounts.User
+	// The user acting on behalf of the owner.
+	Actor() accounts.User
+}
+
+// Returns the user the operations started by the given user are recorded as started by.
+func operationUser(user accounts.User) accounts.User {
+	if d, ok := user.(Delegate); ok {
+		return d.Actor()
+	}
+	return user
+}
+
+// The owner of a host, known only by name. Hosts are reclaimed and expired on behalf of their
+// owners.
+type hostOwner string
+
+func (u hostOwner) Username() string { return string(u) }
+
+func (u hostOwner) Email() string { return "" }
+
+// Hosts that are gone leave no access control list behind, otherwise it would apply to a new host
+// with the same name. Failures are only logged since the host is gone already.
+func deleteHostACL(dbs database.Service, zone, host string) {
+	if err := dbs.DeleteHostACL(zone, host); err != nil {
+		log.Printf("failed to delete access control list of host %q in zone %q: %v", host, zone, err)
+	}
+}
+
+type ListOperationsRequest struct {
+	// Only return operations of this type if not empty, i.e: `createhost`.
+	Type string
+	// Only return operations in this state if not empty, i.e: `RUNNING`.
+	State string
+	// The maximum number of results per page that should be returned.
+	MaxResults uint32
+	// Specifies a page token to use.
+	PageToken string
+}
+
+type ExpiredHost struct {
+	Zone       string
+	Name       string
+	Owner      string
+	ExpireTime time.Time
 }
 
 type IMType string
@@ -71,4 +160,6 @@ type Config struct {
 	GCP                               *GCPIMConfig
 	UNIX                              *UNIXIMConfig
 	Docker                            *DockerIMConfig
+	// Interval between runs of the expired hosts reaper, the reaper is disabled if zero.
+	HostReaperIntervalMinutes int
 }
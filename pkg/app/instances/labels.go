@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/errors"
+)
+
+// User labels follow the GCE restrictions so they can be stored in every backend the same way.
+var (
+	labelKeyRe   = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+	labelValueRe = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+)
+
+// Keys of the labels set by the orchestrator without the `cf-` prefix, for compatibility with
+// acloud or in docker containers.
+var reservedLabelKeys = map[string]bool{
+	labelAcloudCreatedBy:  true,
+	dockerLabelExpireTime: true,
+	dockerLabelPool:       true,
+}
+
+func isReservedLabelKey(key string) bool {
+	return strings.HasPrefix(key, labelPrefix) || reservedLabelKeys[key]
+}
+
+func validateUserLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if isReservedLabelKey(k) {
+			return errors.NewBadRequestError(fmt.Sprintf("Label key %q is reserved", k), nil)
+		}
+		if !labelKeyRe.MatchString(k) {
+			return errors.NewBadRequestError(fmt.Sprintf("Invalid label key %q", k), nil)
+		}
+		if !labelValueRe.MatchString(v) {
+			return errors.NewBadRequestError(fmt.Sprintf("Invalid value %q of label %q", v, k), nil)
+		}
+	}
+	return nil
+}
+
+// Parses a comma separated list of `key=value` label requirements, i.e: `team=camera,purpose=ci`.
+// Keys and values follow the restrictions of user labels, as requirements end up in the filters
+// sent to the backends.
+func ParseLabelSelector(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	selector := make(map[string]string)
+	for _, req := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(req), "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label requirement %q, expected key=value", req)
+		}
+		if !labelKeyRe.MatchString(k) {
+			return nil, fmt.Errorf("invalid label key %q", k)
+		}
+		if !labelValueRe.MatchString(v) {
+			return nil, fmt.Errorf("invalid value %q of label %q", v, k)
+		}
+		selector[k] = v
+	}
+	return selector, nil
+}
+
+// Whether the labels include every `key=value` requirement of the selector.
+func MatchesLabelSelector(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the `key=value` label requirements sorted by key.
+func labelSelectorRequirements(selector map[string]string) []string {
+	var reqs []string
+	for k, v := range selector {
+		reqs = append(reqs, k+"="+v)
+	}
+	sort.Strings(reqs)
+	return reqs
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	got, err := ParseLabelSelector("team=camera, purpose=ci")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"team": "camera", "purpose": "ci"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("label selector mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseLabelSelectorInvalid(t *testing.T) {
+	invalid := []string{
+		"team",
+		"=camera",
+		"team=camera,",
+		"Team=camera",
+		`team=camera" OR labels.owner="janedoe`,
+		"team=camera,purpose=c i",
+	}
+	for _, s := range invalid {
+		if _, err := ParseLabelSelector(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestValidateUserLabels(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		valid  bool
+	}{
+		{labels: map[string]string{"team": "camera", "purpose": ""}, valid: true},
+		{labels: map[string]string{"cf-foo": "bar"}},
+		{labels: map[string]string{labelAcloudCreatedBy: "johndoe"}},
+		{labels: map[string]string{"Team": "camera"}},
+		{labels: map[string]string{"team": "Camera"}},
+	}
+	for _, tc := range tests {
+		err := validateUserLabels(tc.labels)
+
+		if tc.valid != (err == nil) {
+			t.Errorf("validateUserLabels(%v) returned %v", tc.labels, err)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 
 	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
 	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/errors"
 )
 
 const UnixIMType IMType = "unix"
@@ -61,9 +62,11 @@ func (m *LocalInstanceManager) ListZones() (*apiv1.ListZonesResponse, error) {
 	}, nil
 }
 
+const localCreateHostOPName = "Create Host"
+
 func (m *LocalInstanceManager) CreateHost(_ string, _ *apiv1.CreateHostRequest, _ accounts.User) (*apiv1.Operation, error) {
 	return &apiv1.Operation{
-		Name: "Create Host",
+		Name: localCreateHostOPName,
 		Done: true,
 	}, nil
 }
@@ -76,14 +79,82 @@ func (m *LocalInstanceManager) ListHosts(zone string, user accounts.User, req *L
 	}, nil
 }
 
+func (m *LocalInstanceManager) ListAllHosts(req *ListHostsRequest) (*apiv1.ListHostsResponse, error) {
+	return &apiv1.ListHostsResponse{
+		Items: []*apiv1.HostInstance{{
+			Name: "local",
+			Zone: "local",
+		}},
+	}, nil
+}
+
+func (m *LocalInstanceManager) GetHost(zone string, user accounts.User, host string) (*apiv1.HostInstance, error) {
+	if host != "local" {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Host %q not found.", host), nil)
+	}
+	addr, err := m.GetHostAddr(zone, host)
+	if err != nil {
+		return nil, err
+	}
+	return &apiv1.HostInstance{
+		Name:        host,
+		Status:      HostStatusRunning,
+		IPAddresses: []string{addr},
+		Owner:       user.Username(),
+	}, nil
+}
+
 func (m *LocalInstanceManager) DeleteHost(zone string, user accounts.User, name string) (*apiv1.Operation, error) {
 	return nil, fmt.Errorf("%T#DeleteHost is not implemented", *m)
 }
 
+func (m *LocalInstanceManager) ForceDeleteHost(zone string, admin accounts.User, host string) (*apiv1.Operation, error) {
+	return nil, fmt.Errorf("%T#ForceDeleteHost is not implemented", *m)
+}
+
+func (m *LocalInstanceManager) StopHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	return nil, fmt.Errorf("%T#StopHost is not implemented", *m)
+}
+
+func (m *LocalInstanceManager) StartHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	return nil, fmt.Errorf("%T#StartHost is not implemented", *m)
+}
+
+func (m *LocalInstanceManager) SuspendHost(zone string, user accounts.User, host string) (*apiv1.Operation, error) {
+	return nil, fmt.Errorf("%T#SuspendHost is not implemented", *m)
+}
+
 func (m *LocalInstanceManager) WaitOperation(zone string, user accounts.User, name string) (any, error) {
 	return nil, fmt.Errorf("%T#WaitOperation is not implemented", *m)
 }
 
+func (m *LocalInstanceManager) ListOperations(zone string, user accounts.User, req *ListOperationsRequest) (*apiv1.ListOperationsResponse, error) {
+	return &apiv1.ListOperationsResponse{
+		Items: []*apiv1.Operation{},
+	}, nil
+}
+
+// Operations of the local host complete before they are returned, there is nothing to cancel.
+func (m *LocalInstanceManager) CancelOperation(zone string, user accounts.User, name string) (*apiv1.Operation, error) {
+	if name == localCreateHostOPName {
+		return nil, errors.NewBadRequestError(fmt.Sprintf("Operation %q is already done.", name), nil)
+	}
+	return nil, errors.NewNotFoundError(fmt.Sprintf("Operation %q not found.", name), nil)
+}
+
+func (m *LocalInstanceManager) ExtendHost(zone string, user accounts.User, host string, req *apiv1.ExtendHostRequest) (*apiv1.HostInstance, error) {
+	return nil, fmt.Errorf("%T#ExtendHost is not implemented", *m)
+}
+
+func (m *LocalInstanceManager) SetHostLabels(zone string, user accounts.User, host string, req *apiv1.SetHostLabelsRequest) (*apiv1.HostInstance, error) {
+	return nil, fmt.Errorf("%T#SetHostLabels is not implemented", *m)
+}
+
+// The local host never expires.
+func (m *LocalInstanceManager) DeleteExpiredHosts() ([]*ExpiredHost, error) {
+	return nil, nil
+}
+
 func (m *LocalInstanceManager) GetHostClient(zone string, host string) (HostClient, error) {
 	url, err := m.GetHostURL(zone, host)
 	if err != nil {
@@ -0,0 +1,444 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
+	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
+	"github.com/google/cloud-android-orchestration/pkg/app/errors"
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
+
+	"github.com/google/uuid"
+)
+
+const (
+	waitOperationTimeout      = 3 * time.Minute
+	waitOperationPollInterval = time.Second
+	// Executing operations are updated this often so other replicas can tell they are alive.
+	operationHeartbeatInterval = 20 * time.Second
+	// Unfinished operations not updated for this long are considered abandoned, i.e: the replica
+	// executing them was restarted.
+	staleOperationTimeout = 2 * time.Minute
+	// Storing the final state of an operation is attempted this many times before its result is
+	// discarded.
+	finishOperationAttempts = 3
+)
+
+// Executes operations in the background, persisting their state through the database service so
+// they can be waited on from any orchestrator replica and survive orchestrator restarts.
+type operationRunner struct {
+	dbs database.Service
+	now func() time.Time
+	// Time to wait before storing the final state of an operation again after a failure.
+	retryDelay time.Duration
+	// Only guards the running map, it's never held during database requests.
+	mtx sync.Mutex
+	// Operations executing in this process keyed by name.
+	running map[string]*runningOperation
+}
+
+type runningOperation struct {
+	cancel context.CancelFunc
+	// Serializes the updates of the operation so the heartbeat never stores an older state.
+	mtx sync.Mutex
+	// Latest state persisted by this process, stored again periodically as a heartbeat.
+	op operation.Operation
+	// Undoes the effects of the operation if its result is discarded because it was cancelled.
+	rollback func()
+}
+
+func newOperationRunner(dbs database.Service) *operationRunner {
+	return &operationRunner{
+		dbs:        dbs,
+		now:        time.Now,
+		retryDelay: time.Second,
+		running:    make(map[string]*runningOperation),
+	}
+}
+
+// Returns the operation if it's executing in this process, nil otherwise.
+func (r *operationRunner) lookup(name string) *runningOperation {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.running[name]
+}
+
+// The context is cancelled when the operation is cancelled, the function is expected to stop
+// and clean up as soon as possible when that happens.
+type operationFunc func(ctx context.Context, op *operation.Operation) (any, error)
+
+// Records a new pending operation and executes the given function in the background. The value
+// returned by the function is stored as the operation's result. Operations started by delegates
+// are recorded as started by the acting user.
+func (r *operationRunner) Start(opType OPType, user accounts.User, host string, fn operationFunc) (*apiv1.Operation, error) {
+	now := r.now()
+	op := &operation.Operation{
+		Name:       EncodeOperationName(opType, uuid.New().String()),
+		Type:       string(opType),
+		Username:   operationUser(user).Username(),
+		Host:       host,
+		State:      operation.PendingState,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err := r.dbs.CreateOrUpdateOperation(*op); err != nil {
+		return nil, fmt.Errorf("failed to store operation: %w", err)
+	}
+	res := buildAPIOperation(op)
+	ctx, cancel := context.WithCancel(context.Background())
+	r.mtx.Lock()
+	r.running[op.Name] = &runningOperation{cancel: cancel, op: *op}
+	r.mtx.Unlock()
+	go r.run(ctx, op, fn)
+	return res, nil
+}
+
+func (r *operationRunner) run(ctx context.Context, op *operation.Operation, fn operationFunc) {
+	defer func() {
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		r.running[op.Name].cancel()
+		delete(r.running, op.Name)
+	}()
+	go r.heartbeat(ctx, op.Name)
+	// Only unfinished operations are updated, so cancellations are never overwritten. The function
+	// still runs with the cancelled context so it can clean up.
+	if ctx.Err() == nil {
+		op.State = operation.RunningState
+		updated, err := r.update(op)
+		switch {
+		case err != nil:
+			// The heartbeat stores it again later.
+			log.Printf("failed to update operation %q: %v", op.Name, err)
+		case !updated:
+			// Cancelled before it started running.
+			r.lookup(op.Name).cancel()
+		}
+	}
+	res, err := fn(ctx, op)
+	if err == nil {
+		op.Result, err = json.Marshal(res)
+	}
+	if err != nil {
+		op.State = operation.ErrorState
+		op.ErrorCode = http.StatusInternalServerError
+		op.ErrorMsg = err.Error()
+		if appErr, ok := err.(*errors.AppError); ok {
+			op.ErrorCode = appErr.StatusCode
+			op.ErrorMsg = appErr.Msg
+		}
+	} else {
+		op.State = operation.DoneState
+	}
+	// The result is discarded if the operation was cancelled, possibly by another replica, or its
+	// final state couldn't be stored. The operation is failed as stale in the latter case.
+	stored := ctx.Err() == nil && r.finish(op)
+	r.mtx.Lock()
+	rollback := r.running[op.Name].rollback
+	r.mtx.Unlock()
+	if !stored {
+		if rollback != nil {
+			rollback()
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("operation %q failed: %v", op.Name, err)
+	}
+}
+
+// Stores the final state of the operation, retrying on failures. Returns whether it was stored.
+func (r *operationRunner) finish(op *operation.Operation) bool {
+	for i := 1; ; i++ {
+		updated, err := r.update(op)
+		if err == nil {
+			return updated
+		}
+		log.Printf("failed to store the final state of operation %q: %v", op.Name, err)
+		if i == finishOperationAttempts {
+			return false
+		}
+		time.Sleep(r.retryDelay)
+	}
+}
+
+// Registers a function undoing the effects of the operation, it's called if the operation is
+// cancelled before its result is stored. Meant to be called by the operation function, i.e: once
+// it created a resource that would be leaked otherwise.
+func (r *operationRunner) OnCancel(op *operation.Operation, rollback func()) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if ro, ok := r.running[op.Name]; ok {
+		ro.rollback = rollback
+	}
+}
+
+// Persists the current state of the operation unless it's already done, which happens when it's
+// cancelled. Failures are only logged since there is nobody waiting for the result of the
+// background execution.
+func (r *operationRunner) Update(op *operation.Operation) {
+	if _, err := r.update(op); err != nil {
+		log.Printf("failed to update operation %q: %v", op.Name, err)
+	}
+}
+
+// Returns false if the operation wasn't updated because it's already done.
+func (r *operationRunner) update(op *operation.Operation) (bool, error) {
+	ro := r.lookup(op.Name)
+	if ro != nil {
+		ro.mtx.Lock()
+		defer ro.mtx.Unlock()
+	}
+	op.UpdateTime = r.now()
+	updated, err := r.dbs.UpdateUnfinishedOperation(*op)
+	if err != nil {
+		return false, err
+	}
+	if ro != nil && updated {
+		ro.op = *op
+	}
+	return updated, nil
+}
+
+// Refreshes the update time of the operation until the context is cancelled, which happens when
+// its execution ends. The latest state persisted by the execution is stored again, so concurrent
+// changes made by the operation function are never overwritten.
+func (r *operationRunner) heartbeat(ctx context.Context, name string) {
+	ticker := time.NewTicker(operationHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if ro := r.lookup(name); ro != nil {
+				r.beat(ro)
+			}
+		}
+	}
+}
+
+func (r *operationRunner) beat(ro *runningOperation) {
+	ro.mtx.Lock()
+	defer ro.mtx.Unlock()
+	op := ro.op
+	op.UpdateTime = r.now()
+	updated, err := r.dbs.UpdateUnfinishedOperation(op)
+	switch {
+	case err != nil:
+		log.Printf("failed to update operation %q: %v", op.Name, err)
+	case updated:
+		ro.op = op
+	default:
+		// Cancelled by another replica.
+		ro.cancel()
+	}
+}
+
+// Whether the operation is unfinished and hasn't been updated recently, which means the replica
+// executing it is gone. Operations executing in this process are never stale.
+func (r *operationRunner) isStale(op *operation.Operation) bool {
+	if op.Done() || r.now().Sub(op.UpdateTime) < staleOperationTimeout {
+		return false
+	}
+	return r.lookup(op.Name) == nil
+}
+
+// Marks the operation as failed if it's stale. Returns whether it was marked, in which case the
+// given operation reflects the stored state.
+func (r *operationRunner) failIfStale(op *operation.Operation) (bool, error) {
+	if !r.isStale(op) {
+		return false, nil
+	}
+	failed := *op
+	failed.State = operation.ErrorState
+	failed.ErrorCode = http.StatusInternalServerError
+	failed.ErrorMsg = "Operation was abandoned, the orchestrator executing it stopped"
+	failed.UpdateTime = r.now()
+	updated, err := r.dbs.UpdateUnfinishedOperation(failed)
+	if err != nil {
+		return false, fmt.Errorf("failed to update operation: %w", err)
+	}
+	if updated {
+		log.Printf("operation %q was abandoned, last updated at %s", op.Name, op.UpdateTime.Format(time.RFC3339))
+		*op = failed
+	}
+	return updated, nil
+}
+
+// Marks the stale operations of every user as failed, returns how many were marked. Meant to be
+// called when the orchestrator starts, so operations interrupted by a restart don't stay pending
+// forever.
+func (r *operationRunner) FailStaleOperations() (int, error) {
+	count := 0
+	for _, state := range []operation.State{operation.PendingState, operation.RunningState} {
+		ops, err := r.dbs.ListOperations(operation.Filter{State: state})
+		if err != nil {
+			return count, fmt.Errorf("failed to list operations: %w", err)
+		}
+		for _, op := range ops {
+			failed, err := r.failIfStale(op)
+			if err != nil {
+				return count, err
+			}
+			if failed {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// Lists the unfinished operations of the given type started by every user. Stale operations are
+// marked as failed instead.
+func (r *operationRunner) listUnfinished(opType OPType) ([]*operation.Operation, error) {
+	var res []*operation.Operation
+	for _, state := range []operation.State{operation.PendingState, operation.RunningState} {
+		ops, err := r.dbs.ListOperations(operation.Filter{Type: string(opType), State: state})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list operations: %w", err)
+		}
+		for _, op := range ops {
+			failed, err := r.failIfStale(op)
+			if err != nil {
+				return nil, err
+			}
+			if !failed {
+				res = append(res, op)
+			}
+		}
+	}
+	return res, nil
+}
+
+// Waits until the operation is done or the wait times out. Returns the JSON encoded result of the
+// operation if successful.
+func (r *operationRunner) Wait(user accounts.User, name string) (any, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), waitOperationTimeout)
+	defer cancel()
+	for {
+		op, err := r.fetch(user, name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.failIfStale(op); err != nil {
+			return nil, err
+		}
+		if op.Done() {
+			return operationResult(op)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.NewServiceUnavailableError("Wait for operation timed out", nil)
+		case <-time.After(waitOperationPollInterval):
+		}
+	}
+}
+
+func (r *operationRunner) List(user accounts.User, req *ListOperationsRequest) (*apiv1.ListOperationsResponse, error) {
+	filter := operation.Filter{
+		Username: user.Username(),
+		Type:     req.Type,
+		State:    operation.State(req.State),
+	}
+	ops, err := r.dbs.ListOperations(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+	items := []*apiv1.Operation{}
+	for _, op := range ops {
+		if _, err := r.failIfStale(op); err != nil {
+			return nil, err
+		}
+		items = append(items, buildAPIOperation(op))
+	}
+	return &apiv1.ListOperationsResponse{Items: items}, nil
+}
+
+// Marks the operation as cancelled and stops its execution if it's running in this process.
+// Executions in other replicas notice the cancellation on their next heartbeat or when they
+// complete, discarding their results.
+func (r *operationRunner) Cancel(user accounts.User, name string) (*apiv1.Operation, error) {
+	op, err := r.fetch(user, name)
+	if err != nil {
+		return nil, err
+	}
+	if op.Done() {
+		return nil, errors.NewBadRequestError(fmt.Sprintf("Operation %q is already done.", name), nil)
+	}
+	op.State = operation.CancelledState
+	op.ErrorCode = http.StatusConflict
+	op.ErrorMsg = "Operation was cancelled"
+	op.UpdateTime = r.now()
+	updated, err := r.dbs.UpdateUnfinishedOperation(*op)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update operation: %w", err)
+	}
+	if !updated {
+		// Completed since it was fetched.
+		return nil, errors.NewBadRequestError(fmt.Sprintf("Operation %q is already done.", name), nil)
+	}
+	if ro := r.lookup(name); ro != nil {
+		ro.cancel()
+	}
+	return buildAPIOperation(op), nil
+}
+
+// Fetches an operation started by the given user. Operations from other users are reported as
+// not found.
+func (r *operationRunner) fetch(user accounts.User, name string) (*operation.Operation, error) {
+	op, err := r.dbs.FetchOperation(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch operation: %w", err)
+	}
+	if op == nil || op.Username != user.Username() {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("Operation %q not found.", name), nil)
+	}
+	return op, nil
+}
+
+func operationResult(op *operation.Operation) (any, error) {
+	if op.State == operation.ErrorState || op.State == operation.CancelledState {
+		return nil, &errors.AppError{
+			Msg:        op.ErrorMsg,
+			StatusCode: op.ErrorCode,
+		}
+	}
+	return json.RawMessage(op.Result), nil
+}
+
+func buildAPIOperation(op *operation.Operation) *apiv1.Operation {
+	return &apiv1.Operation{
+		Name: op.Name,
+		Metadata: &apiv1.OperationMetadata{
+			Type:       op.Type,
+			User:       op.Username,
+			Host:       op.Host,
+			State:      string(op.State),
+			CreateTime: op.CreateTime.Format(time.RFC3339),
+			UpdateTime: op.UpdateTime.Format(time.RFC3339),
+		},
+		Done: op.Done(),
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
+	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/database"
+	apperr "github.com/google/cloud-android-orchestration/pkg/app/errors"
+	"github.com/google/cloud-android-orchestration/pkg/app/operation"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type otherTestUser struct{}
+
+func (i *otherTestUser) Username() string { return "janedoe" }
+
+func (i *otherTestUser) Email() string { return "" }
+
+func TestOperationRunnerStartReturnsPendingOperation(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	r := newOperationRunner(dbs)
+	block := make(chan struct{})
+	defer close(block)
+
+	op, err := r.Start(CreateHostOPType, &TestUser{}, "", func(_ context.Context, _ *operation.Operation) (any, error) {
+		<-block
+		return nil, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.Done {
+		t.Errorf("expected operation not to be done")
+	}
+	stored, err := dbs.FetchOperation(op.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil {
+		t.Fatalf("operation %q was not stored", op.Name)
+	}
+	if diff := cmp.Diff(fakeUsername, stored.Username); diff != "" {
+		t.Errorf("username mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Acts on behalf of `TestUser`.
+type testDelegate struct {
+	TestUser
+}
+
+func (d *testDelegate) Actor() accounts.User { return &otherTestUser{} }
+
+func TestOperationRunnerStartRecordsActorOfDelegate(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	r := newOperationRunner(dbs)
+	block := make(chan struct{})
+	defer close(block)
+
+	op, err := r.Start(DeleteHostOPType, &testDelegate{}, "foo", func(_ context.Context, _ *operation.Operation) (any, error) {
+		<-block
+		return nil, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := dbs.FetchOperation(op.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("janedoe", stored.Username); diff != "" {
+		t.Errorf("username mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOperationRunnerWaitSucceeds(t *testing.T) {
+	r := newOperationRunner(database.NewInMemoryDBService())
+	op, err := r.Start(CreateHostOPType, &TestUser{}, "", func(_ context.Context, op *operation.Operation) (any, error) {
+		op.Host = "foo"
+		return &apiv1.HostInstance{Name: "foo"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := r.Wait(&TestUser{}, op.Name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &apiv1.HostInstance{}
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&apiv1.HostInstance{Name: "foo"}, got); diff != "" {
+		t.Errorf("result mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOperationRunnerWaitFailedOperation(t *testing.T) {
+	r := newOperationRunner(database.NewInMemoryDBService())
+	op, err := r.Start(CreateHostOPType, &TestUser{}, "", func(_ context.Context, _ *operation.Operation) (any, error) {
+		return nil, apperr.NewBadRequestError("bad image", nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Wait(&TestUser{}, op.Name)
+
+	var appErr *apperr.AppError
+	if !errors.As(err, &appErr) {
+		t.Fatalf("error type <<\"%T\">> not found in error chain", appErr)
+	}
+	if diff := cmp.Diff(http.StatusBadRequest, appErr.StatusCode); diff != "" {
+		t.Errorf("status code mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOperationRunnerWaitNotFound(t *testing.T) {
+	r := newOperationRunner(database.NewInMemoryDBService())
+	op, err := r.Start(CreateHostOPType, &TestUser{}, "", func(_ context.Context, _ *operation.Operation) (any, error) {
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"unknown", op.Name} {
+		_, err = r.Wait(&otherTestUser{}, name)
+
+		var appErr *apperr.AppError
+		if !errors.As(err, &appErr) || appErr.StatusCode != http.StatusNotFound {
+			t.Errorf("expected not found error for %q, got: %v", name, err)
+		}
+	}
+}
+
+func TestOperationRunnerListOperations(t *testing.T) {
+	r := newOperationRunner(database.NewInMemoryDBService())
+	block := make(chan struct{})
+	defer close(block)
+	fn := func(_ context.Context, _ *operation.Operation) (any, error) {
+		<-block
+		return nil, nil
+	}
+	create, err := r.Start(CreateHostOPType, &TestUser{}, "", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Start(DeleteHostOPType, &TestUser{}, "foo", fn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Start(CreateHostOPType, &otherTestUser{}, "", fn); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := r.List(&TestUser{}, &ListOperationsRequest{Type: string(CreateHostOPType)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, op := range res.Items {
+		got = append(got, op.Name)
+	}
+	if diff := cmp.Diff([]string{create.Name}, got); diff != "" {
+		t.Errorf("operations mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOperationRunnerCancel(t *testing.T) {
+	r := newOperationRunner(database.NewInMemoryDBService())
+	cancelled := make(chan struct{})
+	op, err := r.Start(CreateHostOPType, &TestUser{}, "", func(ctx context.Context, _ *operation.Operation) (any, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := r.Cancel(&TestUser{}, op.Name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(operation.CancelledState), res.Metadata.State); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+	<-cancelled
+	_, err = r.Wait(&TestUser{}, op.Name)
+	var appErr *apperr.AppError
+	if !errors.As(err, &appErr) || appErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected conflict error, got: %v", err)
+	}
+	if _, err := r.Cancel(&TestUser{}, op.Name); err == nil {
+		t.Errorf("expected error cancelling a done operation")
+	}
+}
+
+func TestOperationRunnerCancelOtherUser(t *testing.T) {
+	r := newOperationRunner(database.NewInMemoryDBService())
+	block := make(chan struct{})
+	defer close(block)
+	op, err := r.Start(CreateHostOPType, &TestUser{}, "", func(_ context.Context, _ *operation.Operation) (any, error) {
+		<-block
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Cancel(&otherTestUser{}, op.Name)
+
+	var appErr *apperr.AppError
+	if !errors.As(err, &appErr) || appErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func TestOperationRunnerCancelBeforeRunning(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	r := newOperationRunner(dbs)
+	op := &operation.Operation{
+		Name:     EncodeOperationName(CreateHostOPType, "foo"),
+		Type:     string(CreateHostOPType),
+		Username: fakeUsername,
+		State:    operation.PendingState,
+	}
+	if err := dbs.CreateOrUpdateOperation(*op); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.running[op.Name] = &runningOperation{cancel: cancel, op: *op}
+	if _, err := r.Cancel(&TestUser{}, op.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	r.run(ctx, op, func(ctx context.Context, _ *operation.Operation) (any, error) {
+		return nil, ctx.Err()
+	})
+
+	stored, err := dbs.FetchOperation(op.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(operation.CancelledState, stored.State); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOperationRunnerWaitAbandonedOperation(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	r := newOperationRunner(dbs)
+	now := time.Now()
+	op := operation.Operation{
+		Name:       EncodeOperationName(CreateHostOPType, "foo"),
+		Type:       string(CreateHostOPType),
+		Username:   fakeUsername,
+		State:      operation.RunningState,
+		CreateTime: now.Add(-time.Hour),
+		UpdateTime: now.Add(-staleOperationTimeout),
+	}
+	if err := dbs.CreateOrUpdateOperation(op); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := r.Wait(&TestUser{}, op.Name)
+
+	var appErr *apperr.AppError
+	if !errors.As(err, &appErr) || appErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected internal server error, got: %v", err)
+	}
+	stored, err := dbs.FetchOperation(op.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(operation.ErrorState, stored.State); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOperationRunnerFailStaleOperations(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	r := newOperationRunner(dbs)
+	stale := time.Now().Add(-staleOperationTimeout)
+	ops := []operation.Operation{
+		{Name: "pending", State: operation.PendingState, UpdateTime: stale},
+		{Name: "running", State: operation.RunningState, UpdateTime: stale},
+		{Name: "recent", State: operation.RunningState, UpdateTime: time.Now()},
+		{Name: "done", State: operation.DoneState, UpdateTime: stale},
+		{Name: "executing", State: operation.RunningState, UpdateTime: stale},
+	}
+	for _, op := range ops {
+		if err := dbs.CreateOrUpdateOperation(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Operations executing in this process are never stale.
+	r.running["executing"] = &runningOperation{cancel: func() {}, op: ops[4]}
+
+	count, err := r.FailStaleOperations()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(2, count); diff != "" {
+		t.Errorf("count mismatch (-want +got):\n%s", diff)
+	}
+	want := map[string]operation.State{
+		"pending":   operation.ErrorState,
+		"running":   operation.ErrorState,
+		"recent":    operation.RunningState,
+		"done":      operation.DoneState,
+		"executing": operation.RunningState,
+	}
+	for name, state := range want {
+		op, err := dbs.FetchOperation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(state, op.State); diff != "" {
+			t.Errorf("state of %q mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+}
+
+func TestOperationRunnerListUnfinished(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	r := newOperationRunner(dbs)
+	now := time.Now()
+	ops := []operation.Operation{
+		{Name: "pending", Type: "createhost", State: operation.PendingState, UpdateTime: now},
+		{Name: "running", Type: "createhost", State: operation.RunningState, UpdateTime: now},
+		{Name: "stale", Type: "createhost", State: operation.RunningState, UpdateTime: now.Add(-staleOperationTimeout)},
+		{Name: "done", Type: "createhost", State: operation.DoneState, UpdateTime: now},
+		{Name: "other", Type: "deletehost", State: operation.RunningState, UpdateTime: now},
+	}
+	for _, op := range ops {
+		if err := dbs.CreateOrUpdateOperation(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := r.listUnfinished(CreateHostOPType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, op := range got {
+		names = append(names, op.Name)
+	}
+	if diff := cmp.Diff([]string{"pending", "running"}, names); diff != "" {
+		t.Errorf("unfinished operations mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOperationRunnerCancelledWhileCompleting(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	r := newOperationRunner(dbs)
+	op := &operation.Operation{
+		Name:     EncodeOperationName(CreateHostOPType, "foo"),
+		Type:     string(CreateHostOPType),
+		Username: fakeUsername,
+		State:    operation.PendingState,
+	}
+	if err := dbs.CreateOrUpdateOperation(*op); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.running[op.Name] = &runningOperation{cancel: cancel, op: *op}
+	rolledBack := false
+
+	r.run(ctx, op, func(_ context.Context, op *operation.Operation) (any, error) {
+		r.OnCancel(op, func() { rolledBack = true })
+		// Cancelled by another replica right before completing.
+		cancelled := *op
+		cancelled.State = operation.CancelledState
+		if err := dbs.CreateOrUpdateOperation(cancelled); err != nil {
+			t.Fatal(err)
+		}
+		return &apiv1.HostInstance{Name: "foo"}, nil
+	})
+
+	stored, err := dbs.FetchOperation(op.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(operation.CancelledState, stored.State); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+	if !rolledBack {
+		t.Error("expected the operation to be rolled back")
+	}
+}
+
+// Fails to update operations to a final state.
+type failingFinishDB struct {
+	database.Service
+}
+
+func (db *failingFinishDB) UpdateUnfinishedOperation(op operation.Operation) (bool, error) {
+	if op.Done() {
+		return false, errors.New("database unavailable")
+	}
+	return db.Service.UpdateUnfinishedOperation(op)
+}
+
+func TestOperationRunnerRollsBackUnstoredResult(t *testing.T) {
+	dbs := database.NewInMemoryDBService()
+	r := newOperationRunner(&failingFinishDB{Service: dbs})
+	r.retryDelay = 0
+	op := &operation.Operation{
+		Name:     EncodeOperationName(CreateHostOPType, "foo"),
+		Type:     string(CreateHostOPType),
+		Username: fakeUsername,
+		State:    operation.PendingState,
+	}
+	if err := dbs.CreateOrUpdateOperation(*op); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.running[op.Name] = &runningOperation{cancel: cancel, op: *op}
+	rolledBack := false
+
+	r.run(ctx, op, func(_ context.Context, op *operation.Operation) (any, error) {
+		r.OnCancel(op, func() { rolledBack = true })
+		return &apiv1.HostInstance{Name: "foo"}, nil
+	})
+
+	stored, err := dbs.FetchOperation(op.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(operation.RunningState, stored.State); diff != "" {
+		t.Errorf("state mismatch (-want +got):\n%s", diff)
+	}
+	if !rolledBack {
+		t.Error("expected the operation to be rolled back")
+	}
+}
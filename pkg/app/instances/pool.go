@@ -0,0 +1,276 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
+	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+)
+
+type WarmPoolConfig struct {
+	Zone string
+	// Machine type of the pool hosts, required for GCP and not supported for docker.
+	MachineType string
+	// Number of unassigned hosts to keep.
+	Size int
+}
+
+type poolHost struct {
+	Name string
+	// Whether the host finished booting and can be handed to a user.
+	Ready bool
+}
+
+// Implemented by the instance managers supporting warm host pools.
+type warmPoolBackend interface {
+	// Lists the unassigned hosts of the pool, including the ones still booting.
+	listPoolHosts(pool *WarmPoolConfig) ([]*poolHost, error)
+	// Creates an unassigned host for the pool.
+	createPoolHost(pool *WarmPoolConfig) error
+	// Hands the pool host to the user. Returns a nil operation if the host was taken already or it
+	// can't satisfy the request.
+	assignPoolHost(pool *WarmPoolConfig, host string, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error)
+	// Returns an error if the pool config isn't supported by the backend.
+	validatePoolConfig(pool *WarmPoolConfig) error
+}
+
+const warmPoolReplenishInterval = time.Minute
+
+// Decorates an instance manager keeping pools of pre-booted hosts, host creation requests matching
+// a pool are served by handing one of its ready hosts to the user. Pools are replenished
+// asynchronously.
+//
+// Unassigned pool hosts count towards the hosts of their zone, pools aren't replenished beyond the
+// maximum number of hosts per zone.
+type WarmPool struct {
+	Manager
+	pools   []*WarmPoolConfig
+	backend warmPoolBackend
+	// Maximum number of hosts in each zone, unlimited if zero.
+	maxHostsPerZone int
+	// Only set if the number of hosts per zone is limited.
+	usageLister hostUsageLister
+	// Serializes the assignment of hosts within this process.
+	assignMtx sync.Mutex
+	mtx       sync.Mutex
+	// Pools being replenished, keyed by their index.
+	replenishing map[int]bool
+}
+
+func NewWarmPool(m Manager, pools []WarmPoolConfig, quota QuotaConfig) (*WarmPool, error) {
+	backend, ok := asBackend[warmPoolBackend](m)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't support warm host pools", m)
+	}
+	p := &WarmPool{
+		Manager:         m,
+		backend:         backend,
+		maxHostsPerZone: quota.MaxHostsPerZone,
+		replenishing:    make(map[int]bool),
+	}
+	if p.maxHostsPerZone > 0 {
+		p.usageLister, ok = asBackend[hostUsageLister](m)
+		if !ok {
+			return nil, fmt.Errorf("%T doesn't support quotas", m)
+		}
+	}
+	for i := range pools {
+		if pools[i].Zone == "" || pools[i].Size <= 0 {
+			return nil, fmt.Errorf("invalid warm pool config: %+v", pools[i])
+		}
+		if err := backend.validatePoolConfig(&pools[i]); err != nil {
+			return nil, fmt.Errorf("invalid warm pool config %+v: %w", pools[i], err)
+		}
+		p.pools = append(p.pools, &pools[i])
+	}
+	return p, nil
+}
+
+func (p *WarmPool) unwrap() Manager {
+	return p.Manager
+}
+
+func (p *WarmPool) CreateHost(zone string, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error) {
+	if i, ok := p.matchPool(zone, req); ok {
+		op, err := p.take(p.pools[i], req, user)
+		if err != nil {
+			log.Printf("failed to take host from warm pool %+v: %v", *p.pools[i], err)
+		}
+		if p.startReplenishing(i) {
+			go func() {
+				defer p.stopReplenishing(i)
+				p.replenish(i)
+			}()
+		}
+		if op != nil {
+			return op, nil
+		}
+	}
+	return p.Manager.CreateHost(zone, req, user)
+}
+
+// Replenishes the pools periodically until the context is cancelled.
+func (p *WarmPool) Run(ctx context.Context) {
+	ticker := time.NewTicker(warmPoolReplenishInterval)
+	defer ticker.Stop()
+	for {
+		for i := range p.pools {
+			if p.startReplenishing(i) {
+				p.replenish(i)
+				p.stopReplenishing(i)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Only requests without customizations beyond the machine type are served from the pools. Pools
+// without machine type, which only docker supports, serve every request of their zone.
+func (p *WarmPool) matchPool(zone string, req *apiv1.CreateHostRequest) (int, bool) {
+	for i, pool := range p.pools {
+		if pool.Zone != zone {
+			continue
+		}
+		if pool.MachineType == "" {
+			return i, true
+		}
+		if req.HostInstance == nil || req.HostInstance.GCP == nil {
+			continue
+		}
+		gcp := req.HostInstance.GCP
+		if gcp.MachineType == pool.MachineType && gcp.MinCPUPlatform == "" && len(gcp.AcceleratorConfigs) == 0 {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (p *WarmPool) take(pool *WarmPoolConfig, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error) {
+	p.assignMtx.Lock()
+	defer p.assignMtx.Unlock()
+	hosts, err := p.backend.listPoolHosts(pool)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hosts {
+		if !h.Ready {
+			continue
+		}
+		op, err := p.backend.assignPoolHost(pool, h.Name, req, user)
+		if err != nil {
+			return nil, err
+		}
+		if op != nil {
+			log.Printf("assigned host %q from warm pool in zone %q to %q", h.Name, pool.Zone, user.Username())
+			return op, nil
+		}
+	}
+	return nil, nil
+}
+
+// Returns false if the pool is being replenished already, only one replenishment of each pool runs
+// at a time within this process.
+func (p *WarmPool) startReplenishing(i int) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.replenishing[i] {
+		return false
+	}
+	p.replenishing[i] = true
+	return true
+}
+
+func (p *WarmPool) stopReplenishing(i int) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	delete(p.replenishing, i)
+}
+
+// Must be called between startReplenishing and stopReplenishing.
+func (p *WarmPool) replenish(i int) {
+	pool := p.pools[i]
+	hosts, err := p.backend.listPoolHosts(pool)
+	if err != nil {
+		log.Printf("failed to list hosts of warm pool %+v: %v", *pool, err)
+		return
+	}
+	missing := pool.Size - len(hosts)
+	if missing <= 0 {
+		return
+	}
+	room, err := p.zoneRoom(pool.Zone)
+	if err != nil {
+		log.Printf("failed to compute the hosts of zone %q: %v", pool.Zone, err)
+		return
+	}
+	if room < missing {
+		missing = room
+	}
+	for n := 0; n < missing; n++ {
+		if err := p.backend.createPoolHost(pool); err != nil {
+			log.Printf("failed to create host for warm pool %+v: %v", *pool, err)
+			return
+		}
+	}
+}
+
+// Returns how many more hosts fit in the zone.
+func (p *WarmPool) zoneRoom(zone string) (int, error) {
+	if p.maxHostsPerZone == 0 {
+		return math.MaxInt, nil
+	}
+	hosts, err := p.usageLister.listHostsUsage()
+	if err != nil {
+		return 0, err
+	}
+	room := p.maxHostsPerZone
+	for _, h := range hosts {
+		if h.Zone == zone {
+			room--
+		}
+	}
+	return room, nil
+}
+
+// Decorators of instance managers expose the manager they decorate.
+type managerDecorator interface {
+	unwrap() Manager
+}
+
+// Finds the first manager in a chain of decorators implementing the given interface.
+func asBackend[T any](m Manager) (T, bool) {
+	for {
+		if b, ok := m.(T); ok {
+			return b, true
+		}
+		d, ok := m.(managerDecorator)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		m = d.unwrap()
+	}
+}
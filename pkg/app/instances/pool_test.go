@@ -0,0 +1,233 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"sync"
+	"testing"
+
+	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
+	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeWarmPoolManager struct {
+	Manager
+	mtx      sync.Mutex
+	hosts    []*poolHost
+	created  int
+	assigned []string
+	// Hosts owned by users.
+	owned int
+}
+
+func (m *fakeWarmPoolManager) CreateHost(zone string, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error) {
+	return &apiv1.Operation{Name: "created"}, nil
+}
+
+func (m *fakeWarmPoolManager) listPoolHosts(pool *WarmPoolConfig) ([]*poolHost, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return append([]*poolHost{}, m.hosts...), nil
+}
+
+func (m *fakeWarmPoolManager) createPoolHost(pool *WarmPoolConfig) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.created++
+	m.hosts = append(m.hosts, &poolHost{Name: "new"})
+	return nil
+}
+
+func (m *fakeWarmPoolManager) assignPoolHost(pool *WarmPoolConfig, host string, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for i, h := range m.hosts {
+		if h.Name == host {
+			m.hosts = append(m.hosts[:i], m.hosts[i+1:]...)
+			m.assigned = append(m.assigned, host)
+			return &apiv1.Operation{Name: "assigned"}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *fakeWarmPoolManager) listHostsUsage() ([]*hostUsage, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	var res []*hostUsage
+	for i := 0; i < m.owned; i++ {
+		res = append(res, &hostUsage{Zone: "us-central1-a", Owner: "janedoe"})
+	}
+	for range m.hosts {
+		res = append(res, &hostUsage{Zone: "us-central1-a"})
+	}
+	return res, nil
+}
+
+func (m *fakeWarmPoolManager) validatePoolConfig(pool *WarmPoolConfig) error {
+	return nil
+}
+
+var testWarmPoolConfigs = []WarmPoolConfig{{Zone: "us-central1-a", MachineType: "n1-standard-4", Size: 2}}
+
+func TestNewWarmPoolUnsupportedManager(t *testing.T) {
+	_, err := NewWarmPool(&LocalInstanceManager{}, testWarmPoolConfigs, QuotaConfig{})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestNewWarmPoolGCEMissingMachineType(t *testing.T) {
+	_, err := NewWarmPool(&GCEInstanceManager{}, []WarmPoolConfig{{Zone: "us-central1-a", Size: 2}}, QuotaConfig{})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestNewWarmPoolThroughDecorator(t *testing.T) {
+	im := &fakeWarmPoolManager{}
+	idle := &IdleHostMonitor{Manager: im}
+
+	_, err := NewWarmPool(idle, testWarmPoolConfigs, QuotaConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWarmPoolCreateHostTakesReadyHost(t *testing.T) {
+	im := &fakeWarmPoolManager{hosts: []*poolHost{{Name: "booting"}, {Name: "ready", Ready: true}}}
+	p, err := NewWarmPool(im, testWarmPoolConfigs, QuotaConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &apiv1.CreateHostRequest{
+		HostInstance: &apiv1.HostInstance{GCP: &apiv1.GCPInstance{MachineType: "n1-standard-4"}},
+	}
+
+	op, err := p.CreateHost("us-central1-a", req, &TestUser{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("assigned", op.Name); diff != "" {
+		t.Errorf("operation name mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"ready"}, im.assigned); diff != "" {
+		t.Errorf("assigned hosts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWarmPoolCreateHostFallsBack(t *testing.T) {
+	tests := []struct {
+		name  string
+		zone  string
+		req   *apiv1.CreateHostRequest
+		hosts []*poolHost
+	}{
+		{
+			name: "no ready hosts",
+			zone: "us-central1-a",
+			req: &apiv1.CreateHostRequest{
+				HostInstance: &apiv1.HostInstance{GCP: &apiv1.GCPInstance{MachineType: "n1-standard-4"}},
+			},
+			hosts: []*poolHost{{Name: "booting"}},
+		},
+		{
+			name: "other zone",
+			zone: "us-west1-a",
+			req: &apiv1.CreateHostRequest{
+				HostInstance: &apiv1.HostInstance{GCP: &apiv1.GCPInstance{MachineType: "n1-standard-4"}},
+			},
+			hosts: []*poolHost{{Name: "ready", Ready: true}},
+		},
+		{
+			name: "custom cpu platform",
+			zone: "us-central1-a",
+			req: &apiv1.CreateHostRequest{
+				HostInstance: &apiv1.HostInstance{
+					GCP: &apiv1.GCPInstance{MachineType: "n1-standard-4", MinCPUPlatform: "Intel Haswell"},
+				},
+			},
+			hosts: []*poolHost{{Name: "ready", Ready: true}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			im := &fakeWarmPoolManager{hosts: tc.hosts}
+			p, err := NewWarmPool(im, testWarmPoolConfigs, QuotaConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			op, err := p.CreateHost(tc.zone, tc.req, &TestUser{})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff("created", op.Name); diff != "" {
+				t.Errorf("operation name mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWarmPoolReplenish(t *testing.T) {
+	im := &fakeWarmPoolManager{hosts: []*poolHost{{Name: "booting"}}}
+	p, err := NewWarmPool(im, testWarmPoolConfigs, QuotaConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.replenish(0)
+
+	if diff := cmp.Diff(1, im.created); diff != "" {
+		t.Errorf("created hosts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWarmPoolReplenishWithinZoneLimit(t *testing.T) {
+	im := &fakeWarmPoolManager{owned: 2}
+	p, err := NewWarmPool(im, testWarmPoolConfigs, QuotaConfig{MaxHostsPerZone: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.replenish(0)
+
+	if diff := cmp.Diff(1, im.created); diff != "" {
+		t.Errorf("created hosts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWarmPoolReplenishesOncePerPool(t *testing.T) {
+	p, err := NewWarmPool(&fakeWarmPoolManager{}, testWarmPoolConfigs, QuotaConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.startReplenishing(0) {
+		t.Fatal("expected the replenishment to start")
+	}
+
+	started := p.startReplenishing(0)
+
+	if started {
+		t.Error("expected the replenishment not to start again")
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
+	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	"github.com/google/cloud-android-orchestration/pkg/app/errors"
+)
+
+type QuotaConfig struct {
+	// Maximum number of hosts each user may own across all zones, unlimited if zero.
+	MaxHostsPerUser int
+	// Maximum number of accelerators attached to the hosts each user owns, unlimited if zero.
+	MaxAcceleratorsPerUser int
+	// Maximum number of hosts owned by all users in each zone, unlimited if zero.
+	MaxHostsPerZone int
+}
+
+func (c *QuotaConfig) Enabled() bool {
+	return c.MaxHostsPerUser > 0 || c.MaxAcceleratorsPerUser > 0 || c.MaxHostsPerZone > 0
+}
+
+// Resources used by a host.
+type hostUsage struct {
+	Zone string
+	// Empty for unassigned warm pool hosts, which only count towards the hosts of their zone.
+	Owner        string
+	Accelerators int64
+}
+
+// Implemented by the instance managers supporting quotas.
+type hostUsageLister interface {
+	// Lists the hosts of every user and warm pool in every zone, regardless of their status,
+	// including the hosts still being created.
+	listHostsUsage() ([]*hostUsage, error)
+}
+
+// Decorates an instance manager rejecting the host creation requests that would exceed the
+// quotas. Usage is computed from the existing hosts and the hosts being created, but requests
+// handled by other orchestrator instances at the same time may not be accounted for.
+type QuotaEnforcer struct {
+	Manager
+	config QuotaConfig
+	lister hostUsageLister
+	// Serializes host creation within this process so concurrent requests can't exceed the quotas.
+	mtx sync.Mutex
+}
+
+func NewQuotaEnforcer(m Manager, cfg QuotaConfig) (*QuotaEnforcer, error) {
+	if cfg.MaxHostsPerUser < 0 || cfg.MaxAcceleratorsPerUser < 0 || cfg.MaxHostsPerZone < 0 {
+		return nil, fmt.Errorf("invalid quota config: %+v", cfg)
+	}
+	lister, ok := asBackend[hostUsageLister](m)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't support quotas", m)
+	}
+	return &QuotaEnforcer{
+		Manager: m,
+		config:  cfg,
+		lister:  lister,
+	}, nil
+}
+
+func (q *QuotaEnforcer) unwrap() Manager {
+	return q.Manager
+}
+
+func (q *QuotaEnforcer) CreateHost(zone string, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	quota, err := q.Quota(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.checkQuota(zone, req, quota); err != nil {
+		return nil, err
+	}
+	return q.Manager.CreateHost(zone, req, user)
+}
+
+// Returns the current usage of the given user along with the limits.
+func (q *QuotaEnforcer) Quota(user accounts.User) (*apiv1.Quota, error) {
+	hosts, err := q.lister.listHostsUsage()
+	if err != nil {
+		return nil, err
+	}
+	quota := &apiv1.Quota{
+		Hosts:        &apiv1.QuotaMetric{Limit: int64(q.config.MaxHostsPerUser)},
+		Accelerators: &apiv1.QuotaMetric{Limit: int64(q.config.MaxAcceleratorsPerUser)},
+		ZoneHosts:    make(map[string]*apiv1.QuotaMetric),
+	}
+	for _, h := range hosts {
+		if h.Owner == user.Username() {
+			quota.Hosts.Usage++
+			quota.Accelerators.Usage += h.Accelerators
+		}
+		zoneHosts, ok := quota.ZoneHosts[h.Zone]
+		if !ok {
+			zoneHosts = &apiv1.QuotaMetric{Limit: int64(q.config.MaxHostsPerZone)}
+			quota.ZoneHosts[h.Zone] = zoneHosts
+		}
+		zoneHosts.Usage++
+	}
+	return quota, nil
+}
+
+func (q *QuotaEnforcer) checkQuota(zone string, req *apiv1.CreateHostRequest, quota *apiv1.Quota) error {
+	accelerators := requestedAccelerators(req)
+	if limit := quota.Accelerators.Limit; limit > 0 && accelerators > limit {
+		return newQuotaError(http.StatusForbidden,
+			fmt.Sprintf("The requested accelerators exceed the limit of %d per user", limit), quota)
+	}
+	if limit := quota.Hosts.Limit; limit > 0 && quota.Hosts.Usage+1 > limit {
+		return newQuotaError(http.StatusTooManyRequests,
+			fmt.Sprintf("Quota exceeded, each user may own up to %d hosts", limit), quota)
+	}
+	if limit := quota.Accelerators.Limit; limit > 0 && quota.Accelerators.Usage+accelerators > limit {
+		return newQuotaError(http.StatusTooManyRequests,
+			fmt.Sprintf("Quota exceeded, each user may use up to %d accelerators", limit), quota)
+	}
+	if limit := int64(q.config.MaxHostsPerZone); limit > 0 {
+		var usage int64
+		if zoneHosts, ok := quota.ZoneHosts[zone]; ok {
+			usage = zoneHosts.Usage
+		}
+		if usage+1 > limit {
+			return newQuotaError(http.StatusTooManyRequests,
+				fmt.Sprintf("Quota exceeded, zone %q may hold up to %d hosts", zone, limit), quota)
+		}
+	}
+	return nil
+}
+
+func requestedAccelerators(req *apiv1.CreateHostRequest) int64 {
+	if req.HostInstance == nil || req.HostInstance.GCP == nil {
+		return 0
+	}
+	var count int64
+	for _, c := range req.HostInstance.GCP.AcceleratorConfigs {
+		count += c.AcceleratorCount
+	}
+	return count
+}
+
+// The current usage is included in the error response.
+func newQuotaError(statusCode int, msg string, quota *apiv1.Quota) error {
+	return &errors.AppError{Msg: msg, StatusCode: statusCode, Details: quota}
+}
+
+// Returns the quota of the given user, fails if the instance manager doesn't enforce quotas.
+func GetQuota(m Manager, user accounts.User) (*apiv1.Quota, error) {
+	q, ok := asBackend[*QuotaEnforcer](m)
+	if !ok {
+		return nil, errors.NewNotFoundError("Quotas are not enabled", nil)
+	}
+	return q.Quota(user)
+}
@@ -0,0 +1,179 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"net/http"
+	"testing"
+
+	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
+	"github.com/google/cloud-android-orchestration/pkg/app/accounts"
+	apperr "github.com/google/cloud-android-orchestration/pkg/app/errors"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeQuotaManager struct {
+	Manager
+	hosts []*hostUsage
+}
+
+func (m *fakeQuotaManager) CreateHost(zone string, req *apiv1.CreateHostRequest, user accounts.User) (*apiv1.Operation, error) {
+	return &apiv1.Operation{Name: "created"}, nil
+}
+
+func (m *fakeQuotaManager) listHostsUsage() ([]*hostUsage, error) {
+	return m.hosts, nil
+}
+
+var testQuotaHosts = []*hostUsage{
+	{Zone: "us-central1-a", Owner: "johndoe", Accelerators: 1},
+	{Zone: "us-central1-a", Owner: "janedoe"},
+	{Zone: "us-west1-a", Owner: "janedoe", Accelerators: 2},
+}
+
+func TestNewQuotaEnforcerUnsupportedManager(t *testing.T) {
+	_, err := NewQuotaEnforcer(&LocalInstanceManager{}, QuotaConfig{MaxHostsPerUser: 1})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestQuotaEnforcerQuota(t *testing.T) {
+	q, err := NewQuotaEnforcer(&fakeQuotaManager{hosts: testQuotaHosts}, QuotaConfig{MaxHostsPerUser: 3, MaxHostsPerZone: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := q.Quota(&TestUser{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &apiv1.Quota{
+		Hosts:        &apiv1.QuotaMetric{Limit: 3, Usage: 1},
+		Accelerators: &apiv1.QuotaMetric{Usage: 1},
+		ZoneHosts: map[string]*apiv1.QuotaMetric{
+			"us-central1-a": {Limit: 5, Usage: 2},
+			"us-west1-a":    {Limit: 5, Usage: 1},
+		},
+	}
+	if diff := cmp.Diff(want, res); diff != "" {
+		t.Errorf("quota mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestQuotaEnforcerCreateHost(t *testing.T) {
+	gpuReq := &apiv1.CreateHostRequest{
+		HostInstance: &apiv1.HostInstance{
+			GCP: &apiv1.GCPInstance{
+				MachineType:        "n1-standard-4",
+				AcceleratorConfigs: []*apiv1.AcceleratorConfig{{AcceleratorCount: 2}},
+			},
+		},
+	}
+	tests := []struct {
+		name   string
+		config QuotaConfig
+		zone   string
+		req    *apiv1.CreateHostRequest
+		// Zero if the host is created.
+		code int
+	}{
+		{
+			name:   "within quota",
+			config: QuotaConfig{MaxHostsPerUser: 2, MaxAcceleratorsPerUser: 3, MaxHostsPerZone: 3},
+			zone:   "us-central1-a",
+			req:    gpuReq,
+		},
+		{
+			name:   "user hosts exceeded",
+			config: QuotaConfig{MaxHostsPerUser: 1},
+			zone:   "us-central1-a",
+			req:    &apiv1.CreateHostRequest{HostInstance: &apiv1.HostInstance{}},
+			code:   http.StatusTooManyRequests,
+		},
+		{
+			name:   "user accelerators exceeded",
+			config: QuotaConfig{MaxAcceleratorsPerUser: 2},
+			zone:   "us-central1-a",
+			req:    gpuReq,
+			code:   http.StatusTooManyRequests,
+		},
+		{
+			name:   "request exceeds accelerators limit",
+			config: QuotaConfig{MaxAcceleratorsPerUser: 1},
+			zone:   "us-central1-a",
+			req:    gpuReq,
+			code:   http.StatusForbidden,
+		},
+		{
+			name:   "zone hosts exceeded",
+			config: QuotaConfig{MaxHostsPerZone: 2},
+			zone:   "us-central1-a",
+			req:    &apiv1.CreateHostRequest{HostInstance: &apiv1.HostInstance{}},
+			code:   http.StatusTooManyRequests,
+		},
+		{
+			name:   "other zone within quota",
+			config: QuotaConfig{MaxHostsPerZone: 2},
+			zone:   "us-west1-a",
+			req:    &apiv1.CreateHostRequest{HostInstance: &apiv1.HostInstance{}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := NewQuotaEnforcer(&fakeQuotaManager{hosts: testQuotaHosts}, tc.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			op, err := q.CreateHost(tc.zone, tc.req, &TestUser{})
+
+			if tc.code == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff("created", op.Name); diff != "" {
+					t.Errorf("operation name mismatch (-want +got):\n%s", diff)
+				}
+				return
+			}
+			appErr, ok := err.(*apperr.AppError)
+			if !ok {
+				t.Fatalf("expected AppError, got: %v", err)
+			}
+			if diff := cmp.Diff(tc.code, appErr.StatusCode); diff != "" {
+				t.Errorf("status code mismatch (-want +got):\n%s", diff)
+			}
+			if _, ok := appErr.Details.(*apiv1.Quota); !ok {
+				t.Errorf("expected quota details, got: %+v", appErr.Details)
+			}
+		})
+	}
+}
+
+func TestGetQuotaNotEnabled(t *testing.T) {
+	_, err := GetQuota(&fakeQuotaManager{}, &TestUser{})
+
+	appErr, ok := err.(*apperr.AppError)
+	if !ok {
+		t.Fatalf("expected AppError, got: %v", err)
+	}
+	if diff := cmp.Diff(http.StatusNotFound, appErr.StatusCode); diff != "" {
+		t.Errorf("status code mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Periodically deletes the hosts whose expiration time has passed.
+type HostReaper struct {
+	Manager  Manager
+	Interval time.Duration
+}
+
+func NewHostReaper(m Manager, interval time.Duration) *HostReaper {
+	return &HostReaper{
+		Manager:  m,
+		Interval: interval,
+	}
+}
+
+// Runs the reaper until the context is cancelled.
+func (r *HostReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		r.ReapOnce()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deletes the expired hosts once and returns them.
+func (r *HostReaper) ReapOnce() []*ExpiredHost {
+	hosts, err := r.Manager.DeleteExpiredHosts()
+	for _, h := range hosts {
+		log.Printf("deleted host %q in zone %q owned by %q, expired at %s",
+			h.Name, h.Zone, h.Owner, h.ExpireTime.Format(time.RFC3339))
+	}
+	if err != nil {
+		log.Printf("failed to delete expired hosts: %v", err)
+	}
+	return hosts
+}
+
+// Returns the expiration time for the given time to live, the zero time if the host never expires.
+func expireTimeFromTTL(ttlSeconds int64) time.Time {
+	if ttlSeconds <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(ttlSeconds) * time.Second)
+}
+
+func formatExpireTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Expiration times are stored in host labels as seconds since the Unix epoch, which fit the
+// restrictions of both GCE and Docker labels.
+func expireTimeLabelValue(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func parseExpireTimeLabel(v string) (time.Time, error) {
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(secs, 0), nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instances
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type expiredHostsManager struct {
+	Manager
+	calls int
+	hosts []*ExpiredHost
+}
+
+func (m *expiredHostsManager) DeleteExpiredHosts() ([]*ExpiredHost, error) {
+	m.calls++
+	return m.hosts, nil
+}
+
+func TestHostReaperReapOnce(t *testing.T) {
+	hosts := []*ExpiredHost{{Zone: "local", Name: "foo", Owner: fakeUsername, ExpireTime: time.Now()}}
+	r := NewHostReaper(&expiredHostsManager{hosts: hosts}, time.Minute)
+
+	got := r.ReapOnce()
+
+	if diff := cmp.Diff(hosts, got); diff != "" {
+		t.Errorf("expired hosts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHostReaperRunStopsWhenContextIsCancelled(t *testing.T) {
+	m := &expiredHostsManager{}
+	r := NewHostReaper(m, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r.Run(ctx)
+
+	if diff := cmp.Diff(1, m.calls); diff != "" {
+		t.Errorf("calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExpireTimeLabelRoundTrip(t *testing.T) {
+	want := time.Unix(1700000000, 0)
+
+	got, err := parseExpireTimeLabel(expireTimeLabelValue(want))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("expected <<%s>>, got %s", want, got)
+	}
+}
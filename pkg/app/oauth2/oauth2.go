@@ -15,6 +15,7 @@
 package oauth2
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -27,25 +28,32 @@ import (
 )
 
 type OAuth2Config struct {
+	// Either "Google" or the name of one of the configured providers.
 	Provider    string
 	RedirectURL string
+	// Providers other than Google, keyed by name.
+	Providers map[string]ProviderConfig
 }
 
 const (
 	GoogleOAuth2Provider = "Google"
 )
 
+// The client credentials are read from the secret manager every time they are needed, so rotated
+// secrets are picked up without restarting.
 type Helper struct {
-	oauth2.Config
+	// Doesn't include the client credentials.
+	config oauth2.Config
+	sm     secrets.SecretManager
 	Revoke func(*oauth2.Token) error
+	// Header used to pass the access token to the host orchestrator.
+	HostOrchestratorHeader string
 }
 
 // Build a oauth2.Config object with Google as the provider.
 func NewGoogleOAuth2Helper(redirectURL string, sm secrets.SecretManager) *Helper {
 	return &Helper{
-		Config: oauth2.Config{
-			ClientID:     sm.OAuth2ClientID(),
-			ClientSecret: sm.OAuth2ClientSecret(),
+		config: oauth2.Config{
 			Scopes: []string{
 				"https://www.googleapis.com/auth/androidbuild.internal",
 				"openid",
@@ -54,10 +62,37 @@ func NewGoogleOAuth2Helper(redirectURL string, sm secrets.SecretManager) *Helper
 			RedirectURL: redirectURL,
 			Endpoint:    google.Endpoint,
 		},
-		Revoke: RevokeGoogleOAuth2Token,
+		sm:                     sm,
+		Revoke:                 RevokeGoogleOAuth2Token,
+		HostOrchestratorHeader: DefaultHostOrchestratorHeader,
 	}
 }
 
+// Returns the configuration with the current client credentials.
+func (h *Helper) Config() *oauth2.Config {
+	c := h.config
+	if r, ok := h.sm.(secrets.OAuth2ClientSecretsReader); ok {
+		s := r.OAuth2ClientSecrets()
+		c.ClientID, c.ClientSecret = s.ClientID, s.ClientSecret
+	} else {
+		c.ClientID = h.sm.OAuth2ClientID()
+		c.ClientSecret = h.sm.OAuth2ClientSecret()
+	}
+	return &c
+}
+
+func (h *Helper) AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string {
+	return h.Config().AuthCodeURL(state, opts...)
+}
+
+func (h *Helper) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	return h.Config().Exchange(ctx, code, opts...)
+}
+
+func (h *Helper) TokenSource(ctx context.Context, tk *oauth2.Token) oauth2.TokenSource {
+	return h.Config().TokenSource(ctx, tk)
+}
+
 func RevokeGoogleOAuth2Token(tk *oauth2.Token) error {
 	if tk == nil {
 		return fmt.Errorf("nil Token")
@@ -0,0 +1,82 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"testing"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/secrets"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type testSecretManager struct {
+	secret string
+}
+
+func (sm *testSecretManager) OAuth2ClientID() string {
+	return "foo"
+}
+
+func (sm *testSecretManager) OAuth2ClientSecret() string {
+	return sm.secret
+}
+
+func TestHelperPicksUpRotatedSecrets(t *testing.T) {
+	sm := &testSecretManager{secret: "bar"}
+	h := NewGoogleOAuth2Helper("http://localhost:8080/oauth2callback", sm)
+
+	sm.secret = "baz"
+
+	if diff := cmp.Diff("baz", h.Config().ClientSecret); diff != "" {
+		t.Errorf("client secret mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("foo", h.Config().ClientID); diff != "" {
+		t.Errorf("client id mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// Returns the secrets of a different rotation on every individual read.
+type rotatingSecretManager struct {
+	reads int
+}
+
+func (sm *rotatingSecretManager) OAuth2ClientID() string {
+	sm.reads++
+	return "id" + string(rune('0'+sm.reads))
+}
+
+func (sm *rotatingSecretManager) OAuth2ClientSecret() string {
+	sm.reads++
+	return "secret" + string(rune('0'+sm.reads))
+}
+
+func (sm *rotatingSecretManager) OAuth2ClientSecrets() secrets.ClientSecrets {
+	sm.reads++
+	return secrets.ClientSecrets{ClientID: "id" + string(rune('0'+sm.reads)), ClientSecret: "secret" + string(rune('0'+sm.reads))}
+}
+
+func TestHelperReadsClientSecretsTogether(t *testing.T) {
+	h := NewGoogleOAuth2Helper("http://localhost:8080/oauth2callback", &rotatingSecretManager{})
+
+	c := h.Config()
+
+	if diff := cmp.Diff("id1", c.ClientID); diff != "" {
+		t.Errorf("client id mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("secret1", c.ClientSecret); diff != "" {
+		t.Errorf("client secret mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/secrets"
+
+	"golang.org/x/oauth2"
+)
+
+// Settings of an OAuth2 provider other than Google. Endpoints not set explicitly are discovered
+// from the issuer's OpenID Connect configuration.
+type ProviderConfig struct {
+	// OpenID Connect issuer, i.e: https://sso.example.com. Its configuration is fetched from
+	// `<Issuer>/.well-known/openid-configuration` if any endpoint is missing.
+	Issuer   string
+	AuthURL  string
+	TokenURL string
+	// Token revocation endpoint (RFC 7009), tokens are not revoked if it's not configured nor
+	// discovered.
+	RevocationURL string
+	// The ID token returned along with the access token identifies the user, so "openid" and "email"
+	// are always requested, they're added to the configured scopes if missing.
+	Scopes []string
+	// Header used to pass the access token to the host orchestrator, defaults to
+	// DefaultHostOrchestratorHeader.
+	HostOrchestratorHeader string
+}
+
+// Header the host orchestrator reads the Build API access token from.
+const DefaultHostOrchestratorHeader = "X-Cutf-Host-Orchestrator-BuildAPI-Creds"
+
+// Scopes required to identify the user from the ID token.
+var defaultProviderScopes = []string{"openid", "email"}
+
+// Builds the helper of the configured provider, either Google or one of the configured providers.
+func NewHelper(config OAuth2Config, sm secrets.SecretManager) (*Helper, error) {
+	if config.Provider == GoogleOAuth2Provider {
+		return NewGoogleOAuth2Helper(config.RedirectURL, sm), nil
+	}
+	pc, ok := config.Providers[config.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown oauth2 provider: %q", config.Provider)
+	}
+	return NewProviderOAuth2Helper(pc, config.RedirectURL, sm)
+}
+
+func NewProviderOAuth2Helper(pc ProviderConfig, redirectURL string, sm secrets.SecretManager) (*Helper, error) {
+	if pc.AuthURL == "" || pc.TokenURL == "" || pc.RevocationURL == "" {
+		if pc.Issuer == "" {
+			if pc.AuthURL == "" || pc.TokenURL == "" {
+				return nil, fmt.Errorf("missing issuer or authorization and token endpoints")
+			}
+		} else if err := discoverEndpoints(&pc); err != nil {
+			return nil, err
+		}
+	}
+	scopes := withRequiredScopes(pc.Scopes)
+	header := pc.HostOrchestratorHeader
+	if header == "" {
+		header = DefaultHostOrchestratorHeader
+	}
+	h := &Helper{
+		config: oauth2.Config{
+			Scopes:      scopes,
+			RedirectURL: redirectURL,
+			Endpoint:    oauth2.Endpoint{AuthURL: pc.AuthURL, TokenURL: pc.TokenURL},
+		},
+		sm:                     sm,
+		HostOrchestratorHeader: header,
+	}
+	h.Revoke = func(tk *oauth2.Token) error {
+		return revokeToken(pc.RevocationURL, h.Config(), tk)
+	}
+	return h, nil
+}
+
+// Appends the required scopes missing from the given ones.
+func withRequiredScopes(scopes []string) []string {
+	res := append([]string(nil), scopes...)
+	for _, required := range defaultProviderScopes {
+		found := false
+		for _, s := range scopes {
+			if s == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, required)
+		}
+	}
+	return res
+}
+
+// Subset of the OpenID Connect provider metadata.
+type oidcProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+}
+
+// Fills the missing endpoints with those of the issuer's configuration.
+func discoverEndpoints(pc *ProviderConfig) error {
+	url := strings.TrimSuffix(pc.Issuer, "/") + "/.well-known/openid-configuration"
+	client := &http.Client{Timeout: 30 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch OpenID configuration: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch OpenID configuration: status %d", res.StatusCode)
+	}
+	var md oidcProviderMetadata
+	if err := json.NewDecoder(res.Body).Decode(&md); err != nil {
+		return fmt.Errorf("failed to decode OpenID configuration: %w", err)
+	}
+	if strings.TrimSuffix(md.Issuer, "/") != strings.TrimSuffix(pc.Issuer, "/") {
+		return fmt.Errorf("OpenID configuration issuer %q doesn't match %q", md.Issuer, pc.Issuer)
+	}
+	if pc.AuthURL == "" {
+		pc.AuthURL = md.AuthorizationEndpoint
+	}
+	if pc.TokenURL == "" {
+		pc.TokenURL = md.TokenEndpoint
+	}
+	if pc.RevocationURL == "" {
+		pc.RevocationURL = md.RevocationEndpoint
+	}
+	if pc.AuthURL == "" || pc.TokenURL == "" {
+		return fmt.Errorf("OpenID configuration of %q lacks authorization or token endpoints", pc.Issuer)
+	}
+	return nil
+}
+
+// Revokes the refresh token if any, which invalidates the access tokens issued with it too in most
+// providers, otherwise the access token.
+func revokeToken(revocationURL string, config *oauth2.Config, tk *oauth2.Token) error {
+	if tk == nil {
+		return fmt.Errorf("nil Token")
+	}
+	if revocationURL == "" {
+		log.Println("tokens can't be revoked, the oauth2 provider has no revocation endpoint")
+		return nil
+	}
+	form := url.Values{"token": {tk.AccessToken}, "token_type_hint": {"access_token"}}
+	if tk.RefreshToken != "" {
+		form = url.Values{"token": {tk.RefreshToken}, "token_type_hint": {"refresh_token"}}
+	}
+	req, err := http.NewRequest(http.MethodPost, revocationURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("token revocation failed with status %d", res.StatusCode)
+	}
+	return nil
+}
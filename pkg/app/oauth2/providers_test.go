@@ -0,0 +1,200 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/oauth2"
+)
+
+// A fake OpenID Connect provider serving its configuration and recording revoked tokens.
+func newFakeProvider(t *testing.T, revoked *[]string) *httptest.Server {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(oidcProviderMetadata{
+				Issuer:                ts.URL,
+				AuthorizationEndpoint: ts.URL + "/authorize",
+				TokenEndpoint:         ts.URL + "/token",
+				RevocationEndpoint:    ts.URL + "/revoke",
+			})
+		case "/revoke":
+			if id, secret, ok := r.BasicAuth(); !ok || id != "foo" || secret != "bar" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			*revoked = append(*revoked, r.PostFormValue("token_type_hint")+":"+r.PostFormValue("token"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestNewHelperDiscoversEndpoints(t *testing.T) {
+	ts := newFakeProvider(t, nil)
+	config := OAuth2Config{
+		Provider:    "build",
+		RedirectURL: "http://localhost:8080/oauth2callback",
+		Providers:   map[string]ProviderConfig{"build": {Issuer: ts.URL}},
+	}
+
+	h, err := NewHelper(config, &testSecretManager{secret: "bar"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := oauth2.Endpoint{AuthURL: ts.URL + "/authorize", TokenURL: ts.URL + "/token"}
+	if diff := cmp.Diff(want, h.Config().Endpoint); diff != "" {
+		t.Errorf("endpoint mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(defaultProviderScopes, h.Config().Scopes); diff != "" {
+		t.Errorf("scopes mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(DefaultHostOrchestratorHeader, h.HostOrchestratorHeader); diff != "" {
+		t.Errorf("header mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewHelperExplicitEndpoints(t *testing.T) {
+	config := OAuth2Config{
+		Provider: "build",
+		Providers: map[string]ProviderConfig{
+			"build": {
+				AuthURL:                "https://sso.example.com/auth",
+				TokenURL:               "https://sso.example.com/token",
+				Scopes:                 []string{"openid", "email", "artifacts"},
+				HostOrchestratorHeader: "X-Build-Token",
+			},
+		},
+	}
+
+	h, err := NewHelper(config, &testSecretManager{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := oauth2.Endpoint{AuthURL: "https://sso.example.com/auth", TokenURL: "https://sso.example.com/token"}
+	if diff := cmp.Diff(want, h.Config().Endpoint); diff != "" {
+		t.Errorf("endpoint mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"openid", "email", "artifacts"}, h.Config().Scopes); diff != "" {
+		t.Errorf("scopes mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("X-Build-Token", h.HostOrchestratorHeader); diff != "" {
+		t.Errorf("header mismatch (-want +got):\n%s", diff)
+	}
+	// Tokens can't be revoked without a revocation endpoint.
+	if err := h.Revoke(&oauth2.Token{AccessToken: "foo"}); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+func TestNewHelperAddsRequiredScopes(t *testing.T) {
+	config := OAuth2Config{
+		Provider: "build",
+		Providers: map[string]ProviderConfig{
+			"build": {
+				AuthURL:  "https://sso.example.com/auth",
+				TokenURL: "https://sso.example.com/token",
+				Scopes:   []string{"email", "artifacts"},
+			},
+		},
+	}
+
+	h, err := NewHelper(config, &testSecretManager{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"email", "artifacts", "openid"}, h.Config().Scopes); diff != "" {
+		t.Errorf("scopes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewHelperFails(t *testing.T) {
+	ts := newFakeProvider(t, nil)
+	tests := []struct {
+		name   string
+		config OAuth2Config
+	}{
+		{
+			name:   "unknown provider",
+			config: OAuth2Config{Provider: "unknown"},
+		},
+		{
+			name: "missing endpoints",
+			config: OAuth2Config{
+				Provider:  "build",
+				Providers: map[string]ProviderConfig{"build": {AuthURL: "https://sso.example.com/auth"}},
+			},
+		},
+		{
+			name: "issuer mismatch",
+			config: OAuth2Config{
+				Provider:  "build",
+				Providers: map[string]ProviderConfig{"build": {Issuer: ts.URL + "/other"}},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewHelper(tc.config, &testSecretManager{})
+
+			if err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestProviderHelperRevoke(t *testing.T) {
+	var revoked []string
+	ts := newFakeProvider(t, &revoked)
+	h, err := NewProviderOAuth2Helper(ProviderConfig{Issuer: ts.URL}, "", &testSecretManager{secret: "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Revoke(&oauth2.Token{AccessToken: "baz", RefreshToken: "qux"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Revoke(&oauth2.Token{AccessToken: "baz"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"refresh_token:qux", "access_token:baz"}
+	if diff := cmp.Diff(want, revoked); diff != "" {
+		t.Errorf("revoked tokens mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewHelperGoogle(t *testing.T) {
+	h, err := NewHelper(OAuth2Config{Provider: GoogleOAuth2Provider}, &testSecretManager{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(DefaultHostOrchestratorHeader, h.HostOrchestratorHeader); diff != "" {
+		t.Errorf("header mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operation
+
+import (
+	"time"
+)
+
+type State string
+
+const (
+	// The operation was recorded but its execution hasn't started yet.
+	PendingState State = "PENDING"
+	RunningState State = "RUNNING"
+	DoneState    State = "DONE"
+	ErrorState   State = "ERROR"
+	// The operation was cancelled by the user before completion.
+	CancelledState State = "CANCELLED"
+)
+
+// A long running operation tracked by the cloud orchestrator.
+type Operation struct {
+	// Unique identifier of the operation.
+	Name string
+	// The kind of operation, i.e: "createhost".
+	Type string
+	// The user who started the operation.
+	Username string
+	// The host the operation acts on, may be empty until the host exists.
+	Host       string
+	State      State
+	CreateTime time.Time
+	UpdateTime time.Time
+	// JSON encoded response of the operation, only relevant when the operation is in DoneState.
+	Result []byte
+	// Only relevant when the operation is in ErrorState.
+	ErrorCode int
+	ErrorMsg  string
+}
+
+// Whether the operation is completed, either successfully or not.
+func (o *Operation) Done() bool {
+	return o.State == DoneState || o.State == ErrorState || o.State == CancelledState
+}
+
+// Selects operations matching all of its non empty fields.
+type Filter struct {
+	Username string
+	Type     string
+	Host     string
+	State    State
+}
+
+func (f *Filter) Matches(o *Operation) bool {
+	return (f.Username == "" || f.Username == o.Username) &&
+		(f.Type == "" || f.Type == o.Type) &&
+		(f.Host == "" || f.Host == o.Host) &&
+		(f.State == "" || f.State == o.State)
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"fmt"
+	"os"
+)
+
+const EnvSMType = "env"
+
+type EnvSMConfig struct {
+	// Names of the environment variables holding the secrets, default to OAUTH2_CLIENT_ID and
+	// OAUTH2_CLIENT_SECRET if empty.
+	ClientIDVar     string
+	ClientSecretVar string
+}
+
+const (
+	defaultClientIDVar     = "OAUTH2_CLIENT_ID"
+	defaultClientSecretVar = "OAUTH2_CLIENT_SECRET"
+)
+
+// A secret manager that reads the secrets from environment variables, usually set by the container
+// runtime. The variables are read once at startup.
+type EnvSecretManager struct {
+	secrets ClientSecrets
+}
+
+func NewEnvSecretManager(config *EnvSMConfig) (*EnvSecretManager, error) {
+	idVar, secretVar := defaultClientIDVar, defaultClientSecretVar
+	if config != nil && config.ClientIDVar != "" {
+		idVar = config.ClientIDVar
+	}
+	if config != nil && config.ClientSecretVar != "" {
+		secretVar = config.ClientSecretVar
+	}
+	sm := &EnvSecretManager{
+		secrets: ClientSecrets{
+			ClientID:     os.Getenv(idVar),
+			ClientSecret: os.Getenv(secretVar),
+		},
+	}
+	if sm.secrets.ClientID == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", idVar)
+	}
+	return sm, nil
+}
+
+func (sm *EnvSecretManager) OAuth2ClientID() string {
+	return sm.secrets.ClientID
+}
+
+func (sm *EnvSecretManager) OAuth2ClientSecret() string {
+	return sm.secrets.ClientSecret
+}
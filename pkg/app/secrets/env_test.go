@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEnvSecretManager(t *testing.T) {
+	t.Setenv("FOO_ID", "foo")
+	t.Setenv("FOO_SECRET", "bar")
+
+	sm, err := NewEnvSecretManager(&EnvSMConfig{ClientIDVar: "FOO_ID", ClientSecretVar: "FOO_SECRET"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("foo", sm.OAuth2ClientID()); diff != "" {
+		t.Errorf("client id mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("bar", sm.OAuth2ClientSecret()); diff != "" {
+		t.Errorf("client secret mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEnvSecretManagerDefaultVariables(t *testing.T) {
+	t.Setenv(defaultClientIDVar, "foo")
+	t.Setenv(defaultClientSecretVar, "bar")
+
+	sm, err := NewEnvSecretManager(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("foo", sm.OAuth2ClientID()); diff != "" {
+		t.Errorf("client id mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEnvSecretManagerMissingVariable(t *testing.T) {
+	t.Setenv(defaultClientIDVar, "")
+
+	_, err := NewEnvSecretManager(&EnvSMConfig{})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
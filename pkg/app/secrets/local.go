@@ -15,40 +15,109 @@
 package secrets
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
+	"sync"
+	"time"
 )
 
 const UnixSMType = "unix"
 
 type UnixSMConfig struct {
 	SecretFilePath string
+	// How often the file is checked for changes, defaults to 60 seconds if zero.
+	ReloadIntervalSeconds int
 }
 
-// A secret manager that reads secrets from a file in JSON format.
+const defaultSecretFileReloadInterval = 60 * time.Second
+
+// A secret manager that reads secrets from a file in JSON format. The file is read again when it's
+// modified, keeping the previous secrets if the new content is invalid.
 type FromFileSecretManager struct {
-	ClientID     string `json:"client_id"`
-	ClientSecret string `json:"client_secret"`
+	path     string
+	interval time.Duration
+	mtx      sync.Mutex
+	secrets  ClientSecrets
+	modTime  time.Time
 }
 
-func NewFromFileSecretManager(path string) (*FromFileSecretManager, error) {
-	r, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open secrets file: %w", err)
+func NewFromFileSecretManager(config *UnixSMConfig) (*FromFileSecretManager, error) {
+	interval := defaultSecretFileReloadInterval
+	if config.ReloadIntervalSeconds > 0 {
+		interval = time.Duration(config.ReloadIntervalSeconds) * time.Second
 	}
-	dec := json.NewDecoder(r)
-	var sm FromFileSecretManager
-	if err := dec.Decode(&sm); err != nil {
+	sm := &FromFileSecretManager{path: config.SecretFilePath, interval: interval}
+	if _, err := sm.Reload(); err != nil {
 		return nil, err
 	}
-	return &sm, nil
+	return sm, nil
+}
+
+// Reads the file again if it was modified since it was last read. Returns whether the secrets
+// were reloaded.
+func (sm *FromFileSecretManager) Reload() (bool, error) {
+	info, err := os.Stat(sm.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open secrets file: %w", err)
+	}
+	sm.mtx.Lock()
+	modTime := sm.modTime
+	sm.mtx.Unlock()
+	if info.ModTime().Equal(modTime) {
+		return false, nil
+	}
+	data, err := os.ReadFile(sm.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open secrets file: %w", err)
+	}
+	var secrets ClientSecrets
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return false, fmt.Errorf("failed to decode secrets file: %w", err)
+	}
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+	sm.secrets = secrets
+	sm.modTime = info.ModTime()
+	return true, nil
+}
+
+func (sm *FromFileSecretManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(sm.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := sm.Reload()
+			if err != nil {
+				log.Printf("failed to reload secrets, keeping the previous ones: %v", err)
+				continue
+			}
+			if reloaded {
+				log.Printf("reloaded secrets from %q", sm.path)
+			}
+		}
+	}
+}
+
+func (sm *FromFileSecretManager) OAuth2ClientSecrets() ClientSecrets {
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+	return sm.secrets
 }
 
 func (sm *FromFileSecretManager) OAuth2ClientID() string {
-	return sm.ClientID
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+	return sm.secrets.ClientID
 }
 
 func (sm *FromFileSecretManager) OAuth2ClientSecret() string {
-	return sm.ClientSecret
+	sm.mtx.Lock()
+	defer sm.mtx.Unlock()
+	return sm.secrets.ClientSecret
 }
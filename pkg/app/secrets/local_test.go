@@ -0,0 +1,98 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func writeSecretsFile(t *testing.T, path, content string, modTime time.Time) {
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Explicit modification times so changes are detected regardless of the file system precision.
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFromFileSecretManagerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	now := time.Now()
+	writeSecretsFile(t, path, `{"client_id": "foo", "client_secret": "bar"}`, now)
+	sm, err := NewFromFileSecretManager(&UnixSMConfig{SecretFilePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := sm.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded {
+		t.Error("expected no reload of unmodified file")
+	}
+	writeSecretsFile(t, path, `{"client_id": "foo", "client_secret": "baz"}`, now.Add(time.Minute))
+	reloaded, err = sm.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reloaded {
+		t.Error("expected reload of modified file")
+	}
+	if diff := cmp.Diff("foo", sm.OAuth2ClientID()); diff != "" {
+		t.Errorf("client id mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("baz", sm.OAuth2ClientSecret()); diff != "" {
+		t.Errorf("client secret mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(ClientSecrets{ClientID: "foo", ClientSecret: "baz"}, sm.OAuth2ClientSecrets()); diff != "" {
+		t.Errorf("client secrets mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromFileSecretManagerKeepsSecretsOnInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	now := time.Now()
+	writeSecretsFile(t, path, `{"client_id": "foo", "client_secret": "bar"}`, now)
+	sm, err := NewFromFileSecretManager(&UnixSMConfig{SecretFilePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSecretsFile(t, path, `{"client_id": `, now.Add(time.Minute))
+
+	_, err = sm.Reload()
+
+	if err == nil {
+		t.Error("expected error")
+	}
+	if diff := cmp.Diff("bar", sm.OAuth2ClientSecret()); diff != "" {
+		t.Errorf("client secret mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewFromFileSecretManagerMissingFile(t *testing.T) {
+	_, err := NewFromFileSecretManager(&UnixSMConfig{SecretFilePath: filepath.Join(t.TempDir(), "foo")})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
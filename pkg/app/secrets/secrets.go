@@ -14,15 +14,33 @@
 
 package secrets
 
+import "context"
+
+// Implementations may return different values over time when the secrets are rotated, callers
+// should read them every time they are needed instead of keeping copies.
 type SecretManager interface {
 	OAuth2ClientID() string
 	OAuth2ClientSecret() string
 }
 
+// Implemented by the secret managers whose secrets change while running, the client ID and secret
+// are read together so they always belong to the same rotation.
+type OAuth2ClientSecretsReader interface {
+	OAuth2ClientSecrets() ClientSecrets
+}
+
+// Implemented by the secret managers able to pick up rotated secrets while running.
+type Reloader interface {
+	// Reloads the secrets periodically until the context is cancelled.
+	Run(ctx context.Context)
+}
+
 type SMType string
 
 type Config struct {
-	Type SMType
-	GCP  *GCPSMConfig
-	UNIX *UnixSMConfig
+	Type  SMType
+	GCP   *GCPSMConfig
+	UNIX  *UnixSMConfig
+	Vault *VaultSMConfig
+	Env   *EnvSMConfig
 }
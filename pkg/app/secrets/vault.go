@@ -0,0 +1,68 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/vault"
+)
+
+const VaultSMType = "Vault"
+
+type VaultSMConfig struct {
+	// Path of a secret with `client_id` and `client_secret` keys in a KV secrets engine, i.e:
+	// "secret/data/cloud-orchestrator" for version 2 engines or "kv/cloud-orchestrator" for version 1.
+	SecretPath string
+}
+
+// A secret manager that reads the secrets from a Vault KV secrets engine.
+type VaultSecretManager struct {
+	secrets ClientSecrets
+}
+
+func NewVaultSecretManager(client *vault.Client, config *VaultSMConfig) (*VaultSecretManager, error) {
+	if config == nil || config.SecretPath == "" {
+		return nil, errors.New("missing Vault secret path")
+	}
+	s, err := client.Read(config.SecretPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+	data := s.Data
+	// Version 2 engines nest the secret under a second data field along with its metadata.
+	var kv2 struct {
+		Data     json.RawMessage `json:"data"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &kv2); err == nil && kv2.Data != nil && kv2.Metadata != nil {
+		data = kv2.Data
+	}
+	sm := &VaultSecretManager{}
+	if err := json.Unmarshal(data, &sm.secrets); err != nil {
+		return nil, fmt.Errorf("failed to decode secrets: %w", err)
+	}
+	return sm, nil
+}
+
+func (s *VaultSecretManager) OAuth2ClientID() string {
+	return s.secrets.ClientID
+}
+
+func (s *VaultSecretManager) OAuth2ClientSecret() string {
+	return s.secrets.ClientSecret
+}
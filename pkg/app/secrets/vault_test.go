@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/cloud-android-orchestration/pkg/app/vault"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// A fake Vault server with a secret in a version 1 and a version 2 KV secrets engine.
+func newFakeVault(t *testing.T) *vault.Client {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "foo" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/auth/token/lookup-self":
+			w.Write([]byte(`{"data": {"ttl": 0}}`))
+		case "/v1/kv/oauth2":
+			w.Write([]byte(`{"data": {"client_id": "id1", "client_secret": "secret1"}}`))
+		case "/v1/secret/data/oauth2":
+			w.Write([]byte(`{"data": {"data": {"client_id": "id2", "client_secret": "secret2"}, "metadata": {"version": 3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	client, err := vault.NewClient(vault.Config{Address: ts.URL, Token: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestVaultSecretManager(t *testing.T) {
+	tests := []struct {
+		path   string
+		id     string
+		secret string
+	}{
+		{path: "kv/oauth2", id: "id1", secret: "secret1"},
+		{path: "secret/data/oauth2", id: "id2", secret: "secret2"},
+	}
+	client := newFakeVault(t)
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			sm, err := NewVaultSecretManager(client, &VaultSMConfig{SecretPath: tc.path})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.id, sm.OAuth2ClientID()); diff != "" {
+				t.Errorf("client id mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.secret, sm.OAuth2ClientSecret()); diff != "" {
+				t.Errorf("client secret mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVaultSecretManagerMissingSecret(t *testing.T) {
+	_, err := NewVaultSecretManager(newFakeVault(t), &VaultSMConfig{SecretPath: "kv/unknown"})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestVaultSecretManagerMissingSecretPath(t *testing.T) {
+	_, err := NewVaultSecretManager(newFakeVault(t), &VaultSMConfig{})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
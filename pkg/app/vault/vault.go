@@ -0,0 +1,331 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Address of the Vault server, i.e: "https://vault.example.com:8200".
+	Address string
+	// Enterprise namespace, if any.
+	Namespace string
+	// Static token to authenticate with, read from the VAULT_TOKEN environment variable if empty and
+	// AppRole isn't configured.
+	Token   string
+	AppRole *AppRoleConfig
+}
+
+// Whether any of the services is configured to use Vault.
+func (c *Config) Enabled() bool {
+	return c.Address != ""
+}
+
+type AppRoleConfig struct {
+	// Where the AppRole auth method is mounted, defaults to "approle".
+	MountPath string
+	RoleID    string
+	// Read from SecretIDFile if empty.
+	SecretID     string
+	SecretIDFile string
+}
+
+// The response of most Vault APIs.
+type Secret struct {
+	Data json.RawMessage `json:"data"`
+	Auth *Auth           `json:"auth"`
+}
+
+type Auth struct {
+	ClientToken string `json:"client_token"`
+	// Seconds.
+	LeaseDuration int  `json:"lease_duration"`
+	Renewable     bool `json:"renewable"`
+}
+
+// A minimal client of the Vault HTTP API. It authenticates with a static token or through AppRole
+// and keeps the token lease alive while Run is executing.
+type Client struct {
+	config     Config
+	httpClient *http.Client
+	mtx        sync.Mutex
+	token      string
+	// Zero if the token doesn't expire.
+	leaseDuration time.Duration
+	// When the lease ends, zero if the token doesn't expire.
+	expiresAt time.Time
+	renewable bool
+	now       func() time.Time
+}
+
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("missing vault address")
+	}
+	c := &Client{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		now:        time.Now,
+	}
+	if err := c.login(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) login() error {
+	if c.config.AppRole == nil {
+		token := c.config.Token
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+		if token == "" {
+			return fmt.Errorf("no vault token or approle configured")
+		}
+		c.setToken(token, 0, false)
+		return c.lookupToken()
+	}
+	ar := c.config.AppRole
+	secretID := ar.SecretID
+	if secretID == "" && ar.SecretIDFile != "" {
+		data, err := os.ReadFile(ar.SecretIDFile)
+		if err != nil {
+			return fmt.Errorf("failed to read approle secret id: %w", err)
+		}
+		secretID = strings.TrimSpace(string(data))
+	}
+	mount := ar.MountPath
+	if mount == "" {
+		mount = "approle"
+	}
+	body := map[string]string{"role_id": ar.RoleID, "secret_id": secretID}
+	s, err := c.do(http.MethodPost, "auth/"+mount+"/login", body)
+	if err != nil {
+		return fmt.Errorf("approle login failed: %w", err)
+	}
+	if s.Auth == nil || s.Auth.ClientToken == "" {
+		return fmt.Errorf("approle login returned no token")
+	}
+	c.setToken(s.Auth.ClientToken, time.Duration(s.Auth.LeaseDuration)*time.Second, s.Auth.Renewable)
+	return nil
+}
+
+// Static tokens may expire too, their lease is renewed the same way.
+func (c *Client) lookupToken() error {
+	s, err := c.Read("auth/token/lookup-self")
+	if err != nil {
+		return fmt.Errorf("failed to look up vault token: %w", err)
+	}
+	var data struct {
+		TTL       int  `json:"ttl"`
+		Renewable bool `json:"renewable"`
+	}
+	if err := json.Unmarshal(s.Data, &data); err != nil {
+		return fmt.Errorf("failed to decode vault token: %w", err)
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.setLeaseLocked(time.Duration(data.TTL) * time.Second)
+	c.renewable = data.Renewable
+	return nil
+}
+
+func (c *Client) setToken(token string, leaseDuration time.Duration, renewable bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.token = token
+	c.setLeaseLocked(leaseDuration)
+	c.renewable = renewable
+}
+
+func (c *Client) setLeaseLocked(leaseDuration time.Duration) {
+	c.leaseDuration = leaseDuration
+	c.expiresAt = time.Time{}
+	if leaseDuration > 0 {
+		c.expiresAt = c.now().Add(leaseDuration)
+	}
+}
+
+// Returns the time the token expired at, zero if it hasn't expired.
+func (c *Client) expiredAt() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.expiresAt.IsZero() || c.now().Before(c.expiresAt) {
+		return time.Time{}
+	}
+	return c.expiresAt
+}
+
+func (c *Client) Read(path string) (*Secret, error) {
+	return c.do(http.MethodGet, path, nil)
+}
+
+func (c *Client) Write(path string, body interface{}) (*Secret, error) {
+	return c.do(http.MethodPost, path, body)
+}
+
+func (c *Client) do(method, path string, body interface{}) (*Secret, error) {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+	url := strings.TrimSuffix(c.config.Address, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequest(method, url, &reqBody)
+	if err != nil {
+		return nil, err
+	}
+	c.mtx.Lock()
+	token := c.token
+	c.mtx.Unlock()
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.config.Namespace)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var errRes struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(res.Body).Decode(&errRes)
+		msg := strings.Join(errRes.Errors, ", ")
+		if t := c.expiredAt(); !t.IsZero() {
+			msg += fmt.Sprintf(" (the vault token expired at %s)", t.Format(time.RFC3339))
+		}
+		return nil, fmt.Errorf("vault %s %s failed with status %d: %s", method, path, res.StatusCode, msg)
+	}
+	s := &Secret{}
+	if res.StatusCode == http.StatusNoContent {
+		return s, nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(s); err != nil {
+		return nil, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return s, nil
+}
+
+// Renews the token lease before it expires until the context is cancelled. Tokens that can't be
+// renewed are replaced by logging in again when using AppRole. Failed renewals are retried with
+// backoff, always before the remaining lease runs out.
+func (c *Client) Run(ctx context.Context) {
+	failures := 0
+	for {
+		c.mtx.Lock()
+		lease := c.leaseDuration
+		expiresAt := c.expiresAt
+		renewable := c.renewable
+		c.mtx.Unlock()
+		if lease == 0 {
+			// The token never expires.
+			return
+		}
+		if !renewable && c.config.AppRole == nil {
+			log.Printf("vault token expires at %s and can't be renewed", expiresAt.Format(time.RFC3339))
+			return
+		}
+		delay := renewalDelay(lease)
+		if failures > 0 {
+			delay = renewalRetryDelay(failures, expiresAt.Sub(c.now()))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if err := c.renew(); err != nil {
+			failures++
+			if t := c.expiredAt(); !t.IsZero() {
+				log.Printf("failed to renew vault token, it expired at %s: %v", t.Format(time.RFC3339), err)
+			} else {
+				log.Printf("failed to renew vault token, it expires at %s: %v", expiresAt.Format(time.RFC3339), err)
+			}
+			continue
+		}
+		failures = 0
+	}
+}
+
+// Renews halfway through the lease, leaving time to retry if it fails.
+func renewalDelay(lease time.Duration) time.Duration {
+	d := lease / 2
+	if d < time.Second {
+		d = time.Second
+	}
+	return d
+}
+
+const (
+	minRenewalRetryDelay = time.Second
+	maxRenewalRetryDelay = time.Minute
+)
+
+// Backs off exponentially after consecutive failures, retrying at least twice more before the
+// remaining lease runs out.
+func renewalRetryDelay(failures int, remaining time.Duration) time.Duration {
+	d := minRenewalRetryDelay
+	for i := 1; i < failures && d < maxRenewalRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRenewalRetryDelay {
+		d = maxRenewalRetryDelay
+	}
+	if d > remaining/2 {
+		d = remaining / 2
+	}
+	if d < minRenewalRetryDelay {
+		d = minRenewalRetryDelay
+	}
+	return d
+}
+
+func (c *Client) renew() error {
+	c.mtx.Lock()
+	renewable := c.renewable
+	c.mtx.Unlock()
+	if renewable {
+		s, err := c.Write("auth/token/renew-self", map[string]string{})
+		if err == nil && s.Auth == nil {
+			err = fmt.Errorf("renewal returned no lease")
+		}
+		if err == nil {
+			c.mtx.Lock()
+			c.setLeaseLocked(time.Duration(s.Auth.LeaseDuration) * time.Second)
+			c.mtx.Unlock()
+			return nil
+		}
+		if c.config.AppRole == nil {
+			return err
+		}
+		log.Printf("failed to renew vault token, logging in again: %v", err)
+	}
+	return c.login()
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// A fake Vault server supporting AppRole login and token renewal.
+type fakeVault struct {
+	mtx sync.Mutex
+	// Valid tokens.
+	tokens      map[string]bool
+	logins      int
+	renewals    int
+	failRenewal bool
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	reply := func(status int, body interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "foo" || body["secret_id"] != "bar" {
+			reply(http.StatusBadRequest, map[string][]string{"errors": {"invalid role or secret id"}})
+			return
+		}
+		v.logins++
+		token := "token" + string(rune('0'+v.logins))
+		v.tokens[token] = true
+		reply(http.StatusOK, map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": token, "lease_duration": 60, "renewable": true},
+		})
+		return
+	}
+	if !v.tokens[r.Header.Get("X-Vault-Token")] {
+		reply(http.StatusForbidden, map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"ttl": 120, "renewable": true}})
+	case "/v1/auth/token/renew-self":
+		if v.failRenewal {
+			reply(http.StatusBadRequest, map[string][]string{"errors": {"lease is not renewable"}})
+			return
+		}
+		v.renewals++
+		reply(http.StatusOK, map[string]interface{}{
+			"auth": map[string]interface{}{"lease_duration": 90, "renewable": true},
+		})
+	case "/v1/secret/foo":
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]string{"foo": "bar"}})
+	default:
+		reply(http.StatusNotFound, map[string][]string{"errors": {}})
+	}
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, string) {
+	v := &fakeVault{tokens: map[string]bool{"static": true}}
+	ts := httptest.NewServer(v)
+	t.Cleanup(ts.Close)
+	return v, ts.URL
+}
+
+func TestNewClientWithToken(t *testing.T) {
+	_, addr := newFakeVault(t)
+
+	c, err := NewClient(Config{Address: addr, Token: "static"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(120*time.Second, c.leaseDuration); diff != "" {
+		t.Errorf("lease duration mismatch (-want +got):\n%s", diff)
+	}
+	s, err := c.Read("secret/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(`{"foo":"bar"}`, string(s.Data)); diff != "" {
+		t.Errorf("data mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewClientWithInvalidToken(t *testing.T) {
+	_, addr := newFakeVault(t)
+
+	_, err := NewClient(Config{Address: addr, Token: "invalid"})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestNewClientWithAppRole(t *testing.T) {
+	v, addr := newFakeVault(t)
+
+	c, err := NewClient(Config{Address: addr, AppRole: &AppRoleConfig{RoleID: "foo", SecretID: "bar"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(1, v.logins); diff != "" {
+		t.Errorf("logins mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := c.Read("secret/foo"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewClientWithInvalidAppRole(t *testing.T) {
+	_, addr := newFakeVault(t)
+
+	_, err := NewClient(Config{Address: addr, AppRole: &AppRoleConfig{RoleID: "foo", SecretID: "baz"}})
+
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestRenewExtendsLease(t *testing.T) {
+	v, addr := newFakeVault(t)
+	c, err := NewClient(Config{Address: addr, Token: "static"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.renew(); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(1, v.renewals); diff != "" {
+		t.Errorf("renewals mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(90*time.Second, c.leaseDuration); diff != "" {
+		t.Errorf("lease duration mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRenewLogsInAgainWhenRenewalFails(t *testing.T) {
+	v, addr := newFakeVault(t)
+	c, err := NewClient(Config{Address: addr, AppRole: &AppRoleConfig{RoleID: "foo", SecretID: "bar"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.failRenewal = true
+
+	if err := c.renew(); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(2, v.logins); diff != "" {
+		t.Errorf("logins mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("token2", c.token); diff != "" {
+		t.Errorf("token mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRenewFailsWithStaticToken(t *testing.T) {
+	v, addr := newFakeVault(t)
+	c, err := NewClient(Config{Address: addr, Token: "static"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.failRenewal = true
+
+	if err := c.renew(); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestRenewalRetryDelay(t *testing.T) {
+	tests := []struct {
+		failures  int
+		remaining time.Duration
+		want      time.Duration
+	}{
+		{1, time.Hour, time.Second},
+		{3, time.Hour, 4 * time.Second},
+		{20, time.Hour, time.Minute},
+		// Retried before the lease runs out.
+		{20, time.Minute, 30 * time.Second},
+		{3, 2 * time.Second, time.Second},
+		{3, -time.Minute, time.Second},
+	}
+	for _, tc := range tests {
+		got := renewalRetryDelay(tc.failures, tc.remaining)
+
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("delay after %d failures with %v remaining mismatch (-want +got):\n%s", tc.failures, tc.remaining, diff)
+		}
+	}
+}
+
+func TestRequestsReportExpiredToken(t *testing.T) {
+	v, addr := newFakeVault(t)
+	c, err := NewClient(Config{Address: addr, Token: "static"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := c.expiresAt
+	c.now = func() time.Time { return expiresAt.Add(time.Second) }
+	v.mtx.Lock()
+	delete(v.tokens, "static")
+	v.mtx.Unlock()
+
+	_, err = c.Read("secret/foo")
+
+	if err == nil || !strings.Contains(err.Error(), "the vault token expired at") {
+		t.Errorf("expected token expiration error, got: %v", err)
+	}
+}
@@ -15,6 +15,7 @@
 package cli
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -31,6 +32,7 @@ import (
 	"syscall"
 	"time"
 
+	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
 	client "github.com/google/cloud-android-orchestration/pkg/client"
 	wclient "github.com/google/cloud-android-orchestration/pkg/webrtcclient"
 
@@ -92,6 +94,39 @@ const (
 	gcpMinCPUPlatformFlagDesc = "Specifies a minimum CPU platform for the VM instance"
 )
 
+const (
+	ttlFlag     = "ttl"
+	hostTTLFlag = "host_ttl"
+)
+
+const (
+	ttlFlagDesc = "Time to live of the host, i.e: 4h. The host is deleted automatically once it expires"
+)
+
+const (
+	labelFlag    = "label"
+	selectorFlag = "selector"
+	roleFlag     = "role"
+)
+
+const (
+	labelFlagDesc    = "Labels of the host, i.e: --label team=camera,purpose=ci"
+	selectorFlagDesc = "Only list hosts having all these labels, i.e: --selector team=camera,purpose=ci"
+	roleFlagDesc     = "Role granted on the host, either viewer or editor"
+)
+
+const (
+	userFlag  = "user"
+	typeFlag  = "type"
+	stateFlag = "state"
+)
+
+const (
+	nameFlag     = "name"
+	identityFlag = "identity"
+	expireFlag   = "expire"
+)
+
 const (
 	branchFlag                = "branch"
 	buildIDFlag               = "build_id"
@@ -408,6 +443,8 @@ func NewCVDRemoteCommand(o *CommandOptions) *CVDRemoteCommand {
 		rootCmd.AddCommand(cmd)
 	}
 	rootCmd.AddCommand(hostCommand(subCmdOpts))
+	rootCmd.AddCommand(operationCommand(subCmdOpts))
+	rootCmd.AddCommand(apiKeyCommand(subCmdOpts))
 	getConfigCommand := &cobra.Command{
 		Use:    "get_config",
 		Short:  "Get a specific configuration value.",
@@ -451,13 +488,17 @@ func hostCommand(opts *subCommandOpts) *cobra.Command {
 	create.Flags().StringVar(&createFlags.GCP.MinCPUPlatform, gcpMinCPUPlatformFlag,
 		opts.InitialConfig.Host.GCP.MinCPUPlatform, gcpMinCPUPlatformFlagDesc)
 	create.Flags().StringArrayVar(&acceleratorFlagValues, acceleratorFlag, nil, acceleratorFlagDesc)
+	create.Flags().DurationVar(&createFlags.TTL, ttlFlag, 0, ttlFlagDesc)
+	create.Flags().StringToStringVar(&createFlags.Labels, labelFlag, nil, labelFlagDesc)
+	listOpts := &client.ListHostsOpts{}
 	list := &cobra.Command{
 		Use:   "list",
 		Short: "Lists hosts.",
 		RunE: func(c *cobra.Command, args []string) error {
-			return runListHostCommand(c, opts.RootFlags, opts)
+			return runListHostCommand(c, opts.RootFlags, listOpts, opts)
 		},
 	}
+	list.Flags().StringVar(&listOpts.LabelSelector, selectorFlag, "", selectorFlagDesc)
 	del := &cobra.Command{
 		Use:   "delete <foo> <bar> <baz>",
 		Short: "Delete hosts.",
@@ -465,6 +506,69 @@ func hostCommand(opts *subCommandOpts) *cobra.Command {
 			return runDeleteHostsCommand(c, args, opts.RootFlags, opts)
 		},
 	}
+	describe := &cobra.Command{
+		Use:   "describe <host>",
+		Short: "Describes a host, including its status.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runDescribeHostCommand(c, args[0], opts)
+		},
+	}
+	stop := &cobra.Command{
+		Use:   "stop <host>",
+		Short: "Stops a host keeping its disk.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runStopHostCommand(c, args[0], opts)
+		},
+	}
+	start := &cobra.Command{
+		Use:   "start <host>",
+		Short: "Starts a stopped host or resumes a suspended one.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runStartHostCommand(c, args[0], opts)
+		},
+	}
+	var extendTTL time.Duration
+	extend := &cobra.Command{
+		Use:   "extend <host>",
+		Short: "Sets the expiration time of a host.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runExtendHostCommand(c, args[0], extendTTL, opts)
+		},
+	}
+	extend.Flags().DurationVar(&extendTTL, ttlFlag, 0, "Time to live of the host from now, i.e: 4h")
+	extend.MarkFlagRequired(ttlFlag)
+	var labels map[string]string
+	label := &cobra.Command{
+		Use:   "label <host>",
+		Short: "Replaces the labels of a host.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runLabelHostCommand(c, args[0], labels, opts)
+		},
+	}
+	label.Flags().StringToStringVar(&labels, labelFlag, nil, labelFlagDesc)
+	var role string
+	share := &cobra.Command{
+		Use:   "share <host> <user|group:name>...",
+		Short: "Shares a host with other users or groups.",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runShareHostCommand(c, args[0], args[1:], role, opts)
+		},
+	}
+	share.Flags().StringVar(&role, roleFlag, "viewer", roleFlagDesc)
+	unshare := &cobra.Command{
+		Use:   "unshare <host> <user|group:name>...",
+		Short: "Stops sharing a host with other users or groups.",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runUnshareHostCommand(c, args[0], args[1:], opts)
+		},
+	}
 	host := &cobra.Command{
 		Use:   "host",
 		Short: "Work with hosts",
@@ -472,9 +576,96 @@ func hostCommand(opts *subCommandOpts) *cobra.Command {
 	host.AddCommand(create)
 	host.AddCommand(list)
 	host.AddCommand(del)
+	host.AddCommand(describe)
+	host.AddCommand(stop)
+	host.AddCommand(start)
+	host.AddCommand(extend)
+	host.AddCommand(label)
+	host.AddCommand(share)
+	host.AddCommand(unshare)
 	return host
 }
 
+func operationCommand(opts *subCommandOpts) *cobra.Command {
+	listOpts := &client.ListOperationsOpts{}
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Lists operations.",
+		RunE: func(c *cobra.Command, args []string) error {
+			return runListOperationsCommand(c, listOpts, opts)
+		},
+	}
+	list.Flags().StringVar(&listOpts.User, userFlag, "", "Only list operations started by this user")
+	list.Flags().StringVar(&listOpts.Type, typeFlag, "", "Only list operations of this type, i.e: createhost")
+	list.Flags().StringVar(&listOpts.State, stateFlag, "", "Only list operations in this state, i.e: RUNNING")
+	wait := &cobra.Command{
+		Use:   "wait <name>",
+		Short: "Waits for an operation to be done and prints its result.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runWaitOperationCommand(c, args[0], opts)
+		},
+	}
+	cancel := &cobra.Command{
+		Use:   "cancel <name>",
+		Short: "Cancels an operation.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runCancelOperationCommand(c, args[0], opts)
+		},
+	}
+	operation := &cobra.Command{
+		Use:   "operation",
+		Short: "Work with operations",
+	}
+	operation.AddCommand(list)
+	operation.AddCommand(wait)
+	operation.AddCommand(cancel)
+	return operation
+}
+
+func apiKeyCommand(opts *subCommandOpts) *cobra.Command {
+	createReq := &apiv1.CreateAPIKeyRequest{}
+	var keyTTL time.Duration
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Creates an api key and prints its secret, it can't be retrieved later.",
+		RunE: func(c *cobra.Command, args []string) error {
+			createReq.TTLSeconds = int64(keyTTL / time.Second)
+			return runCreateAPIKeyCommand(c, createReq, opts)
+		},
+	}
+	create.Flags().StringVar(&createReq.Name, nameFlag, "", "Description of the key, i.e: \"presubmit bot\"")
+	create.Flags().StringVar(&createReq.Identity, identityFlag, "", "Username of the requests authenticated with the key, i.e: svc-ci-bot")
+	create.Flags().DurationVar(&keyTTL, ttlFlag, 0, "Time to live of the key, i.e: 720h. The key never expires if not set")
+	create.MarkFlagRequired(identityFlag)
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Lists api keys.",
+		RunE: func(c *cobra.Command, args []string) error {
+			return runListAPIKeysCommand(c, opts)
+		},
+	}
+	var expire bool
+	revoke := &cobra.Command{
+		Use:   "revoke <id>...",
+		Short: "Revokes api keys.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return runRevokeAPIKeysCommand(c, args, expire, opts)
+		},
+	}
+	revoke.Flags().BoolVar(&expire, expireFlag, false, "Expire the keys instead of deleting them, expired keys are still listed")
+	apiKey := &cobra.Command{
+		Use:   "apikey",
+		Short: "Work with api keys, only admins may create and revoke them",
+	}
+	apiKey.AddCommand(create)
+	apiKey.AddCommand(list)
+	apiKey.AddCommand(revoke)
+	return apiKey
+}
+
 func cvdCommands(opts *subCommandOpts) []*cobra.Command {
 	// Create command
 	createFlags := &CreateCVDFlags{
@@ -569,6 +760,8 @@ func cvdCommands(opts *subCommandOpts) []*cobra.Command {
 		create.Flags().StringVar(f.ValueRef, name, f.Default, f.Desc)
 		create.MarkFlagsMutuallyExclusive(hostFlag, name)
 	}
+	create.Flags().DurationVar(&createFlags.CreateHostOpts.TTL, hostTTLFlag, 0, ttlFlagDesc)
+	create.MarkFlagsMutuallyExclusive(hostFlag, hostTTLFlag)
 	// List command
 	listFlags := &ListCVDsFlags{CVDRemoteFlags: opts.RootFlags}
 	list := &cobra.Command{
@@ -660,12 +853,12 @@ func runCreateHostCommand(c *cobra.Command, flags *CreateHostFlags, opts *subCom
 	return nil
 }
 
-func runListHostCommand(c *cobra.Command, flags *CVDRemoteFlags, opts *subCommandOpts) error {
+func runListHostCommand(c *cobra.Command, flags *CVDRemoteFlags, listOpts *client.ListHostsOpts, opts *subCommandOpts) error {
 	apiClient, err := opts.ServiceBuilder(flags, c)
 	if err != nil {
 		return err
 	}
-	hosts, err := apiClient.ListHosts()
+	hosts, err := apiClient.ListHosts(listOpts)
 	if err != nil {
 		return fmt.Errorf("error listing hosts: %w", err)
 	}
@@ -675,6 +868,112 @@ func runListHostCommand(c *cobra.Command, flags *CVDRemoteFlags, opts *subComman
 	return nil
 }
 
+func runDescribeHostCommand(c *cobra.Command, host string, opts *subCommandOpts) error {
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	ins, err := service.GetHost(host)
+	if err != nil {
+		return fmt.Errorf("error getting host: %w", err)
+	}
+	out, err := json.MarshalIndent(ins, "", "  ")
+	if err != nil {
+		return err
+	}
+	c.Printf("%s\n", out)
+	return nil
+}
+
+func runStopHostCommand(c *cobra.Command, host string, opts *subCommandOpts) error {
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	if err := service.StopHost(host); err != nil {
+		return fmt.Errorf("error stopping host: %w", err)
+	}
+	c.Printf("%s\n", host)
+	return nil
+}
+
+func runStartHostCommand(c *cobra.Command, host string, opts *subCommandOpts) error {
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	ins, err := service.StartHost(host)
+	if err != nil {
+		return fmt.Errorf("error starting host: %w", err)
+	}
+	c.Printf("%s\n", ins.Name)
+	return nil
+}
+
+func runExtendHostCommand(c *cobra.Command, host string, ttl time.Duration, opts *subCommandOpts) error {
+	if ttl <= 0 {
+		return fmt.Errorf("invalid --%s value: must be positive", ttlFlag)
+	}
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	ins, err := extendHost(service, host, ttl)
+	if err != nil {
+		return fmt.Errorf("error extending host: %w", err)
+	}
+	c.Printf("%s\t%s\n", ins.Name, ins.ExpireTime)
+	return nil
+}
+
+func runLabelHostCommand(c *cobra.Command, host string, labels map[string]string, opts *subCommandOpts) error {
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	ins, err := service.SetHostLabels(host, &apiv1.SetHostLabelsRequest{Labels: labels})
+	if err != nil {
+		return fmt.Errorf("error setting host labels: %w", err)
+	}
+	c.Println(ins.Name)
+	return nil
+}
+
+func runShareHostCommand(c *cobra.Command, host string, principals []string, role string, opts *subCommandOpts) error {
+	if role != "viewer" && role != "editor" {
+		return fmt.Errorf("invalid --%s value: must be viewer or editor", roleFlag)
+	}
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	acl, err := shareHost(service, host, principals, role)
+	if err != nil {
+		return fmt.Errorf("error sharing host: %w", err)
+	}
+	printHostACL(c, acl)
+	return nil
+}
+
+func runUnshareHostCommand(c *cobra.Command, host string, principals []string, opts *subCommandOpts) error {
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	acl, err := unshareHost(service, host, principals)
+	if err != nil {
+		return fmt.Errorf("error unsharing host: %w", err)
+	}
+	printHostACL(c, acl)
+	return nil
+}
+
+func printHostACL(c *cobra.Command, acl *apiv1.HostACL) {
+	for _, e := range acl.Entries {
+		c.Printf("%s\t%s\n", e.Principal, e.Role)
+	}
+}
+
 func runDeleteHostsCommand(c *cobra.Command, args []string, flags *CVDRemoteFlags, opts *subCommandOpts) error {
 	service, err := opts.ServiceBuilder(flags, c)
 	if err != nil {
@@ -696,6 +995,101 @@ func runDeleteHostsCommand(c *cobra.Command, args []string, flags *CVDRemoteFlag
 	return service.DeleteHosts(hosts)
 }
 
+func runListOperationsCommand(c *cobra.Command, listOpts *client.ListOperationsOpts, opts *subCommandOpts) error {
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	res, err := service.ListOperations(listOpts)
+	if err != nil {
+		return fmt.Errorf("error listing operations: %w", err)
+	}
+	for _, op := range res.Items {
+		if op.Metadata == nil {
+			c.Printf("%s\n", op.Name)
+			continue
+		}
+		c.Printf("%s\t%s\t%s\n", op.Name, op.Metadata.Type, op.Metadata.State)
+	}
+	return nil
+}
+
+func runWaitOperationCommand(c *cobra.Command, name string, opts *subCommandOpts) error {
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	var res json.RawMessage
+	if err := service.WaitOperation(name, &res); err != nil {
+		return fmt.Errorf("error waiting for operation: %w", err)
+	}
+	c.Printf("%s\n", res)
+	return nil
+}
+
+func runCancelOperationCommand(c *cobra.Command, name string, opts *subCommandOpts) error {
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	op, err := service.CancelOperation(name)
+	if err != nil {
+		return fmt.Errorf("error cancelling operation: %w", err)
+	}
+	c.Printf("%s\n", op.Name)
+	return nil
+}
+
+func runCreateAPIKeyCommand(c *cobra.Command, req *apiv1.CreateAPIKeyRequest, opts *subCommandOpts) error {
+	if req.TTLSeconds < 0 {
+		return fmt.Errorf("invalid --%s value: must not be negative", ttlFlag)
+	}
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	res, err := service.CreateAPIKey(req)
+	if err != nil {
+		return fmt.Errorf("error creating api key: %w", err)
+	}
+	c.Printf("%s\n", res.Key)
+	return nil
+}
+
+func runListAPIKeysCommand(c *cobra.Command, opts *subCommandOpts) error {
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	res, err := service.ListAPIKeys()
+	if err != nil {
+		return fmt.Errorf("error listing api keys: %w", err)
+	}
+	for _, k := range res.Items {
+		c.Printf("%s\t%s\t%s\t%s\n", k.ID, k.Identity, k.Name, k.ExpireTime)
+	}
+	return nil
+}
+
+func runRevokeAPIKeysCommand(c *cobra.Command, ids []string, expire bool, opts *subCommandOpts) error {
+	service, err := opts.ServiceBuilder(opts.RootFlags, c)
+	if err != nil {
+		return err
+	}
+	var merr error
+	for _, id := range ids {
+		if expire {
+			_, err = service.ExpireAPIKey(id)
+		} else {
+			err = service.RevokeAPIKey(id)
+		}
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("error revoking api key %q: %w", id, err))
+		}
+	}
+	return merr
+}
+
 func disconnectDevicesByHost(host string, opts *subCommandOpts) error {
 	controlDir := opts.InitialConfig.ConnectionControlDirExpanded()
 	statuses, err := listCVDConnectionsByHost(controlDir, host)
@@ -1124,9 +1518,9 @@ func runConnectionProxyAgentCommand(flags *ConnectFlags, c *command, args []stri
 	controlDir := opts.InitialConfig.ConnectionControlDirExpanded()
 
 	// Retrieving IP address and port of ADB connection
-	host, err := findHost(service, flags.host)
+	host, err := service.GetHost(flags.host)
 	if err != nil {
-		return fmt.Errorf("failed to find host")
+		return fmt.Errorf("failed to find host: %w", err)
 	}
 	if host.Docker == nil {
 		return errors.New("instance type should be Docker")
@@ -1353,7 +1747,7 @@ func buildServiceBuilder(builder client.ServiceBuilder, authnConfig *AuthnConfig
 			ChunkSizeBytes: chunkSizeBytes,
 		}
 		if authnConfig != nil {
-			if authnConfig.OIDCToken != nil && authnConfig.HTTPBasicAuthn != nil {
+			if authnConfig.countOptions() > 1 {
 				return nil, fmt.Errorf("should only set one authentication option")
 			}
 			opts.Authn = &client.AuthnOpts{}
@@ -1379,6 +1773,20 @@ func buildServiceBuilder(builder client.ServiceBuilder, authnConfig *AuthnConfig
 				default:
 					return nil, fmt.Errorf("invalid http basic authn UsernameSrc type: %s", authnConfig.HTTPBasicAuthn.UsernameSrc)
 				}
+			} else if authnConfig.APIKey != nil {
+				content, err := os.ReadFile(authnConfig.APIKey.KeyFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed loading api key: %w", err)
+				}
+				opts.Authn.APIKey = &client.APIKey{
+					Value: strings.TrimSpace(string(content)),
+				}
+			} else if authnConfig.MTLS != nil {
+				cert, err := tls.LoadX509KeyPair(authnConfig.MTLS.CertFile, authnConfig.MTLS.KeyFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed loading client certificate: %w", err)
+				}
+				opts.Authn.ClientCert = &cert
 			}
 		}
 		return builder(opts)
@@ -43,6 +43,11 @@ func TestRequiredFlags(t *testing.T) {
 			FlagNames: []string{serviceURLFlag},
 			Args:      []string{"host", "create"},
 		},
+		{
+			Name:      "apikey create",
+			FlagNames: []string{identityFlag, serviceURLFlag},
+			Args:      []string{"apikey", "create"},
+		},
 	}
 
 	for _, test := range tests {
@@ -101,16 +106,90 @@ func (fakeService) CreateHost(req *apiv1.CreateHostRequest) (*apiv1.HostInstance
 	return &apiv1.HostInstance{Name: "foo"}, nil
 }
 
-func (fakeService) ListHosts() (*apiv1.ListHostsResponse, error) {
+func (fakeService) ListHosts(opts *client.ListHostsOpts) (*apiv1.ListHostsResponse, error) {
+	if opts.LabelSelector == "team=camera" {
+		return &apiv1.ListHostsResponse{
+			Items: []*apiv1.HostInstance{{Name: "foo", Labels: map[string]string{"team": "camera"}}},
+		}, nil
+	}
 	return &apiv1.ListHostsResponse{
 		Items: []*apiv1.HostInstance{{Name: "foo"}, {Name: "bar"}},
 	}, nil
 }
 
+func (fakeService) GetHost(name string) (*apiv1.HostInstance, error) {
+	return &apiv1.HostInstance{Name: name, Status: "RUNNING"}, nil
+}
+
 func (fakeService) DeleteHosts(name []string) error {
 	return nil
 }
 
+func (fakeService) ExtendHost(name string, req *apiv1.ExtendHostRequest) (*apiv1.HostInstance, error) {
+	return &apiv1.HostInstance{Name: name, ExpireTime: "2024-01-01T04:00:00Z"}, nil
+}
+
+func (fakeService) SetHostLabels(name string, req *apiv1.SetHostLabelsRequest) (*apiv1.HostInstance, error) {
+	return &apiv1.HostInstance{Name: name, Labels: req.Labels}, nil
+}
+
+func (fakeService) GetHostACL(name string) (*apiv1.HostACL, error) {
+	return &apiv1.HostACL{
+		Owner:   "johndoe",
+		Entries: []*apiv1.HostACLEntry{{Principal: "user:janedoe", Role: "viewer"}},
+	}, nil
+}
+
+func (fakeService) SetHostACL(name string, acl *apiv1.HostACL) (*apiv1.HostACL, error) {
+	return &apiv1.HostACL{Owner: "johndoe", Entries: acl.Entries}, nil
+}
+
+func (fakeService) StopHost(name string) error {
+	return nil
+}
+
+func (fakeService) StartHost(name string) (*apiv1.HostInstance, error) {
+	return &apiv1.HostInstance{Name: name}, nil
+}
+
+func (fakeService) ListOperations(opts *client.ListOperationsOpts) (*apiv1.ListOperationsResponse, error) {
+	return &apiv1.ListOperationsResponse{
+		Items: []*apiv1.Operation{
+			{Name: "op-1", Metadata: &apiv1.OperationMetadata{Type: "createhost", State: "RUNNING"}},
+			{Name: "op-2", Metadata: &apiv1.OperationMetadata{Type: "deletehost", State: "DONE"}},
+		},
+	}, nil
+}
+
+func (fakeService) WaitOperation(name string, res any) error {
+	return json.Unmarshal([]byte(`{"name":"foo"}`), res)
+}
+
+func (fakeService) CancelOperation(name string) (*apiv1.Operation, error) {
+	return &apiv1.Operation{Name: name}, nil
+}
+
+func (fakeService) CreateAPIKey(req *apiv1.CreateAPIKeyRequest) (*apiv1.APIKey, error) {
+	return &apiv1.APIKey{ID: "foo", Identity: req.Identity, Key: "foo.secret"}, nil
+}
+
+func (fakeService) ListAPIKeys() (*apiv1.ListAPIKeysResponse, error) {
+	return &apiv1.ListAPIKeysResponse{
+		Items: []*apiv1.APIKey{
+			{ID: "foo", Name: "presubmit", Identity: "svc-ci-bot"},
+			{ID: "bar", Name: "nightly", Identity: "svc-ci-bot", ExpireTime: "2024-01-01T00:00:00Z"},
+		},
+	}, nil
+}
+
+func (fakeService) ExpireAPIKey(id string) (*apiv1.APIKey, error) {
+	return &apiv1.APIKey{ID: id}, nil
+}
+
+func (fakeService) RevokeAPIKey(id string) error {
+	return nil
+}
+
 const serviceURL = "http://waldo.com"
 
 func (fakeService) RootURI() string {
@@ -191,6 +270,91 @@ func TestCommandSucceeds(t *testing.T) {
 			Args:   []string{"host", "delete", "foo", "bar"},
 			ExpOut: "",
 		},
+		{
+			Name:   "host create with --ttl",
+			Args:   []string{"host", "create", "--ttl=4h"},
+			ExpOut: "foo\n",
+		},
+		{
+			Name:   "host create with --label",
+			Args:   []string{"host", "create", "--label=team=camera,purpose=ci"},
+			ExpOut: "foo\n",
+		},
+		{
+			Name:   "host list with --selector",
+			Args:   []string{"host", "list", "--selector=team=camera"},
+			ExpOut: "foo\n",
+		},
+		{
+			Name:   "host label",
+			Args:   []string{"host", "label", "foo", "--label=team=camera"},
+			ExpOut: "foo\n",
+		},
+		{
+			Name:   "host share",
+			Args:   []string{"host", "share", "foo", "group:camera", "--role=editor"},
+			ExpOut: "group:camera\teditor\nuser:janedoe\tviewer\n",
+		},
+		{
+			Name:   "host share updates role",
+			Args:   []string{"host", "share", "foo", "janedoe", "--role=editor"},
+			ExpOut: "user:janedoe\teditor\n",
+		},
+		{
+			Name:   "host unshare",
+			Args:   []string{"host", "unshare", "foo", "janedoe"},
+			ExpOut: "",
+		},
+		{
+			Name:   "host describe",
+			Args:   []string{"host", "describe", "foo"},
+			ExpOut: "{\n  \"name\": \"foo\",\n  \"status\": \"RUNNING\"\n}\n",
+		},
+		{
+			Name:   "host stop",
+			Args:   []string{"host", "stop", "foo"},
+			ExpOut: "foo\n",
+		},
+		{
+			Name:   "host start",
+			Args:   []string{"host", "start", "foo"},
+			ExpOut: "foo\n",
+		},
+		{
+			Name:   "host extend",
+			Args:   []string{"host", "extend", "foo", "--ttl=4h"},
+			ExpOut: "foo\t2024-01-01T04:00:00Z\n",
+		},
+		{
+			Name:   "operation list",
+			Args:   []string{"operation", "list"},
+			ExpOut: "op-1\tcreatehost\tRUNNING\nop-2\tdeletehost\tDONE\n",
+		},
+		{
+			Name:   "operation wait",
+			Args:   []string{"operation", "wait", "op-1"},
+			ExpOut: "{\"name\":\"foo\"}\n",
+		},
+		{
+			Name:   "operation cancel",
+			Args:   []string{"operation", "cancel", "op-1"},
+			ExpOut: "op-1\n",
+		},
+		{
+			Name:   "apikey create",
+			Args:   []string{"apikey", "create", "--identity=svc-ci-bot", "--ttl=720h"},
+			ExpOut: "foo.secret\n",
+		},
+		{
+			Name:   "apikey list",
+			Args:   []string{"apikey", "list"},
+			ExpOut: "foo\tsvc-ci-bot\tpresubmit\t\nbar\tsvc-ci-bot\tnightly\t2024-01-01T00:00:00Z\n",
+		},
+		{
+			Name:   "apikey revoke",
+			Args:   []string{"apikey", "revoke", "foo", "bar", "--expire"},
+			ExpOut: "",
+		},
 		{
 			Name:   "create",
 			Args:   []string{"create", "--build_id=123"},
@@ -38,12 +38,44 @@ type HostConfig struct {
 type AuthnConfig struct {
 	OIDCToken      *OIDCTokenConfig      `json:"oidc_token,omitempty"`
 	HTTPBasicAuthn *HTTPBasicAuthnConfig `json:"http_basic_authn,omitempty"`
+	APIKey         *APIKeyConfig         `json:"api_key,omitempty"`
+	MTLS           *MTLSConfig           `json:"mtls,omitempty"`
+}
+
+func (c *AuthnConfig) countOptions() int {
+	count := 0
+	if c.OIDCToken != nil {
+		count++
+	}
+	if c.HTTPBasicAuthn != nil {
+		count++
+	}
+	if c.APIKey != nil {
+		count++
+	}
+	if c.MTLS != nil {
+		count++
+	}
+	return count
 }
 
 type OIDCTokenConfig struct {
 	TokenFile string `json:"token_file,omitempty"`
 }
 
+// Used by service accounts, i.e: CI bots, which can't authenticate interactively.
+type APIKeyConfig struct {
+	// Path to a file containing the key returned by `cvdr apikey create`.
+	KeyFile string `json:"key_file,omitempty"`
+}
+
+// Client certificate presented to cloud orchestrators using the mTLS account manager.
+type MTLSConfig struct {
+	// PEM encoded certificate chain and private key.
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+}
+
 type UsernameSrcType string
 
 const UnixUsernameSrc UsernameSrcType = "unix"
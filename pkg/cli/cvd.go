@@ -321,12 +321,16 @@ type cvdListResult struct {
 }
 
 func listCVDs(service client.Service, controlDir string) ([]*RemoteHost, error) {
-	hl, err := service.ListHosts()
+	hl, err := service.ListHosts(&client.ListHostsOpts{})
 	if err != nil {
 		return nil, fmt.Errorf("error listing hosts: %w", err)
 	}
 	var hosts []string
 	for _, host := range hl.Items {
+		// Stopped or suspended hosts can't be reached. The status is empty with older servers.
+		if host.Status != "" && host.Status != "RUNNING" {
+			continue
+		}
 		hosts = append(hosts, host.Name)
 	}
 	var chans []chan cvdListResult
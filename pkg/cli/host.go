@@ -15,7 +15,8 @@
 package cli
 
 import (
-	"fmt"
+	"strings"
+	"time"
 
 	apiv1 "github.com/google/cloud-android-orchestration/api/v1"
 	"github.com/google/cloud-android-orchestration/pkg/client"
@@ -23,6 +24,10 @@ import (
 
 type CreateHostOpts struct {
 	GCP CreateGCPHostOpts
+	// The host is deleted automatically after this duration, it never expires if zero.
+	TTL time.Duration
+	// User labels of the host.
+	Labels map[string]string
 }
 
 type CreateGCPHostOpts struct {
@@ -38,7 +43,9 @@ func createHost(service client.Service, opts CreateHostOpts) (*apiv1.HostInstanc
 				MachineType:    opts.GCP.MachineType,
 				MinCPUPlatform: opts.GCP.MinCPUPlatform,
 			},
+			Labels: opts.Labels,
 		},
+		TTLSeconds: int64(opts.TTL.Seconds()),
 	}
 	if len(opts.GCP.AcceleratorConfigs) != 0 {
 		s := []*apiv1.AcceleratorConfig{}
@@ -51,27 +58,75 @@ func createHost(service client.Service, opts CreateHostOpts) (*apiv1.HostInstanc
 	return service.CreateHost(&req)
 }
 
-func hostnames(service client.Service) ([]string, error) {
-	hosts, err := service.ListHosts()
+func extendHost(service client.Service, host string, ttl time.Duration) (*apiv1.HostInstance, error) {
+	req := &apiv1.ExtendHostRequest{
+		TTLSeconds: int64(ttl.Seconds()),
+	}
+	return service.ExtendHost(host, req)
+}
+
+// Grants the role to the principals on the host keeping the rest of its access control list.
+// Principals without the `user:` or `group:` prefix are considered users.
+func shareHost(service client.Service, host string, principals []string, role string) (*apiv1.HostACL, error) {
+	acl, err := service.GetHostACL(host)
 	if err != nil {
 		return nil, err
 	}
-	result := []string{}
-	for _, h := range hosts.Items {
-		result = append(result, h.Name)
+	entries := []*apiv1.HostACLEntry{}
+	for _, p := range principals {
+		entries = append(entries, &apiv1.HostACLEntry{Principal: qualifiedPrincipal(p), Role: role})
 	}
-	return result, nil
+	for _, e := range acl.Entries {
+		if !containsPrincipal(entries, e.Principal) {
+			entries = append(entries, e)
+		}
+	}
+	return service.SetHostACL(host, &apiv1.HostACL{Entries: entries})
 }
 
-func findHost(service client.Service, name string) (*apiv1.HostInstance, error) {
-	hosts, err := service.ListHosts()
+// Revokes the access to the host granted to the principals.
+func unshareHost(service client.Service, host string, principals []string) (*apiv1.HostACL, error) {
+	acl, err := service.GetHostACL(host)
 	if err != nil {
-		return nil, fmt.Errorf("error listing hosts: %w", err)
+		return nil, err
+	}
+	revoked := []*apiv1.HostACLEntry{}
+	for _, p := range principals {
+		revoked = append(revoked, &apiv1.HostACLEntry{Principal: qualifiedPrincipal(p)})
+	}
+	entries := []*apiv1.HostACLEntry{}
+	for _, e := range acl.Entries {
+		if !containsPrincipal(revoked, e.Principal) {
+			entries = append(entries, e)
+		}
+	}
+	return service.SetHostACL(host, &apiv1.HostACL{Entries: entries})
+}
+
+func qualifiedPrincipal(p string) string {
+	if strings.HasPrefix(p, "user:") || strings.HasPrefix(p, "group:") {
+		return p
 	}
-	for _, host := range hosts.Items {
-		if host.Name == name {
-			return host, nil
+	return "user:" + p
+}
+
+func containsPrincipal(entries []*apiv1.HostACLEntry, principal string) bool {
+	for _, e := range entries {
+		if e.Principal == principal {
+			return true
 		}
 	}
-	return nil, fmt.Errorf("name not found: %s", name)
+	return false
+}
+
+func hostnames(service client.Service) ([]string, error) {
+	hosts, err := service.ListHosts(&client.ListHostsOpts{})
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, h := range hosts.Items {
+		result = append(result, h.Name)
+	}
+	return result, nil
 }
@@ -15,11 +15,13 @@
 package client
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,6 +34,7 @@ const (
 	// Value to pass as credentials to the Host Orchestrator service endpoints. Any non-empty value is enough.
 	InjectedCredentials             = "inject"
 	headerNameCOInjectBuildAPICreds = "X-Cutf-Cloud-Orchestrator-Inject-BuildAPI-Creds"
+	headerNameAPIKey                = "X-Cutf-Api-Key"
 )
 
 type ApiCallError struct {
@@ -56,6 +59,9 @@ func (e *ApiCallError) Is(target error) bool {
 type AuthnOpts struct {
 	OIDCToken *OIDCToken
 	HTTPBasic *HTTPBasic
+	APIKey    *APIKey
+	// Presented to the cloud orchestrator during the TLS handshake.
+	ClientCert *tls.Certificate
 }
 
 type OIDCToken struct {
@@ -66,6 +72,10 @@ type HTTPBasic struct {
 	Username string
 }
 
+type APIKey struct {
+	Value string
+}
+
 type ServiceOptions struct {
 	RootEndpoint   string
 	ProxyURL       string
@@ -80,15 +90,66 @@ type ServiceOptions struct {
 type Service interface {
 	CreateHost(req *apiv1.CreateHostRequest) (*apiv1.HostInstance, error)
 
-	ListHosts() (*apiv1.ListHostsResponse, error)
+	ListHosts(opts *ListHostsOpts) (*apiv1.ListHostsResponse, error)
+
+	GetHost(name string) (*apiv1.HostInstance, error)
 
 	DeleteHosts(names []string) error
 
+	ExtendHost(name string, req *apiv1.ExtendHostRequest) (*apiv1.HostInstance, error)
+
+	// Replaces the user labels of the host.
+	SetHostLabels(name string, req *apiv1.SetHostLabelsRequest) (*apiv1.HostInstance, error)
+
+	GetHostACL(name string) (*apiv1.HostACL, error)
+
+	// Replaces the access control list of the host, only its owner may do it.
+	SetHostACL(name string, acl *apiv1.HostACL) (*apiv1.HostACL, error)
+
+	// Stops the host and waits until it's stopped.
+	StopHost(name string) error
+
+	// Starts or resumes the host and waits until it's running.
+	StartHost(name string) (*apiv1.HostInstance, error)
+
+	ListOperations(opts *ListOperationsOpts) (*apiv1.ListOperationsResponse, error)
+
+	// Waits for the operation to be done, the result of the operation is parsed into the res
+	// output parameter if provided.
+	WaitOperation(name string, res any) error
+
+	CancelOperation(name string) (*apiv1.Operation, error)
+
+	// Creates an api key, the returned key is the only place its secret is available.
+	CreateAPIKey(req *apiv1.CreateAPIKeyRequest) (*apiv1.APIKey, error)
+
+	ListAPIKeys() (*apiv1.ListAPIKeysResponse, error)
+
+	// Expires the api key, expired keys are still listed.
+	ExpireAPIKey(id string) (*apiv1.APIKey, error)
+
+	// Deletes the api key.
+	RevokeAPIKey(id string) error
+
 	HostService(host string) HostOrchestratorService
 
 	RootURI() string
 }
 
+type ListHostsOpts struct {
+	// Only list hosts having these labels if not empty, i.e: `team=camera,purpose=ci`.
+	LabelSelector string
+}
+
+type ListOperationsOpts struct {
+	// Only list operations of this user if not empty.
+	User string
+	// Only list operations of this type if not empty, i.e: `createhost`.
+	Type string
+	// Only list operations in this state if not empty, i.e: `RUNNING`.
+	State string
+}
+
 type serviceImpl struct {
 	*ServiceOptions
 	httpHelper HTTPHelper
@@ -116,6 +177,23 @@ func NewService(opts *ServiceOptions) (Service, error) {
 		if opts.Authn.HTTPBasic != nil {
 			helper.HTTPBasicUsername = opts.Authn.HTTPBasic.Username
 		}
+		if opts.Authn.APIKey != nil {
+			helper.APIKey = opts.Authn.APIKey.Value
+		}
+		if opts.Authn.ClientCert != nil {
+			transport, ok := helper.Client.Transport.(*http.Transport)
+			if !ok {
+				transport = http.DefaultTransport.(*http.Transport).Clone()
+			}
+			// The rest of the TLS configuration is kept, i.e: the trusted root CAs.
+			tlsConfig := &tls.Config{}
+			if transport.TLSClientConfig != nil {
+				tlsConfig = transport.TLSClientConfig.Clone()
+			}
+			tlsConfig.Certificates = append(tlsConfig.Certificates, *opts.Authn.ClientCert)
+			transport.TLSClientConfig = tlsConfig
+			helper.Client.Transport = transport
+		}
 	}
 	return &serviceImpl{ServiceOptions: opts, httpHelper: helper}, nil
 }
@@ -146,9 +224,21 @@ func (c *serviceImpl) CreateHost(req *apiv1.CreateHostRequest) (*apiv1.HostInsta
 	return ins, nil
 }
 
-func (c *serviceImpl) ListHosts() (*apiv1.ListHostsResponse, error) {
+func (c *serviceImpl) ListHosts(opts *ListHostsOpts) (*apiv1.ListHostsResponse, error) {
+	path := "/hosts"
+	if opts.LabelSelector != "" {
+		path += "?" + url.Values{"labelSelector": {opts.LabelSelector}}.Encode()
+	}
 	var res apiv1.ListHostsResponse
-	if err := c.httpHelper.NewGetRequest("/hosts").JSONResDo(&res); err != nil {
+	if err := c.httpHelper.NewGetRequest(path).JSONResDo(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *serviceImpl) GetHost(name string) (*apiv1.HostInstance, error) {
+	var res apiv1.HostInstance
+	if err := c.httpHelper.NewGetRequest("/hosts/" + name).JSONResDo(&res); err != nil {
 		return nil, err
 	}
 	return &res, nil
@@ -173,6 +263,128 @@ func (c *serviceImpl) DeleteHosts(names []string) error {
 	return merr
 }
 
+func (c *serviceImpl) ExtendHost(name string, req *apiv1.ExtendHostRequest) (*apiv1.HostInstance, error) {
+	var res apiv1.HostInstance
+	if err := c.httpHelper.NewPostRequest("/hosts/"+name+"/:extend", req).JSONResDo(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *serviceImpl) SetHostLabels(name string, req *apiv1.SetHostLabelsRequest) (*apiv1.HostInstance, error) {
+	var res apiv1.HostInstance
+	if err := c.httpHelper.NewPostRequest("/hosts/"+name+"/:setLabels", req).JSONResDo(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *serviceImpl) GetHostACL(name string) (*apiv1.HostACL, error) {
+	var res apiv1.HostACL
+	if err := c.httpHelper.NewGetRequest("/hosts/" + name + "/acl").JSONResDo(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *serviceImpl) SetHostACL(name string, acl *apiv1.HostACL) (*apiv1.HostACL, error) {
+	var res apiv1.HostACL
+	if err := c.httpHelper.NewPutRequest("/hosts/"+name+"/acl", acl).JSONResDo(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *serviceImpl) StopHost(name string) error {
+	var op apiv1.Operation
+	if err := c.httpHelper.NewPostRequest("/hosts/"+name+"/:stop", nil).JSONResDo(&op); err != nil {
+		return err
+	}
+	return c.waitForOperation(&op, nil)
+}
+
+func (c *serviceImpl) StartHost(name string) (*apiv1.HostInstance, error) {
+	var op apiv1.Operation
+	if err := c.httpHelper.NewPostRequest("/hosts/"+name+"/:start", nil).JSONResDo(&op); err != nil {
+		return nil, err
+	}
+	ins := &apiv1.HostInstance{}
+	if err := c.waitForOperation(&op, ins); err != nil {
+		return nil, err
+	}
+	return ins, nil
+}
+
+func (c *serviceImpl) ListOperations(opts *ListOperationsOpts) (*apiv1.ListOperationsResponse, error) {
+	query := url.Values{}
+	if opts.User != "" {
+		query.Set("user", opts.User)
+	}
+	if opts.Type != "" {
+		query.Set("type", opts.Type)
+	}
+	if opts.State != "" {
+		query.Set("state", opts.State)
+	}
+	path := "/operations"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var res apiv1.ListOperationsResponse
+	if err := c.httpHelper.NewGetRequest(path).JSONResDo(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *serviceImpl) WaitOperation(name string, res any) error {
+	return c.waitForOperation(&apiv1.Operation{Name: name}, res)
+}
+
+func (c *serviceImpl) CancelOperation(name string) (*apiv1.Operation, error) {
+	var op apiv1.Operation
+	if err := c.httpHelper.NewPostRequest("/operations/"+name+"/:cancel", nil).JSONResDo(&op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+func (c *serviceImpl) CreateAPIKey(req *apiv1.CreateAPIKeyRequest) (*apiv1.APIKey, error) {
+	var res apiv1.APIKey
+	if err := c.globalHTTPHelper().NewPostRequest("/admin/apikeys", req).JSONResDo(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *serviceImpl) ListAPIKeys() (*apiv1.ListAPIKeysResponse, error) {
+	var res apiv1.ListAPIKeysResponse
+	if err := c.globalHTTPHelper().NewGetRequest("/admin/apikeys").JSONResDo(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *serviceImpl) ExpireAPIKey(id string) (*apiv1.APIKey, error) {
+	var res apiv1.APIKey
+	if err := c.globalHTTPHelper().NewPostRequest("/admin/apikeys/"+id+"/:expire", nil).JSONResDo(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *serviceImpl) RevokeAPIKey(id string) error {
+	return c.globalHTTPHelper().NewDeleteRequest("/admin/apikeys/" + id).JSONResDo(nil)
+}
+
+// The root endpoint includes the zone, this helper sends requests to the endpoints that don't
+// belong to any zone instead.
+func (c *serviceImpl) globalHTTPHelper() *HTTPHelper {
+	helper := c.httpHelper
+	helper.RootEndpoint, _, _ = strings.Cut(helper.RootEndpoint, "/zones/")
+	return &helper
+}
+
 func (c *serviceImpl) waitForOperation(op *apiv1.Operation, res any) error {
 	path := "/operations/" + op.Name + "/:wait"
 	retryOpts := RetryOptions{
@@ -15,8 +15,15 @@
 package client
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
@@ -106,6 +113,34 @@ func TestDeleteHosts(t *testing.T) {
 	}
 }
 
+func TestCreateAPIKeyUsesGlobalEndpoint(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ep := r.Method + " " + r.URL.Path; ep != "POST /v1/admin/apikeys" {
+			t.Fatal("unexpected endpoint: " + ep)
+		}
+		if got := r.Header.Get("X-Cutf-Api-Key"); got != "secret" {
+			t.Errorf("unexpected api key header: %q", got)
+		}
+		writeOK(w, &apiv1.APIKey{ID: "foo", Key: "foo.bar"})
+	}))
+	defer ts.Close()
+	opts := &ServiceOptions{
+		RootEndpoint: BuildRootEndpoint(ts.URL, "v1", "us-central1-a"),
+		DumpOut:      io.Discard,
+		Authn:        &AuthnOpts{APIKey: &APIKey{Value: "secret"}},
+	}
+	srv, _ := NewService(opts)
+
+	res, err := srv.CreateAPIKey(&apiv1.CreateAPIKeyRequest{Identity: "svc-ci-bot"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&apiv1.APIKey{ID: "foo", Key: "foo.bar"}, res); diff != "" {
+		t.Errorf("api key mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func writeErr(w http.ResponseWriter, statusCode int) {
 	write(w, &apiv1.Error{Code: statusCode}, statusCode)
 }
@@ -120,3 +155,55 @@ func write(w http.ResponseWriter, data any, statusCode int) {
 	encoder := json.NewEncoder(w)
 	encoder.Encode(data)
 }
+
+func newTestClientCert(t *testing.T) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "johndoe"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertKeepsRootCAs(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			writeErr(w, 401)
+			return
+		}
+		writeOK(w, &apiv1.HostInstance{Name: r.TLS.PeerCertificates[0].Subject.CommonName})
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+	// The server is trusted by the default transport, which the client is built from.
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	origTLSConfig := defaultTransport.TLSClientConfig
+	defaultTransport.TLSClientConfig = ts.Client().Transport.(*http.Transport).TLSClientConfig
+	defer func() { defaultTransport.TLSClientConfig = origTLSConfig }()
+	opts := &ServiceOptions{
+		RootEndpoint: ts.URL,
+		DumpOut:      io.Discard,
+		Authn:        &AuthnOpts{ClientCert: newTestClientCert(t)},
+	}
+	srv, _ := NewService(opts)
+
+	host, err := srv.GetHost("foo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("johndoe", host.Name); diff != "" {
+		t.Errorf("presented certificate mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -39,6 +39,8 @@ type HTTPHelper struct {
 	Dumpster          io.Writer
 	AccessToken       string
 	HTTPBasicUsername string
+	// Sent in the X-Cutf-Api-Key header if not empty.
+	APIKey string
 }
 
 func (h *HTTPHelper) NewGetRequest(path string) *HTTPRequestBuilder {
@@ -60,6 +62,14 @@ func (h *HTTPHelper) NewDeleteRequest(path string) *HTTPRequestBuilder {
 }
 
 func (h *HTTPHelper) NewPostRequest(path string, jsonBody any) *HTTPRequestBuilder {
+	return h.newJSONRequest(http.MethodPost, path, jsonBody)
+}
+
+func (h *HTTPHelper) NewPutRequest(path string, jsonBody any) *HTTPRequestBuilder {
+	return h.newJSONRequest(http.MethodPut, path, jsonBody)
+}
+
+func (h *HTTPHelper) newJSONRequest(method, path string, jsonBody any) *HTTPRequestBuilder {
 	body := []byte{}
 	var err error
 	if jsonBody != nil {
@@ -68,7 +78,7 @@ func (h *HTTPHelper) NewPostRequest(path string, jsonBody any) *HTTPRequestBuild
 		}
 	}
 	var req *http.Request
-	if req, err = http.NewRequest(http.MethodPost, h.RootEndpoint+path, bytes.NewBuffer(body)); err != nil {
+	if req, err = http.NewRequest(method, h.RootEndpoint+path, bytes.NewBuffer(body)); err != nil {
 		return &HTTPRequestBuilder{helper: h, request: nil, err: err}
 	}
 	req.Header.Set("Content-Type", "application/json")
@@ -195,6 +205,9 @@ func (rb *HTTPRequestBuilder) doWithRetries(retryOpts RetryOptions) (*http.Respo
 	} else if rb.helper.HTTPBasicUsername != "" {
 		rb.SetBasicAuth()
 	}
+	if rb.helper.APIKey != "" {
+		rb.AddHeader(headerNameAPIKey, rb.helper.APIKey)
+	}
 	if rb.err != nil {
 		return nil, rb.err
 	}